@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 
@@ -12,13 +13,21 @@ import (
 	"github.com/krizcold/stremio-torrent-bridge/internal/cache"
 	"github.com/krizcold/stremio-torrent-bridge/internal/config"
 	"github.com/krizcold/stremio-torrent-bridge/internal/engine"
+	"github.com/krizcold/stremio-torrent-bridge/internal/preload"
+	"github.com/krizcold/stremio-torrent-bridge/internal/probe"
 	"github.com/krizcold/stremio-torrent-bridge/internal/proxy"
 	"github.com/krizcold/stremio-torrent-bridge/internal/relay"
+	"github.com/krizcold/stremio-torrent-bridge/internal/scrape"
+	"github.com/krizcold/stremio-torrent-bridge/internal/videohash"
 )
 
 func main() {
-	// 1. Load configuration from environment variables with sensible defaults.
+	// 1. Load configuration from environment variables with sensible defaults,
+	//    then apply settings changed at runtime through the management API.
 	cfg := config.Load()
+	if err := cfg.LoadRuntime(); err != nil {
+		fmt.Printf("Failed to load saved runtime config: %v (using environment)\n", err)
+	}
 	cfg.LogSummary()
 
 	// 2. Create the torrent engine adapter based on configuration.
@@ -29,7 +38,7 @@ func main() {
 	case "rqbit":
 		eng = engine.NewRqbitAdapter(cfg.RqbitURL, cfg.RqbitUsername, cfg.RqbitPassword)
 	case "qbittorrent":
-		eng = engine.NewQBittorrentAdapter(cfg.QBittorrentURL, cfg.QBitDownloadPath, cfg.QBitUsername, cfg.QBitPassword)
+		eng = engine.NewQBittorrentAdapter(cfg.QBittorrentURL, cfg.QBitDownloadPath, cfg.QBitUsername, cfg.QBitPassword, cfg.DataDir)
 	default:
 		eng = engine.NewTorrServerAdapter(cfg.TorrServerURL, cfg.TorrServerUsername, cfg.TorrServerPassword)
 	}
@@ -38,8 +47,12 @@ func main() {
 	// 2b. Create the cache manager for LRU cleanup.
 	cacheManager := cache.NewCacheManager(eng, cfg)
 
+	// 2c. Create the preload scheduler that pre-warms torrent metadata for
+	//     top-ranked streams with bounded concurrency.
+	preloader := preload.NewScheduler(eng, cfg)
+
 	// 3. Create the addon store for persisting wrapped addon registrations.
-	store, err := addon.NewAddonStore(cfg.DataDir)
+	store, err := addon.NewAddonStore(cfg.DataDir, cfg.AddonSecretKey)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create addon store: %v\n", err)
 		os.Exit(1)
@@ -50,12 +63,42 @@ func main() {
 	relayServer := relay.NewServer()
 
 	// 5. Create the addon wrapper (manifest rewrite + stream interception)
-	//    and the stream proxy (video passthrough with Range support).
-	wrapper := addon.NewWrapper(store, cfg, eng, relayServer)
-	streamProxy := proxy.NewStreamProxy(eng, cacheManager)
+	//    and the stream proxy (video passthrough with Range support). The
+	//    optional HTTP passthrough bridges plain url streams as well, and the
+	//    optional tracker scraper annotates streams with live swarm sizes, and
+	//    the optional video hasher computes OpenSubtitles hashes of played and
+	//    cached files for subtitle matching. The prober reads container
+	//    headers to describe the tracks of files in the engine.
+	var passthrough *proxy.HTTPPassthrough
+	if cfg.HTTPPassthrough {
+		passthrough, err = proxy.NewHTTPPassthrough(cfg.DataDir, cfg.HTTPPassthroughPrivateHosts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create HTTP passthrough: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var scraper *scrape.Client
+	if cfg.TrackerScrape {
+		scraper = scrape.NewClient()
+	}
+	var hasher *videohash.Hasher
+	if cfg.VideoHash {
+		hasher = videohash.NewHasher(eng, cfg.DataDir)
+	}
+	prober := probe.NewProber(eng)
+	wrapper := addon.NewWrapper(store, cfg, eng, addon.WrapperDeps{
+		Relay:        relayServer,
+		Preloader:    preloader,
+		Passthrough:  passthrough,
+		CacheManager: cacheManager,
+		Scraper:      scraper,
+		Hasher:       hasher,
+		Prober:       prober,
+	})
+	streamProxy := proxy.NewStreamProxy(eng, cacheManager, preloader, hasher)
 
 	// 6. Create the management REST API handlers.
-	handlers := api.NewHandlers(store, cfg, eng, cacheManager, wrapper, relayServer)
+	handlers := api.NewHandlers(store, cfg, eng, cacheManager, wrapper, relayServer, prober)
 
 	// 7. Create the go-stremio addon with manifest and placeholder stream handlers.
 	//    The placeholder handlers return NotFound because the real stream handling
@@ -98,12 +141,28 @@ func main() {
 	}
 
 	// 8. Register all routes: management API, wrap endpoints, stream proxy, relay, and UI.
-	api.RegisterRoutes(stremioAddon, handlers, wrapper, streamProxy, relayServer)
+	//    The bridge manifest is extended with an addon_catalog listing the
+	//    wrapped addons, so installing the bridge exposes them in Stremio, and
+	//    with "Cached on bridge" catalogs of torrents already downloaded, and
+	//    with the subtitles resource for subtitle files inside torrents.
+	manifestJSON, err := json.Marshal(manifest)
+	if err == nil {
+		manifestJSON, err = addon.ExtendBridgeManifest(manifestJSON)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to build bridge manifest: %v\n", err)
+		os.Exit(1)
+	}
+	api.RegisterRoutes(stremioAddon, handlers, wrapper, streamProxy, passthrough, relayServer, manifestJSON)
 
 	// 9. Start cache manager background cleanup.
 	cacheManager.Start()
 	defer cacheManager.Stop()
 
+	// 9b. Start the preload workers and unplayed-torrent janitor.
+	preloader.Start()
+	defer preloader.Stop()
+
 	// 10. Start the server.
 	fmt.Printf("Torrent Bridge starting on %s:%d\n", cfg.BindAddr, cfg.Port)
 	stopChan := make(chan bool, 1)
@@ -0,0 +1,173 @@
+package addon
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/krizcold/stremio-torrent-bridge/pkg/httpclient"
+)
+
+// autoWrapLookupTimeout bounds resolving an auto-wrap host.
+const autoWrapLookupTimeout = 5 * time.Second
+
+// Auto-wrap failures. The route handler maps these to HTTP statuses.
+var (
+	ErrAutoWrapDisabled   = errors.New("auto-wrap is disabled")
+	ErrAutoWrapInvalidURL = errors.New("invalid manifest URL")
+	ErrAutoWrapHost       = errors.New("host not allowed for auto-wrap")
+	ErrAutoWrapLimit      = errors.New("too many auto-wrapped addons")
+)
+
+// ResolveAutoWrap turns the {encoded-manifest-url} segment of an /auto/ path
+// into a wrap ID, registering the addon on first use so fetch-method
+// settings, stats and the UI work the same as for registered addons. The
+// segment may be percent-encoded (encodeURIComponent) or base64url.
+//
+// Unless its host is listed in AUTO_WRAP_HOSTS, an addon is only registered
+// if the host resolves to public addresses, so /auto/ can't be used to reach
+// the bridge's own network, and at most AUTO_WRAP_MAX addons are registered
+// this way.
+func (w *Wrapper) ResolveAutoWrap(encoded string) (string, error) {
+	if !w.config.AutoWrap {
+		return "", ErrAutoWrapDisabled
+	}
+
+	manifestURL, err := decodeAutoWrapURL(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(manifestURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		!strings.HasSuffix(u.Path, "/manifest.json") {
+		return "", fmt.Errorf("%w: must be an http(s) URL ending in /manifest.json", ErrAutoWrapInvalidURL)
+	}
+	host := strings.ToLower(u.Hostname())
+	allowed, listed := w.autoWrapHostAllowed(host)
+	if !allowed {
+		return "", fmt.Errorf("%w: %s", ErrAutoWrapHost, host)
+	}
+
+	id := AddonID(manifestURL)
+	if _, found := w.store.Get(id); found {
+		return id, nil
+	}
+
+	if !listed {
+		if err := checkPublicHost(host); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrAutoWrapHost, err)
+		}
+	}
+
+	w.autoWrapMu.Lock()
+	defer w.autoWrapMu.Unlock()
+	if _, found := w.store.Get(id); found {
+		return id, nil
+	}
+	auto := 0
+	for _, a := range w.store.List() {
+		if a.AutoWrapped {
+			auto++
+		}
+	}
+	if auto >= w.config.AutoWrapMax {
+		return "", fmt.Errorf("%w: limit of %d reached, register the addon instead", ErrAutoWrapLimit, w.config.AutoWrapMax)
+	}
+
+	if _, err := w.store.AddAuto(manifestURL); err != nil {
+		return "", err
+	}
+	fmt.Printf("wrapper: auto-wrapped %s as %s\n", RedactURL(manifestURL), id)
+	return id, nil
+}
+
+// autoWrapHostAllowed checks a lowercase hostname against AUTO_WRAP_HOSTS
+// (exact match or subdomain) and reports whether it is allowed and whether
+// it is listed explicitly. With no allowlist every host is allowed but none
+// is listed. The bridge's own host is never allowed, to prevent loops.
+func (w *Wrapper) autoWrapHostAllowed(host string) (allowed, listed bool) {
+	if ext, err := url.Parse(w.externalURL); err == nil && ext.Hostname() != "" &&
+		strings.EqualFold(ext.Hostname(), host) {
+		return false, false
+	}
+
+	if len(w.config.AutoWrapHosts) == 0 {
+		return true, false
+	}
+	if httpclient.MatchHost(host, w.config.AutoWrapHosts) {
+		return true, true
+	}
+	return false, false
+}
+
+// autoWrapHostListed reports whether host is listed in AUTO_WRAP_HOSTS, which
+// exempts it from the public-address check.
+func (w *Wrapper) autoWrapHostListed(host string) bool {
+	_, listed := w.autoWrapHostAllowed(strings.ToLower(host))
+	return listed
+}
+
+// directClientFor returns the client for direct fetches of an addon.
+// Auto-wrapped addons come from untrusted /auto/ requests, so their fetches
+// (redirects included) may only reach public addresses unless the host is
+// listed in AUTO_WRAP_HOSTS.
+func (w *Wrapper) directClientFor(addonID string) *http.Client {
+	if a, found := w.store.Get(addonID); found && a.AutoWrapped {
+		return w.autoClient
+	}
+	return w.httpClient
+}
+
+// checkPublicHost resolves host and fails if any of its addresses is
+// loopback, private, link-local or otherwise not publicly routable. It
+// rejects such hosts up front; directClientFor enforces the same rule on
+// every connection.
+func checkPublicHost(host string) error {
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), autoWrapLookupTimeout)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return fmt.Errorf("resolve %s: %w", host, err)
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+
+	for _, ip := range ips {
+		if !httpclient.IsPublicIP(ip) {
+			return fmt.Errorf("%s resolves to non-public address %s", host, ip)
+		}
+	}
+	return nil
+}
+
+// decodeAutoWrapURL decodes a percent-encoded or base64url manifest URL.
+func decodeAutoWrapURL(encoded string) (string, error) {
+	if decoded, err := url.PathUnescape(encoded); err == nil && hasHTTPScheme(decoded) {
+		return decoded, nil
+	}
+	for _, enc := range []*base64.Encoding{base64.RawURLEncoding, base64.URLEncoding} {
+		if data, err := enc.DecodeString(encoded); err == nil && hasHTTPScheme(string(data)) {
+			return string(data), nil
+		}
+	}
+	return "", fmt.Errorf("%w: expected a percent-encoded or base64url http(s) URL", ErrAutoWrapInvalidURL)
+}
+
+// hasHTTPScheme reports whether s starts with http:// or https://.
+func hasHTTPScheme(s string) bool {
+	lower := strings.ToLower(s)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
@@ -0,0 +1,235 @@
+package addon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber"
+)
+
+// CachedCatalogID identifies the bridge's "Cached on bridge" catalogs (one per
+// type in CachedCatalogTypes).
+const CachedCatalogID = "bridge-cached"
+
+// CachedCatalogTypes are the content types the cached catalog is offered for.
+var CachedCatalogTypes = []string{"movie", "series"}
+
+const (
+	// cinemetaURL resolves IMDb ids when the originating addon has no meta.
+	cinemetaURL = "https://v3-cinemeta.strem.io"
+
+	cachedCatalogLimit = 100
+	metaResolveTimeout = 8 * time.Second
+)
+
+// metaPreviewFields are the meta fields copied into catalog previews.
+var metaPreviewFields = []string{
+	"name", "poster", "posterShape", "background", "logo",
+	"description", "releaseInfo", "imdbRating", "genres",
+}
+
+// cachedItem is one Stremio item with at least one torrent in the cache.
+type cachedItem struct {
+	Type        string
+	ID          string // meta id; the show for series, e.g. "tt0944947"
+	AddonID     string // wrapped addon the stream was found in
+	TorrentName string
+}
+
+// metaCache keeps resolved meta previews in memory, keyed by type and id.
+// Failed lookups are not cached so they are retried on the next request.
+type metaCache struct {
+	mu      sync.RWMutex
+	entries map[string]map[string]interface{}
+}
+
+func newMetaCache() *metaCache {
+	return &metaCache{entries: make(map[string]map[string]interface{})}
+}
+
+func (mc *metaCache) get(key string) map[string]interface{} {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	return mc.entries[key]
+}
+
+func (mc *metaCache) put(key string, meta map[string]interface{}) {
+	mc.mu.Lock()
+	mc.entries[key] = meta
+	mc.mu.Unlock()
+}
+
+// HandleCachedCatalog lists the Stremio items whose torrents are held by the
+// engine, most recently watched first, so they can be resumed or rewatched
+// without waiting for peers. Items are identified by the ids recorded when
+// their streams were requested through a wrapped addon; meta comes from that
+// addon when it serves meta, otherwise from Cinemeta for IMDb ids.
+//
+// Route: GET /catalog/:type/:id.json
+func (w *Wrapper) HandleCachedCatalog(c *fiber.Ctx) {
+	c.Set("Access-Control-Allow-Origin", "*")
+	c.Set("Content-Type", "application/json")
+
+	contentType := c.Params("type")
+	if c.Params("id") != CachedCatalogID || w.cacheManager == nil {
+		c.SendString(`{"metas":[]}`)
+		return
+	}
+
+	items := w.cachedItems(contentType)
+
+	ctx, cancel := context.WithTimeout(context.Background(), metaResolveTimeout)
+	defer cancel()
+
+	metas := make([]map[string]interface{}, len(items))
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, item *cachedItem) {
+			defer wg.Done()
+			metas[i] = w.metaPreview(ctx, item)
+		}(i, item)
+	}
+	wg.Wait()
+
+	out, _ := json.Marshal(map[string]interface{}{"metas": metas})
+	c.Send(out)
+}
+
+// cachedItems returns the items of one type with a cached torrent, newest
+// first. Torrents the engine no longer has are skipped; if the engine can't
+// be listed the cache manager's access log is used as is.
+func (w *Wrapper) cachedItems(contentType string) []*cachedItem {
+	var inEngine map[string]bool
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	torrents, err := w.engine.ListTorrents(ctx)
+	cancel()
+	if err != nil {
+		fmt.Printf("wrapper: cached catalog: list torrents: %v (using access log)\n", err)
+	} else {
+		inEngine = make(map[string]bool, len(torrents))
+		for _, t := range torrents {
+			inEngine[strings.ToLower(t.InfoHash)] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	var items []*cachedItem
+	// GetStats lists torrents most recently accessed first.
+	for _, entry := range w.cacheManager.GetStats().Torrents {
+		hash := strings.ToLower(entry.InfoHash)
+		if inEngine != nil && !inEngine[hash] {
+			continue
+		}
+		origin := w.origins.get(hash)
+		if origin == nil || origin.Type != contentType {
+			continue
+		}
+
+		id := metaID(origin.Type, origin.ItemID)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		items = append(items, &cachedItem{
+			Type:        origin.Type,
+			ID:          id,
+			AddonID:     origin.AddonID,
+			TorrentName: entry.Name,
+		})
+		if len(items) == cachedCatalogLimit {
+			break
+		}
+	}
+	return items
+}
+
+// metaPreview builds the catalog entry for an item. When no meta can be
+// resolved the torrent name stands in for the title.
+func (w *Wrapper) metaPreview(ctx context.Context, item *cachedItem) map[string]interface{} {
+	preview := map[string]interface{}{
+		"id":   item.ID,
+		"type": item.Type,
+		"name": item.TorrentName,
+	}
+
+	key := item.Type + "/" + item.ID
+	meta := w.metas.get(key)
+	if meta == nil {
+		meta = w.resolveMeta(ctx, item)
+		if meta != nil {
+			w.metas.put(key, meta)
+		}
+	}
+	for _, field := range metaPreviewFields {
+		if v, ok := meta[field]; ok && v != nil && v != "" {
+			preview[field] = v
+		}
+	}
+	if preview["name"] == "" {
+		preview["name"] = item.ID
+	}
+	return preview
+}
+
+// resolveMeta asks the originating wrapped addon for the item's meta when its
+// manifest declares the meta resource, then Cinemeta for IMDb ids. Returns
+// nil if neither knows the item.
+func (w *Wrapper) resolveMeta(ctx context.Context, item *cachedItem) map[string]interface{} {
+	path := "/meta/" + item.Type + "/" + url.PathEscape(item.ID) + ".json"
+
+	if a, found := w.store.Get(item.AddonID); found && !a.Disabled {
+		if cached := w.manifests.get(a.ID); cached != nil && declaredResources(cached.Data)["meta"] {
+			if data, err := w.fetchForAddonContext(ctx, a.ID, getBaseURL(a.OriginalURL)+path); err == nil {
+				if meta := parseMeta(data); meta != nil {
+					return meta
+				}
+			}
+		}
+	}
+
+	if strings.HasPrefix(item.ID, "tt") {
+		data, err := w.fetchJSONContext(ctx, w.httpClient, cinemetaURL+path)
+		if err != nil {
+			fmt.Printf("wrapper: cached catalog: resolve %s/%s: %v\n", item.Type, item.ID, err)
+			return nil
+		}
+		return parseMeta(data)
+	}
+	return nil
+}
+
+// parseMeta extracts the "meta" object from a meta response. Returns nil for
+// empty or unparseable responses.
+func parseMeta(data []byte) map[string]interface{} {
+	var resp struct {
+		Meta map[string]interface{} `json:"meta"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil || len(resp.Meta) == 0 {
+		return nil
+	}
+	return resp.Meta
+}
+
+// metaID derives the meta id from the id streams were requested for. Series
+// stream ids name an episode ("tt0944947:1:2", "kitsu:1234:5"); the meta is
+// the show itself.
+func metaID(contentType, itemID string) string {
+	if contentType != "series" {
+		return itemID
+	}
+	parts := strings.Split(itemID, ":")
+	switch {
+	case strings.HasPrefix(itemID, "tt"):
+		return parts[0]
+	case len(parts) >= 3:
+		return parts[0] + ":" + parts[1]
+	}
+	return itemID
+}
@@ -0,0 +1,168 @@
+package addon
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber"
+)
+
+// Identifies the bridge's own addon catalog in its manifest.
+const (
+	AddonCatalogType = "all"
+	AddonCatalogID   = "torrent-bridge"
+)
+
+const (
+	// addonCatalogConcurrency bounds the manifest fetches one addon catalog
+	// request runs at once.
+	addonCatalogConcurrency = 8
+	// addonCatalogDeadline bounds how long the addon catalog waits for
+	// uncached manifests. Addons still fetching are left out; their
+	// manifests are cached for the next request when the fetch completes.
+	addonCatalogDeadline = 10 * time.Second
+)
+
+// addonCatalogEntry is one addon in an addon_catalog response, in the same
+// shape Stremio uses for its addon collection.
+type addonCatalogEntry struct {
+	TransportURL  string                 `json:"transportUrl"`
+	TransportName string                 `json:"transportName"`
+	Manifest      map[string]interface{} `json:"manifest"`
+}
+
+// ExtendBridgeManifest adds the addon_catalog resource and catalog to the
+// bridge's own manifest JSON, so Stremio shows the wrapped addons in its addon
+// browser after the bridge itself is installed. It also declares the
+// "Cached on bridge" catalogs of torrents already in the engine, and the
+// subtitles resource serving subtitle files shipped inside torrents.
+func ExtendBridgeManifest(base []byte) ([]byte, error) {
+	var manifest map[string]interface{}
+	if err := json.Unmarshal(base, &manifest); err != nil {
+		return nil, fmt.Errorf("parse bridge manifest: %w", err)
+	}
+
+	resources, _ := manifest["resources"].([]interface{})
+	manifest["resources"] = append(resources, "addon_catalog", "catalog", "subtitles")
+	manifest["addonCatalogs"] = []map[string]string{{
+		"type": AddonCatalogType,
+		"id":   AddonCatalogID,
+		"name": "Torrent Bridge",
+	}}
+
+	catalogs, _ := manifest["catalogs"].([]interface{})
+	for _, t := range CachedCatalogTypes {
+		catalogs = append(catalogs, map[string]string{
+			"type": t,
+			"id":   CachedCatalogID,
+			"name": "Cached on bridge",
+		})
+	}
+	manifest["catalogs"] = catalogs
+
+	return json.Marshal(manifest)
+}
+
+// HandleAddonCatalog lists every enabled wrapped addon, in priority order,
+// with its wrapped manifest. Manifests come from the manifest cache; addons
+// without a cached manifest are fetched once (in parallel, at most
+// addonCatalogConcurrency at a time) and skipped if the fetch fails or
+// doesn't finish within addonCatalogDeadline.
+//
+// Route: GET /addon_catalog/:type/:id.json
+func (w *Wrapper) HandleAddonCatalog(c *fiber.Ctx) {
+	c.Set("Access-Control-Allow-Origin", "*")
+	c.Set("Content-Type", "application/json")
+
+	if c.Params("type") != AddonCatalogType || c.Params("id") != AddonCatalogID {
+		c.SendString(`{"addons":[]}`)
+		return
+	}
+
+	base := w.resolveExternalURL(c)
+
+	var enabled []*WrappedAddon
+	for _, a := range w.store.List() {
+		if !a.Disabled {
+			enabled = append(enabled, a)
+		}
+	}
+
+	// Results arrive on a buffered channel so fetches that outlive the
+	// deadline can still finish (and fill the manifest cache) without
+	// blocking.
+	type result struct {
+		i     int
+		entry *addonCatalogEntry
+	}
+	results := make(chan result, len(enabled))
+	sem := make(chan struct{}, addonCatalogConcurrency)
+	for i, a := range enabled {
+		go func(i int, a *WrappedAddon) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			manifest, err := w.wrappedManifest(a)
+			if err != nil {
+				fmt.Printf("wrapper: addon catalog: skipping %s: %v\n", a.ID, err)
+				results <- result{i: i}
+				return
+			}
+			results <- result{i: i, entry: &addonCatalogEntry{
+				TransportURL:  base + "/wrap/" + a.ID + "/manifest.json",
+				TransportName: "http",
+				Manifest:      manifest,
+			}}
+		}(i, a)
+	}
+
+	entries := make([]*addonCatalogEntry, len(enabled))
+	deadline := time.NewTimer(addonCatalogDeadline)
+	defer deadline.Stop()
+collect:
+	for received := 0; received < len(enabled); received++ {
+		select {
+		case r := <-results:
+			entries[r.i] = r.entry
+		case <-deadline.C:
+			fmt.Printf("wrapper: addon catalog: %d of %d manifests not ready after %s, leaving them out\n",
+				len(enabled)-received, len(enabled), addonCatalogDeadline)
+			break collect
+		}
+	}
+
+	addons := make([]*addonCatalogEntry, 0, len(entries))
+	for _, e := range entries {
+		if e != nil {
+			addons = append(addons, e)
+		}
+	}
+
+	out, _ := json.Marshal(map[string]interface{}{"addons": addons})
+	c.Send(out)
+}
+
+// wrappedManifest returns the rebranded manifest for an addon, from the
+// manifest cache or, if nothing is cached yet, from upstream.
+func (w *Wrapper) wrappedManifest(a *WrappedAddon) (map[string]interface{}, error) {
+	var data []byte
+	if cached := w.manifests.get(a.ID); cached != nil {
+		data = cached.Data
+	} else {
+		fetched, err := w.fetchForAddon(a.ID, a.OriginalURL)
+		if err != nil {
+			return nil, err
+		}
+		data = fetched
+	}
+
+	var manifest map[string]interface{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	if w.manifests.get(a.ID) == nil {
+		w.manifests.put(a.ID, data)
+	}
+	RebrandManifest(manifest, a.Overrides)
+	return manifest, nil
+}
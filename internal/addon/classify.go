@@ -0,0 +1,200 @@
+package addon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upstream failure kinds. Fetch errors wrap one of these so callers can use
+// errors.Is to decide what to do (fall back, back off, serve cache, ...).
+var (
+	ErrCloudflareChallenge = errors.New("cloudflare challenge")
+	ErrRateLimited         = errors.New("rate limited")
+	ErrCaptcha             = errors.New("captcha page")
+	ErrMaintenance         = errors.New("maintenance page")
+	ErrNotFound            = errors.New("not found")
+	ErrHTTPStatus          = errors.New("unexpected HTTP status")
+	ErrInvalidJSON         = errors.New("invalid JSON response")
+)
+
+// Classification names reported by the API for each failure kind.
+const (
+	ClassCloudflare  = "cloudflare"
+	ClassRateLimited = "rate_limited"
+	ClassCaptcha     = "captcha"
+	ClassMaintenance = "maintenance"
+	ClassNotFound    = "not_found"
+	ClassHTTPError   = "http_error"
+	ClassInvalidJSON = "invalid_json"
+	ClassNetwork     = "network"
+)
+
+// UpstreamError describes a classified upstream response.
+type UpstreamError struct {
+	Kind       error         // one of the Err* kinds above
+	StatusCode int           // HTTP status (0 if unknown)
+	RetryAfter time.Duration // from Retry-After, if the upstream sent one
+	URL        string
+}
+
+func (e *UpstreamError) Error() string {
+	msg := fmt.Sprintf("%v (HTTP %d) from %s", e.Kind, e.StatusCode, RedactURL(e.URL))
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(", retry after %s", e.RetryAfter)
+	}
+	return msg
+}
+
+func (e *UpstreamError) Unwrap() error { return e.Kind }
+
+// Classify returns the API classification name for a fetch error, or "" for
+// nil. Errors that aren't classified upstream responses are network failures.
+func Classify(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrCloudflareChallenge):
+		return ClassCloudflare
+	case errors.Is(err, ErrRateLimited):
+		return ClassRateLimited
+	case errors.Is(err, ErrCaptcha):
+		return ClassCaptcha
+	case errors.Is(err, ErrMaintenance):
+		return ClassMaintenance
+	case errors.Is(err, ErrNotFound):
+		return ClassNotFound
+	case errors.Is(err, ErrHTTPStatus):
+		return ClassHTTPError
+	case errors.Is(err, ErrInvalidJSON):
+		return ClassInvalidJSON
+	default:
+		return ClassNetwork
+	}
+}
+
+// RetryAfter returns the upstream's requested retry delay for a fetch error,
+// or 0 if none was given.
+func RetryAfter(err error) time.Duration {
+	var ue *UpstreamError
+	if errors.As(err, &ue) {
+		return ue.RetryAfter
+	}
+	var te *throttledError
+	if errors.As(err, &te) {
+		return te.wait
+	}
+	return 0
+}
+
+// classifyResponse inspects an upstream response and returns a typed
+// *UpstreamError if it isn't a usable JSON body. header may be nil (relay
+// responses don't carry headers), in which case only status and body are
+// used.
+func classifyResponse(rawURL string, statusCode int, header http.Header, body []byte) error {
+	newErr := func(kind error) error {
+		return &UpstreamError{
+			Kind:       kind,
+			StatusCode: statusCode,
+			RetryAfter: parseRetryAfter(header),
+			URL:        rawURL,
+		}
+	}
+
+	lower := bytes.ToLower(body)
+	isCloudflare := header != nil && strings.EqualFold(header.Get("Server"), "cloudflare")
+
+	// Cloudflare marks challenge responses explicitly; otherwise look for the
+	// challenge page markers (also works for relay responses without headers).
+	if header != nil && strings.EqualFold(header.Get("Cf-Mitigated"), "challenge") {
+		return newErr(ErrCloudflareChallenge)
+	}
+	if looksLikeCloudflareChallenge(lower) {
+		return newErr(ErrCloudflareChallenge)
+	}
+
+	// Cloudflare error 1015 is its rate-limit page.
+	if statusCode == http.StatusTooManyRequests ||
+		bytes.Contains(lower, []byte("you are being rate limited")) ||
+		(isCloudflare && bytes.Contains(lower, []byte("error 1015"))) {
+		return newErr(ErrRateLimited)
+	}
+
+	isHTML := looksLikeHTML(lower)
+	if isHTML && (bytes.Contains(lower, []byte("g-recaptcha")) ||
+		bytes.Contains(lower, []byte("h-captcha")) ||
+		bytes.Contains(lower, []byte("hcaptcha.com")) ||
+		bytes.Contains(lower, []byte("captcha-delivery"))) {
+		return newErr(ErrCaptcha)
+	}
+
+	if statusCode == http.StatusServiceUnavailable ||
+		(isHTML && bytes.Contains(lower, []byte("maintenance"))) {
+		return newErr(ErrMaintenance)
+	}
+
+	if statusCode == http.StatusNotFound {
+		return newErr(ErrNotFound)
+	}
+	if statusCode < 200 || statusCode >= 300 {
+		return newErr(ErrHTTPStatus)
+	}
+
+	if !json.Valid(body) {
+		return newErr(ErrInvalidJSON)
+	}
+
+	return nil
+}
+
+// looksLikeCloudflareChallenge matches the markers of Cloudflare's JS/managed
+// challenge and "Attention Required" block pages.
+func looksLikeCloudflareChallenge(lowerBody []byte) bool {
+	markers := [][]byte{
+		[]byte("/cdn-cgi/challenge-platform/"),
+		[]byte("cf-chl-"),
+		[]byte("cf_chl_"),
+		[]byte("<title>just a moment...</title>"),
+		[]byte("attention required! | cloudflare"),
+	}
+	for _, m := range markers {
+		if bytes.Contains(lowerBody, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// looksLikeHTML reports whether a (lowercased) body is an HTML document.
+func looksLikeHTML(lowerBody []byte) bool {
+	trimmed := bytes.TrimSpace(lowerBody)
+	return bytes.HasPrefix(trimmed, []byte("<!doctype html")) ||
+		bytes.HasPrefix(trimmed, []byte("<html")) ||
+		bytes.Contains(trimmed[:min(len(trimmed), 512)], []byte("<head"))
+}
+
+// parseRetryAfter reads a Retry-After header given either as seconds or as an
+// HTTP date. Returns 0 if absent or unparseable.
+func parseRetryAfter(header http.Header) time.Duration {
+	if header == nil {
+		return 0
+	}
+	v := strings.TrimSpace(header.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,95 @@
+package addon
+
+import (
+	"sync"
+)
+
+// CoalesceStats counts how many upstream fetches were shared between
+// concurrent identical requests.
+type CoalesceStats struct {
+	Requests      int64 `json:"requests"`      // fetchForAddon calls
+	UpstreamCalls int64 `json:"upstreamCalls"` // fetches actually sent upstream
+	Coalesced     int64 `json:"coalesced"`     // requests that joined an in-flight fetch
+}
+
+// inflightFetch is an upstream fetch that other callers can wait on.
+type inflightFetch struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// coalescer lets concurrent requests for the same addon+URL share a single
+// upstream call (singleflight). Results are not cached: once the fetch
+// returns, the next request starts a new one.
+type coalescer struct {
+	mu       sync.Mutex
+	inflight map[string]*inflightFetch
+	total    CoalesceStats
+	perAddon map[string]*CoalesceStats
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{
+		inflight: make(map[string]*inflightFetch),
+		perAddon: make(map[string]*CoalesceStats),
+	}
+}
+
+// do runs fn for addonID+rawURL unless an identical fetch is already in
+// flight, in which case it waits for and returns that fetch's result. The
+// returned slice is shared between callers and must not be modified.
+func (c *coalescer) do(addonID, rawURL string, fn func() ([]byte, error)) ([]byte, error) {
+	key := addonID + "\x00" + rawURL
+
+	c.mu.Lock()
+	stats := c.statsLocked(addonID)
+	c.total.Requests++
+	stats.Requests++
+
+	if f, ok := c.inflight[key]; ok {
+		c.total.Coalesced++
+		stats.Coalesced++
+		c.mu.Unlock()
+		<-f.done
+		return f.data, f.err
+	}
+
+	f := &inflightFetch{done: make(chan struct{})}
+	c.inflight[key] = f
+	c.total.UpstreamCalls++
+	stats.UpstreamCalls++
+	c.mu.Unlock()
+
+	f.data, f.err = fn()
+	close(f.done)
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+
+	return f.data, f.err
+}
+
+// statsLocked returns the counters for an addon, creating them if needed.
+// Caller must hold c.mu.
+func (c *coalescer) statsLocked(addonID string) *CoalesceStats {
+	s, ok := c.perAddon[addonID]
+	if !ok {
+		s = &CoalesceStats{}
+		c.perAddon[addonID] = s
+	}
+	return s
+}
+
+// snapshot returns the global counters and a copy of the per-addon counters.
+func (c *coalescer) snapshot() (CoalesceStats, map[string]CoalesceStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	perAddon := make(map[string]CoalesceStats, len(c.perAddon))
+	for id, s := range c.perAddon {
+		perAddon[id] = *s
+	}
+	return c.total, perAddon
+}
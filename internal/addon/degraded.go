@@ -0,0 +1,139 @@
+package addon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Reasons a stream response is degraded, reported in placeholder streams.
+const (
+	DegradedEngineOffline     = "engine_offline"
+	DegradedRelayDisconnected = "relay_disconnected"
+	DegradedBlocked           = "blocked"
+	DegradedRateLimited       = "rate_limited"
+	DegradedMaintenance       = "maintenance"
+	DegradedUnreachable       = "unreachable"
+)
+
+const (
+	engineCheckTTL     = 10 * time.Second
+	engineCheckTimeout = 2 * time.Second
+)
+
+// engineHealth caches the result of the last engine ping so stream requests
+// don't each wait on an unreachable engine.
+type engineHealth struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+	checking  chan struct{} // closed when the running ping ends, nil if none
+}
+
+// engineReachable pings the engine, reusing a result younger than
+// engineCheckTTL. Concurrent callers share one ping, and the lock isn't held
+// while it runs.
+func (w *Wrapper) engineReachable() error {
+	h := &w.engineHealth
+	h.mu.Lock()
+	if time.Since(h.checkedAt) < engineCheckTTL {
+		err := h.err
+		h.mu.Unlock()
+		return err
+	}
+	if done := h.checking; done != nil {
+		h.mu.Unlock()
+		<-done
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.err
+	}
+	done := make(chan struct{})
+	h.checking = done
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), engineCheckTimeout)
+	err := w.engine.Ping(ctx)
+	cancel()
+
+	h.mu.Lock()
+	h.err = err
+	h.checkedAt = time.Now()
+	h.checking = nil
+	h.mu.Unlock()
+	close(done)
+	return err
+}
+
+// DiagnoseFetchFailure explains a failed upstream fetch from the error
+// classification, the addon's effective fetch method and whether the relay
+// tab is connected: why the addon is degraded (a Degraded* reason) and what
+// to do about it. Placeholder streams and /api/health both use it, so Stremio
+// and the bridge page give the same explanation. It returns "" for failures
+// that just mean "no content" (404).
+func DiagnoseFetchFailure(err error, method string, relayConnected bool) (reason, message string) {
+	if errors.Is(err, ErrNotFound) {
+		return "", ""
+	}
+
+	if method == FetchMethodTabRelay && !relayConnected {
+		return DegradedRelayDisconnected,
+			"The browser relay tab is disconnected. Open the Torrent Bridge page and keep it open while using Stremio."
+	}
+
+	switch Classify(err) {
+	case ClassRateLimited:
+		msg := "The addon is rate limiting this server. Try again in a moment."
+		if ra := RetryAfter(err); ra > 0 {
+			msg = fmt.Sprintf("The addon is rate limiting this server. Try again in %s.", ra.Round(time.Second))
+		}
+		return DegradedRateLimited, msg
+	case ClassCloudflare, ClassCaptcha:
+		if method != FetchMethodDirect {
+			return DegradedBlocked, "The addon is blocking this server (Cloudflare)."
+		}
+		return DegradedBlocked,
+			"The addon is blocking this server (Cloudflare). Switch it to Browser Tab Relay or a Custom Proxy in the Torrent Bridge page."
+	case ClassMaintenance:
+		return DegradedMaintenance, "The addon reports it is under maintenance. Try again later."
+	default:
+		return DegradedUnreachable, "The addon could not be reached from the Torrent Bridge."
+	}
+}
+
+// placeholderStream builds a non-playable stream entry explaining why no
+// streams are shown. It links to the bridge UI, where the problem can be
+// fixed (and the relay tab reconnected).
+func placeholderStream(externalBase, reason, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        "Torrent Bridge",
+		"title":       "⚠ " + degradedTitles[reason] + "\n" + message,
+		"externalUrl": externalBase + "/ui/index.html",
+	}
+}
+
+// engineOfflineStreams replaces the torrent streams of a response, which
+// can't play while the engine is down, with one placeholder. Plain url
+// streams don't go through the engine and are kept.
+func (w *Wrapper) engineOfflineStreams(streams []interface{}, streamHashes []string, externalBase string) []interface{} {
+	msg := fmt.Sprintf("The torrent engine (%s) is not responding, so torrent streams can't play. Check that it is running.", w.engine.Name())
+	out := []interface{}{placeholderStream(externalBase, DegradedEngineOffline, msg)}
+	for i, s := range streams {
+		if streamHashes[i] == "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// degradedTitles are the short headlines of placeholder streams.
+var degradedTitles = map[string]string{
+	DegradedEngineOffline:     "Torrent engine offline",
+	DegradedRelayDisconnected: "Relay disconnected",
+	DegradedBlocked:           "Addon blocked",
+	DegradedRateLimited:       "Rate limited",
+	DegradedMaintenance:       "Addon under maintenance",
+	DegradedUnreachable:       "Addon unreachable",
+}
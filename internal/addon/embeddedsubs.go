@@ -0,0 +1,127 @@
+package addon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/engine"
+	"github.com/krizcold/stremio-torrent-bridge/internal/matroska"
+	"github.com/krizcold/stremio-torrent-bridge/internal/subtitles"
+)
+
+const (
+	// embeddedListTimeout bounds reading a video's header to list its
+	// subtitle tracks while answering a subtitles request.
+	embeddedListTimeout = 10 * time.Second
+	// embeddedExtractTimeout bounds extracting one track. Without a cue
+	// index for the track up to the first 64 MB of clusters are read.
+	embeddedExtractTimeout = 3 * time.Minute
+	// maxEmbeddedTrackLists bounds the in-memory cache of track lists.
+	maxEmbeddedTrackLists = 100
+)
+
+// matroskaExtensions are the video files probed for embedded subtitles.
+var matroskaExtensions = map[string]bool{".mkv": true, ".webm": true}
+
+// embeddedSubtitles returns the text subtitle tracks of a Matroska video,
+// reading its header through the engine on first use. Failures (such as a
+// header not downloaded in time) return nothing and are retried on the next
+// request.
+func (w *Wrapper) embeddedSubtitles(infoHash string, video *engine.TorrentFile) []*matroska.Track {
+	if !matroskaExtensions[strings.ToLower(path.Ext(video.Path))] || video.Size <= 0 {
+		return nil
+	}
+
+	key := infoHash + "/" + strconv.Itoa(video.Index)
+	if tracks, ok := w.embedded.Get(key); ok {
+		return tracks
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), embeddedListTimeout)
+	defer cancel()
+
+	f, err := matroska.Open(engine.NewFileReader(ctx, w.engine, infoHash, video.Index, video.Size), video.Size)
+	if err != nil {
+		fmt.Printf("wrapper: subtitles: read %s file %d: %v\n", infoHash, video.Index, err)
+		if errors.Is(err, matroska.ErrNotMatroska) {
+			w.embedded.Put(key, nil)
+		}
+		return nil
+	}
+
+	tracks := f.SubtitleTracks()
+	w.embedded.Put(key, tracks)
+	return tracks
+}
+
+// HandleEmbeddedSubtitle serves a text subtitle track of a Matroska video as
+// WebVTT. The track is extracted through the engine on first request, then
+// kept in memory; concurrent first requests share one extraction.
+//
+// Route: GET /subtitles/:infoHash/:fileIdx/:track.vtt
+func (w *Wrapper) HandleEmbeddedSubtitle(c *fiber.Ctx) {
+	infoHash := strings.ToLower(param(c, "infoHash"))
+	fileIdx, err1 := strconv.Atoi(param(c, "fileIdx"))
+	track, err2 := strconv.ParseUint(param(c, "track"), 10, 64)
+	if infoHash == "" || err1 != nil || err2 != nil {
+		c.Status(http.StatusBadRequest)
+		c.Set("Content-Type", "application/json")
+		c.SendString(`{"error":"invalid subtitle path"}`)
+		return
+	}
+
+	cacheKey := fmt.Sprintf("%s/%d/%d", infoHash, fileIdx, track)
+	vtt, ok := w.subs.Get(cacheKey)
+	if !ok {
+		var err error
+		vtt, err = w.extractions.do(infoHash, cacheKey, func() ([]byte, error) {
+			vtt, err := w.extractSubtitle(infoHash, fileIdx, track)
+			if err == nil {
+				w.subs.Put(cacheKey, vtt)
+			}
+			return vtt, err
+		})
+		if err != nil {
+			fmt.Printf("wrapper: subtitle %s file %d track %d: %v\n", infoHash, fileIdx, track, err)
+			c.Status(http.StatusBadGateway)
+			c.Set("Content-Type", "application/json")
+			errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+			c.Send(errJSON)
+			return
+		}
+	}
+
+	c.Set("Content-Type", "text/vtt; charset=utf-8")
+	c.Send(vtt)
+}
+
+// extractSubtitle reads one subtitle track of a Matroska video through the
+// engine and renders it as WebVTT.
+func (w *Wrapper) extractSubtitle(infoHash string, fileIdx int, track uint64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), embeddedExtractTimeout)
+	defer cancel()
+
+	file, err := engine.FindFile(ctx, w.engine, infoHash, fileIdx)
+	if err != nil {
+		return nil, fmt.Errorf("look up file: %w", err)
+	}
+
+	f, err := matroska.Open(engine.NewFileReader(ctx, w.engine, infoHash, fileIdx, file.Size), file.Size)
+	if err != nil {
+		return nil, err
+	}
+	cues, err := f.ExtractSubtitles(track)
+	if err != nil {
+		return nil, err
+	}
+	return subtitles.WriteVTT(cues), nil
+}
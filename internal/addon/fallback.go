@@ -0,0 +1,232 @@
+package addon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krizcold/stremio-torrent-bridge/pkg/httpclient"
+)
+
+// MethodOutcome summarises how a single fetch method has performed for an
+// addon since the bridge started.
+type MethodOutcome struct {
+	Successes   int        `json:"successes"`
+	Failures    int        `json:"failures"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastFailure *time.Time `json:"lastFailure,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastKind    string     `json:"lastErrorKind,omitempty"` // Classification of the last failure
+}
+
+// fetchTracker records per-addon, per-method fetch outcomes in memory.
+type fetchTracker struct {
+	mu       sync.Mutex
+	outcomes map[string]map[string]*MethodOutcome // addonID -> method -> outcome
+}
+
+func newFetchTracker() *fetchTracker {
+	return &fetchTracker{outcomes: make(map[string]map[string]*MethodOutcome)}
+}
+
+// record updates the outcome counters for one fetch attempt.
+func (t *fetchTracker) record(addonID, method string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	byMethod, ok := t.outcomes[addonID]
+	if !ok {
+		byMethod = make(map[string]*MethodOutcome)
+		t.outcomes[addonID] = byMethod
+	}
+	o, ok := byMethod[method]
+	if !ok {
+		o = &MethodOutcome{}
+		byMethod[method] = o
+	}
+
+	now := time.Now()
+	if err == nil {
+		o.Successes++
+		o.LastSuccess = &now
+		return
+	}
+	o.Failures++
+	o.LastFailure = &now
+	o.LastError = err.Error()
+	o.LastKind = Classify(err)
+}
+
+// snapshot returns a copy of the outcomes for an addon.
+func (t *fetchTracker) snapshot(addonID string) map[string]MethodOutcome {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make(map[string]MethodOutcome, len(t.outcomes[addonID]))
+	for method, o := range t.outcomes[addonID] {
+		result[method] = *o
+	}
+	return result
+}
+
+// FetchOutcomes returns the per-method fetch outcomes recorded for an addon.
+func (w *Wrapper) FetchOutcomes(addonID string) map[string]MethodOutcome {
+	return w.fetches.snapshot(addonID)
+}
+
+// fetchChain returns the ordered list of methods to try for an addon: the
+// last method that worked (or the configured method if none has yet),
+// followed by the remaining available methods in FetchChainOrder.
+func (w *Wrapper) fetchChain(addonID string) []string {
+	preferred := w.resolveEffectiveMethod(addonID)
+	if addon, found := w.store.Get(addonID); found && addon.LastSuccessMethod != "" {
+		preferred = addon.LastSuccessMethod
+	}
+
+	chain := []string{preferred}
+	for _, method := range FetchChainOrder {
+		if method != preferred && w.methodAvailable(addonID, method) {
+			chain = append(chain, method)
+		}
+	}
+	return chain
+}
+
+// methodAvailable reports whether a fallback method can be attempted right
+// now, so the chain doesn't waste time on a missing proxy or absent relay tab.
+func (w *Wrapper) methodAvailable(addonID, method string) bool {
+	switch method {
+	case FetchMethodDirect:
+		return true
+	case FetchMethodProxy:
+		return w.proxyURLFor(addonID) != ""
+	case FetchMethodTabRelay:
+		return w.relay != nil && w.relay.Connected()
+	default:
+		return false
+	}
+}
+
+// fetchWithMethod performs a single fetch using one specific method, subject
+// to the per-host rate limit for that egress path.
+func (w *Wrapper) fetchWithMethod(addonID, method, rawURL string) ([]byte, error) {
+	key := limiterKey(w.egressFor(addonID, method), rawURL)
+	if err := w.limiter.acquire(key, w.rateLimitFor(addonID)); err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	var err error
+	switch method {
+	case FetchMethodTabRelay:
+		data, err = w.fetchViaRelay(rawURL)
+	case FetchMethodProxy:
+		data, err = w.fetchViaProxy(addonID, rawURL)
+	default:
+		data, err = w.fetchJSON(w.directClientFor(addonID), rawURL)
+	}
+
+	w.limiter.report(key, err)
+	return data, err
+}
+
+// egressFor names the network path a method uses, so rate limits and backoff
+// are tracked separately for the server IP, each proxy, and the relay tab.
+func (w *Wrapper) egressFor(addonID, method string) string {
+	if method != FetchMethodProxy {
+		return method
+	}
+	if u, err := httpclient.ParseProxyURL(w.proxyURLFor(addonID)); err == nil {
+		return "proxy(" + u.Host + ")"
+	}
+	return method
+}
+
+// rateLimitFor returns the upstream rate limit for an addon in requests per
+// minute: its own override, or the global default.
+func (w *Wrapper) rateLimitFor(addonID string) int {
+	if addon, found := w.store.Get(addonID); found && addon.RateLimit > 0 {
+		return addon.RateLimit
+	}
+	return w.config.UpstreamRatePerMinute
+}
+
+// RateLimitStats returns the limiter state for every upstream host.
+func (w *Wrapper) RateLimitStats() map[string]HostLimitState {
+	return w.limiter.snapshot()
+}
+
+// fetchWithFallback walks the addon's fetch chain until one method succeeds.
+// Every attempt is recorded, and the addon's FetchStatus flips to ok or
+// blocked based on the overall result.
+func (w *Wrapper) fetchWithFallback(addonID, rawURL string) ([]byte, error) {
+	chain := w.fetchChain(addonID)
+
+	chainErr := &fetchChainError{}
+	for _, method := range chain {
+		data, err := w.fetchWithMethod(addonID, method, rawURL)
+		w.fetches.record(addonID, method, err)
+		if err == nil {
+			if len(chainErr.errs) > 0 {
+				fmt.Printf("wrapper: %s fell back to %s after: %v\n", addonID, method, chainErr)
+			}
+			w.recordFetchResult(addonID, true, method)
+			return data, nil
+		}
+		// A 404 means the addon answered and simply has nothing for this
+		// request; another method would get the same answer.
+		if errors.Is(err, ErrNotFound) {
+			w.recordFetchResult(addonID, true, method)
+			return nil, err
+		}
+		chainErr.methods = append(chainErr.methods, method)
+		chainErr.errs = append(chainErr.errs, err)
+	}
+
+	// Being throttled says nothing about whether the addon is reachable, so
+	// only flip to blocked when something other than rate limiting failed.
+	if !chainErr.onlyRateLimited() {
+		w.recordFetchResult(addonID, false, "")
+	}
+	return nil, chainErr
+}
+
+// fetchChainError collects the failure of every method in a fetch chain. It
+// unwraps to all of them, so errors.Is(err, ErrRateLimited) and friends work
+// on the aggregate.
+type fetchChainError struct {
+	methods []string
+	errs    []error
+}
+
+func (e *fetchChainError) Error() string {
+	parts := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		parts[i] = e.methods[i] + ": " + err.Error()
+	}
+	return "all fetch methods failed (" + strings.Join(parts, "; ") + ")"
+}
+
+func (e *fetchChainError) Unwrap() []error { return e.errs }
+
+// onlyRateLimited reports whether every method failed due to rate limiting.
+func (e *fetchChainError) onlyRateLimited() bool {
+	for _, err := range e.errs {
+		if !errors.Is(err, ErrRateLimited) {
+			return false
+		}
+	}
+	return len(e.errs) > 0
+}
+
+// recordFetchResult persists the addon's fetch status, logging on failure.
+func (w *Wrapper) recordFetchResult(addonID string, ok bool, method string) {
+	if _, found := w.store.Get(addonID); !found {
+		return
+	}
+	if err := w.store.RecordFetchResult(addonID, ok, method); err != nil {
+		fmt.Printf("wrapper: record fetch result for %s: %v\n", addonID, err)
+	}
+}
@@ -0,0 +1,185 @@
+package addon
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/engine"
+)
+
+// instantBadge prefixes the title of streams whose torrent is already in the
+// engine.
+const instantBadge = "⚡"
+
+const (
+	// engineSnapshotTTL is how long the engine's torrent list is reused
+	// across stream requests.
+	engineSnapshotTTL = 5 * time.Second
+	// engineSnapshotMaxAge is how old a list may be to still be used when a
+	// refresh doesn't finish within INSTANT_CHECK_TIMEOUT_MS.
+	engineSnapshotMaxAge = 2 * time.Minute
+	// engineSnapshotRefreshTimeout bounds one refresh. It runs in the
+	// background, so an engine slower than the stream deadline (qBittorrent
+	// lists each torrent's files separately) still fills the list for the
+	// next requests.
+	engineSnapshotRefreshTimeout = 30 * time.Second
+)
+
+// engineSnapshot caches the engine's torrent list so stream requests share
+// one ListTorrents call instead of each making their own.
+type engineSnapshot struct {
+	mu         sync.Mutex
+	torrents   []engine.TorrentInfo
+	fetchedAt  time.Time     // zero until the first successful refresh
+	refreshing chan struct{} // closed when the running refresh ends, nil if none
+}
+
+// engineTorrents returns the engine's view of every torrent in hashes that it
+// holds, keyed by lowercase infoHash. The list is refreshed at most every
+// engineSnapshotTTL, and stream responses wait for a refresh no longer than
+// INSTANT_CHECK_TIMEOUT_MS before falling back to the previous list, so a
+// slow engine never delays them. Without any usable list nothing is
+// reported.
+func (w *Wrapper) engineTorrents(hashes []string) map[string]*engine.TorrentInfo {
+	timeout := time.Duration(w.config.InstantCheckTimeoutMs) * time.Millisecond
+	torrents, ok := w.engineList.get(w.engine, timeout)
+	if !ok {
+		return nil
+	}
+
+	wanted := make(map[string]bool, len(hashes))
+	for _, h := range hashes {
+		if h != "" {
+			wanted[h] = true
+		}
+	}
+
+	held := make(map[string]*engine.TorrentInfo)
+	for i := range torrents {
+		hash := strings.ToLower(torrents[i].InfoHash)
+		if wanted[hash] {
+			held[hash] = &torrents[i]
+		}
+	}
+	return held
+}
+
+// get returns the cached torrent list, refreshing it first when older than
+// engineSnapshotTTL. It waits up to timeout for the refresh, then settles for
+// a list younger than engineSnapshotMaxAge. The returned slice is shared and
+// must not be modified.
+func (s *engineSnapshot) get(eng engine.Engine, timeout time.Duration) ([]engine.TorrentInfo, bool) {
+	s.mu.Lock()
+	if !s.fetchedAt.IsZero() && time.Since(s.fetchedAt) < engineSnapshotTTL {
+		torrents := s.torrents
+		s.mu.Unlock()
+		return torrents, true
+	}
+	if s.refreshing == nil {
+		s.refreshing = make(chan struct{})
+		go s.refresh(eng, s.refreshing)
+	}
+	done := s.refreshing
+	s.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fetchedAt.IsZero() || time.Since(s.fetchedAt) >= engineSnapshotMaxAge {
+		return nil, false
+	}
+	return s.torrents, true
+}
+
+// refresh lists the engine's torrents and closes done when finished.
+func (s *engineSnapshot) refresh(eng engine.Engine, done chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), engineSnapshotRefreshTimeout)
+	defer cancel()
+	torrents, err := eng.ListTorrents(ctx)
+
+	s.mu.Lock()
+	if err != nil {
+		fmt.Printf("wrapper: engine torrent check skipped: %v\n", err)
+	} else {
+		s.torrents = torrents
+		s.fetchedAt = time.Now()
+	}
+	s.refreshing = nil
+	s.mu.Unlock()
+	close(done)
+}
+
+// torrentProgress returns the download progress (0..1) of every torrent the
+// engine holds with data. Torrents known only by metadata (e.g. preloaded)
+// are left out.
+func torrentProgress(torrents map[string]*engine.TorrentInfo) map[string]float64 {
+	progress := make(map[string]float64)
+	for hash, t := range torrents {
+		if t.Completed <= 0 || t.TotalSize <= 0 {
+			continue
+		}
+		p := float64(t.Completed) / float64(t.TotalSize)
+		if p > 1 {
+			p = 1
+		}
+		progress[hash] = p
+	}
+	return progress
+}
+
+// markInstant badges the streams whose torrent has data in the engine, per
+// torrentProgress, and with INSTANT_SORT_FIRST moves them ahead of the others
+// (most complete first, otherwise keeping the addon's order). streamHashes
+// holds the infoHash of each stream by index, empty for non-torrent streams.
+func (w *Wrapper) markInstant(streams []interface{}, streamHashes []string, progress map[string]float64) []interface{} {
+	type ranked struct {
+		stream   interface{}
+		progress float64 // -1 when not in the engine
+	}
+	rankedStreams := make([]ranked, len(streams))
+	for i, raw := range streams {
+		rankedStreams[i] = ranked{stream: raw, progress: -1}
+
+		p, ok := progress[streamHashes[i]]
+		if !ok {
+			continue
+		}
+		rankedStreams[i].progress = p
+
+		item, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		badge := instantBadge + " Cached"
+		if p < 1 {
+			badge = fmt.Sprintf("%s %d%% cached", instantBadge, int(p*100))
+		}
+		if title, ok := item["title"].(string); ok {
+			item["title"] = badge + "\n" + title
+		} else if desc, ok := item["description"].(string); ok {
+			item["description"] = badge + "\n" + desc
+		}
+	}
+
+	if w.config.InstantSortFirst {
+		sort.SliceStable(rankedStreams, func(i, j int) bool {
+			return rankedStreams[i].progress > rankedStreams[j].progress
+		})
+	}
+
+	out := make([]interface{}, len(rankedStreams))
+	for i, r := range rankedStreams {
+		out[i] = r.stream
+	}
+	return out
+}
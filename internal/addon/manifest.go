@@ -0,0 +1,145 @@
+package addon
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// semverPattern loosely matches the semantic version Stremio expects in
+// manifest.version (e.g. "1.2.3", "0.0.1-beta").
+var semverPattern = regexp.MustCompile(`^\d+\.\d+\.\d+([-+].*)?$`)
+
+// ManifestReport summarises an upstream manifest after validation.
+type ManifestReport struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Version    string   `json:"version"`
+	Resources  []string `json:"resources"`
+	Types      []string `json:"types"`
+	IDPrefixes []string `json:"idPrefixes,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+// ManifestError is returned by LintManifest when a manifest can't be wrapped.
+// Problems lists every reason, so the user can fix them all at once.
+type ManifestError struct {
+	Problems []string
+}
+
+func (e *ManifestError) Error() string {
+	return "invalid addon manifest: " + strings.Join(e.Problems, "; ")
+}
+
+// manifestResource is the object form of a manifest "resources" entry.
+type manifestResource struct {
+	Name       string   `json:"name"`
+	Types      []string `json:"types"`
+	IDPrefixes []string `json:"idPrefixes"`
+}
+
+// rawManifest holds the manifest fields we validate.
+type rawManifest struct {
+	ID            string                 `json:"id"`
+	Name          string                 `json:"name"`
+	Version       string                 `json:"version"`
+	Resources     []json.RawMessage      `json:"resources"`
+	Types         []string               `json:"types"`
+	IDPrefixes    []string               `json:"idPrefixes"`
+	Catalogs      json.RawMessage        `json:"catalogs"`
+	BehaviorHints map[string]interface{} `json:"behaviorHints"`
+}
+
+// LintManifest validates an upstream manifest against the Stremio manifest
+// schema (id, name, version, resources, types, idPrefixes) and checks that it
+// serves streams, which the bridge needs in order to be useful. Malformed or
+// stream-less manifests return a *ManifestError; softer issues are reported
+// as warnings on the returned report.
+func LintManifest(data []byte) (*ManifestReport, error) {
+	var m rawManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, &ManifestError{Problems: []string{fmt.Sprintf("not a JSON manifest: %v", err)}}
+	}
+
+	report := &ManifestReport{
+		ID:         m.ID,
+		Name:       m.Name,
+		Version:    m.Version,
+		Types:      m.Types,
+		IDPrefixes: m.IDPrefixes,
+	}
+	var problems []string
+
+	if strings.TrimSpace(m.ID) == "" {
+		problems = append(problems, "missing id")
+	}
+	if strings.TrimSpace(m.Name) == "" {
+		problems = append(problems, "missing name")
+	}
+	if m.Version == "" {
+		problems = append(problems, "missing version")
+	} else if !semverPattern.MatchString(m.Version) {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("version %q is not semantic versioning", m.Version))
+	}
+	if len(m.Types) == 0 {
+		problems = append(problems, "types must list at least one content type")
+	}
+
+	// Resources can be plain names or objects with their own types/idPrefixes.
+	streamResource := false
+	streamHasPrefixes := len(m.IDPrefixes) > 0
+	for _, raw := range m.Resources {
+		var name string
+		if err := json.Unmarshal(raw, &name); err == nil {
+			report.Resources = append(report.Resources, name)
+			streamResource = streamResource || name == "stream"
+			continue
+		}
+		var res manifestResource
+		if err := json.Unmarshal(raw, &res); err != nil || res.Name == "" {
+			problems = append(problems, "resources contains an entry that is neither a name nor an object with a name")
+			continue
+		}
+		report.Resources = append(report.Resources, res.Name)
+		if res.Name == "stream" {
+			streamResource = true
+			streamHasPrefixes = streamHasPrefixes || len(res.IDPrefixes) > 0
+		}
+	}
+	if len(m.Resources) == 0 {
+		problems = append(problems, "resources must list at least one resource")
+	} else if !streamResource {
+		problems = append(problems, "addon does not provide the stream resource, so there are no torrents to bridge")
+	}
+
+	if len(m.Catalogs) == 0 || string(m.Catalogs) == "null" {
+		report.Warnings = append(report.Warnings, "catalogs is missing (Stremio expects an array, even if empty)")
+	}
+	if streamResource && !streamHasPrefixes {
+		report.Warnings = append(report.Warnings, "no idPrefixes declared; Stremio will ask this addon for streams of every title")
+	}
+	if !containsAny(m.Types, "movie", "series", "anime") {
+		report.Warnings = append(report.Warnings, "types include neither movie nor series; streams may never be requested")
+	}
+	if required, _ := m.BehaviorHints["configurationRequired"].(bool); required {
+		report.Warnings = append(report.Warnings, "addon requires configuration; make sure you added its configured manifest URL")
+	}
+
+	if len(problems) > 0 {
+		return report, &ManifestError{Problems: problems}
+	}
+	return report, nil
+}
+
+// containsAny reports whether list contains any of the given values.
+func containsAny(list []string, values ...string) bool {
+	for _, item := range list {
+		for _, v := range values {
+			if item == v {
+				return true
+			}
+		}
+	}
+	return false
+}
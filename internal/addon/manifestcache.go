@@ -0,0 +1,169 @@
+package addon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// manifestSaveInterval is how often an unchanged manifest's fetch time is
+// persisted. The content is saved as soon as it changes; only FetchedAt,
+// shown as the cache age after a restart, may lag by up to this long.
+const manifestSaveInterval = 10 * time.Minute
+
+// cachedManifest is a last-known-good upstream manifest and when it was
+// fetched.
+type cachedManifest struct {
+	Data      json.RawMessage `json:"data"`
+	FetchedAt time.Time       `json:"fetchedAt"`
+}
+
+// manifestCache keeps the last successfully fetched upstream manifest per wrapped
+// addon and persists it to disk, so Cloudflare-blocked addons keep serving a
+// manifest after a restart even before the relay tab reconnects.
+type manifestCache struct {
+	mu       sync.RWMutex
+	entries  map[string]*cachedManifest // wrapID -> manifest
+	filePath string
+	savedAt  time.Time  // last save started; guarded by mu
+	saveMu   sync.Mutex // serializes background saves
+}
+
+// newManifestCache creates a manifest cache persisted under dataDir and loads
+// any previously saved manifests.
+func newManifestCache(dataDir string) *manifestCache {
+	mc := &manifestCache{
+		entries:  make(map[string]*cachedManifest),
+		filePath: dataDir + "/manifest_cache.json",
+	}
+
+	if err := mc.load(); err != nil {
+		fmt.Printf("wrapper: failed to load manifest cache: %v (starting fresh)\n", err)
+	} else if len(mc.entries) > 0 {
+		fmt.Printf("wrapper: loaded %d cached manifests from %s\n", len(mc.entries), mc.filePath)
+	}
+
+	return mc
+}
+
+// get returns the cached manifest for an addon, or nil if none is cached.
+func (mc *manifestCache) get(wrapID string) *cachedManifest {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	return mc.entries[wrapID]
+}
+
+// put stores a freshly fetched manifest. Disk persistence happens when the
+// manifest content changed, or at most every manifestSaveInterval to keep
+// the fetch times current, so repeated manifest requests don't rewrite the
+// file every time.
+func (mc *manifestCache) put(wrapID string, data []byte) {
+	now := time.Now()
+	mc.mu.Lock()
+	prev := mc.entries[wrapID]
+	changed := prev == nil || !bytes.Equal(prev.Data, data)
+	mc.entries[wrapID] = &cachedManifest{Data: data, FetchedAt: now}
+	persist := changed || now.Sub(mc.savedAt) >= manifestSaveInterval
+	if persist {
+		mc.savedAt = now
+	}
+	mc.mu.Unlock()
+
+	if persist {
+		mc.saveInBackground()
+	}
+}
+
+// remove drops the cached manifest of an addon that is no longer wrapped.
+func (mc *manifestCache) remove(wrapID string) {
+	mc.mu.Lock()
+	_, ok := mc.entries[wrapID]
+	delete(mc.entries, wrapID)
+	mc.mu.Unlock()
+
+	if ok {
+		mc.saveInBackground()
+	}
+}
+
+// retain drops the cached manifests of every addon keep rejects, such as
+// addons removed while the bridge was not running.
+func (mc *manifestCache) retain(keep func(wrapID string) bool) {
+	mc.mu.Lock()
+	removed := 0
+	for id := range mc.entries {
+		if !keep(id) {
+			delete(mc.entries, id)
+			removed++
+		}
+	}
+	mc.mu.Unlock()
+
+	if removed > 0 {
+		fmt.Printf("wrapper: dropped %d cached manifests of removed addons\n", removed)
+		mc.saveInBackground()
+	}
+}
+
+// saveInBackground persists the cache without blocking the caller.
+func (mc *manifestCache) saveInBackground() {
+	go func() {
+		if err := mc.save(); err != nil {
+			fmt.Printf("wrapper: failed to save manifest cache: %v\n", err)
+		}
+	}()
+}
+
+// load reads the persisted manifests from disk. Returns nil if the file does
+// not exist (a fresh start is fine).
+func (mc *manifestCache) load() error {
+	data, err := os.ReadFile(mc.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read %s: %w", mc.filePath, err)
+	}
+
+	var entries map[string]*cachedManifest
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("parse %s: %w", mc.filePath, err)
+	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	for id, e := range entries {
+		if e != nil && len(e.Data) > 0 {
+			mc.entries[id] = e
+		}
+	}
+
+	return nil
+}
+
+// save writes all cached manifests to disk as JSON, replacing the file
+// atomically.
+func (mc *manifestCache) save() error {
+	mc.saveMu.Lock()
+	defer mc.saveMu.Unlock()
+
+	mc.mu.RLock()
+	data, err := json.Marshal(mc.entries)
+	mc.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	tmp := mc.filePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, mc.filePath); err != nil {
+		return fmt.Errorf("replace %s: %w", mc.filePath, err)
+	}
+
+	return nil
+}
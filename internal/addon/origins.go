@@ -0,0 +1,217 @@
+package addon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxStreamOrigins bounds the origin registry. Every torrent listed in a
+// stream response is recorded, so without a limit it would grow with every
+// title browsed. Torrents the cache still holds are never pruned.
+const maxStreamOrigins = 5000
+
+// originSaveDelay batches the saves of stream responses arriving close
+// together (a title's addons are queried at once) into one write.
+const originSaveDelay = 5 * time.Second
+
+// StreamOrigin records where a torrent stream was found: the wrapped addon
+// and the Stremio item the streams were requested for.
+type StreamOrigin struct {
+	InfoHash   string    `json:"infoHash"`
+	AddonID    string    `json:"addonId"`
+	Type       string    `json:"type"`   // "movie", "series", ...
+	ItemID     string    `json:"itemId"` // as requested, e.g. "tt0944947:1:2"
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// originRegistry maps infoHashes to the stream request they were listed in,
+// so the bridge can later show cached torrents as Stremio items. It is
+// persisted to DATA_DIR/stream_origins.json.
+type originRegistry struct {
+	mu       sync.RWMutex
+	entries  map[string]*StreamOrigin // infoHash -> origin
+	filePath string
+	keep     func(infoHash string) bool // entries never pruned; may be nil
+	saveMu   sync.Mutex                 // serializes background saves
+	pending  *time.Timer                // scheduled save, if any; guarded by mu
+}
+
+// newOriginRegistry creates an origin registry persisted under dataDir and
+// loads any previously saved origins.
+func newOriginRegistry(dataDir string, keep func(string) bool) *originRegistry {
+	r := &originRegistry{
+		entries:  make(map[string]*StreamOrigin),
+		filePath: dataDir + "/stream_origins.json",
+		keep:     keep,
+	}
+
+	if err := r.load(); err != nil {
+		fmt.Printf("wrapper: failed to load stream origins: %v (starting fresh)\n", err)
+	}
+
+	return r
+}
+
+// record stores the origin of every infoHash listed in one stream response
+// and schedules a save, batching the responses of the next originSaveDelay.
+func (r *originRegistry) record(addonID, contentType, itemID string, infoHashes []string) {
+	if len(infoHashes) == 0 {
+		return
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	for _, hash := range infoHashes {
+		r.entries[hash] = &StreamOrigin{
+			InfoHash:   hash,
+			AddonID:    addonID,
+			Type:       contentType,
+			ItemID:     itemID,
+			RecordedAt: now,
+		}
+	}
+	r.pruneLocked()
+	if r.pending == nil {
+		r.pending = time.AfterFunc(originSaveDelay, r.savePending)
+	}
+	r.mu.Unlock()
+}
+
+// savePending runs the scheduled save. Origins recorded while it writes
+// schedule the next one.
+func (r *originRegistry) savePending() {
+	r.mu.Lock()
+	r.pending = nil
+	r.mu.Unlock()
+
+	if err := r.save(); err != nil {
+		fmt.Printf("wrapper: failed to save stream origins: %v\n", err)
+	}
+}
+
+// get returns the recorded origin of a torrent, or nil if none is known.
+func (r *originRegistry) get(infoHash string) *StreamOrigin {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.entries[infoHash]
+}
+
+// StreamOrigins returns every recorded stream origin, for backups.
+func (w *Wrapper) StreamOrigins() []StreamOrigin {
+	w.origins.mu.RLock()
+	defer w.origins.mu.RUnlock()
+
+	out := make([]StreamOrigin, 0, len(w.origins.entries))
+	for _, e := range w.origins.entries {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].InfoHash < out[j].InfoHash })
+	return out
+}
+
+// ReplaceStreamOrigins replaces the origin registry, as when restoring a
+// backup. If the new registry cannot be saved the previous one is kept.
+func (w *Wrapper) ReplaceStreamOrigins(origins []StreamOrigin) error {
+	r := w.origins
+	next := make(map[string]*StreamOrigin, len(origins))
+	for i := range origins {
+		e := origins[i]
+		next[e.InfoHash] = &e
+	}
+
+	r.mu.Lock()
+	prev := r.entries
+	r.entries = next
+	r.mu.Unlock()
+
+	if err := r.save(); err != nil {
+		r.mu.Lock()
+		r.entries = prev
+		r.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// pruneLocked drops the oldest entries above maxStreamOrigins, skipping
+// torrents the keep function still wants. Caller must hold the write lock.
+func (r *originRegistry) pruneLocked() {
+	excess := len(r.entries) - maxStreamOrigins
+	if excess <= 0 {
+		return
+	}
+
+	candidates := make([]*StreamOrigin, 0, len(r.entries))
+	for _, e := range r.entries {
+		if r.keep == nil || !r.keep(e.InfoHash) {
+			candidates = append(candidates, e)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].RecordedAt.Before(candidates[j].RecordedAt)
+	})
+
+	for i := 0; i < excess && i < len(candidates); i++ {
+		delete(r.entries, candidates[i].InfoHash)
+	}
+}
+
+// load reads the persisted origins from disk. Returns nil if the file does
+// not exist (a fresh start is fine).
+func (r *originRegistry) load() error {
+	data, err := os.ReadFile(r.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read %s: %w", r.filePath, err)
+	}
+
+	var entries []*StreamOrigin
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("parse %s: %w", r.filePath, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range entries {
+		if e != nil && e.InfoHash != "" {
+			r.entries[e.InfoHash] = e
+		}
+	}
+
+	return nil
+}
+
+// save writes the registry to disk, replacing the file atomically.
+func (r *originRegistry) save() error {
+	r.saveMu.Lock()
+	defer r.saveMu.Unlock()
+
+	r.mu.RLock()
+	entries := make([]*StreamOrigin, 0, len(r.entries))
+	for _, e := range r.entries {
+		entries = append(entries, e)
+	}
+	r.mu.RUnlock()
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	tmp := r.filePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, r.filePath); err != nil {
+		return fmt.Errorf("replace %s: %w", r.filePath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,262 @@
+package addon
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Prefixes added to the id and name of every wrapped manifest.
+const (
+	bridgeIDPrefix   = "com.yundera.bridge."
+	bridgeNamePrefix = "[Torrent-Bridge] "
+)
+
+// NormalizeOverrides trims and validates user-supplied manifest overrides.
+// It returns nil when nothing is overridden, so the addon falls back to the
+// default presentation.
+func NormalizeOverrides(o *ManifestOverrides) (*ManifestOverrides, error) {
+	if o == nil {
+		return nil, nil
+	}
+
+	n := &ManifestOverrides{
+		Name:              strings.TrimSpace(o.Name),
+		Logo:              strings.TrimSpace(o.Logo),
+		HiddenTypes:       cleanList(o.HiddenTypes),
+		HiddenCatalogs:    cleanList(o.HiddenCatalogs),
+		KeepBehaviorHints: cleanList(o.KeepBehaviorHints),
+		IDPrefixes:        cleanList(o.IDPrefixes),
+	}
+
+	if n.Logo != "" {
+		u, err := url.Parse(n.Logo)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, errors.New("logo must be an http(s) URL")
+		}
+	}
+
+	if n.Name == "" && n.Logo == "" && len(n.HiddenTypes) == 0 && len(n.HiddenCatalogs) == 0 &&
+		len(n.KeepBehaviorHints) == 0 && len(n.IDPrefixes) == 0 {
+		return nil, nil
+	}
+	return n, nil
+}
+
+// RebrandManifest prefixes a manifest's id and name so it's clear it goes
+// through the bridge, then applies overrides (which may be nil). Manifests
+// that are already prefixed (e.g. cached by older versions) aren't prefixed
+// twice. Returns the upstream name without the bridge prefix.
+func RebrandManifest(manifest map[string]interface{}, o *ManifestOverrides) string {
+	originalName := ""
+	if name, ok := manifest["name"].(string); ok {
+		originalName = strings.TrimPrefix(name, bridgeNamePrefix)
+	}
+
+	if origID, ok := manifest["id"].(string); ok && !strings.HasPrefix(origID, bridgeIDPrefix) {
+		manifest["id"] = bridgeIDPrefix + origID
+	}
+	if originalName != "" {
+		manifest["name"] = bridgeNamePrefix + originalName
+	}
+
+	applyManifestOverrides(manifest, o)
+	return originalName
+}
+
+// applyManifestOverrides customises a rebranded manifest in place. Without
+// overrides it only strips behaviorHints, so Stremio doesn't prompt for
+// configuration.
+func applyManifestOverrides(manifest map[string]interface{}, o *ManifestOverrides) {
+	hints, _ := manifest["behaviorHints"].(map[string]interface{})
+	delete(manifest, "behaviorHints")
+	if o == nil {
+		return
+	}
+
+	if o.Name != "" {
+		manifest["name"] = o.Name
+	}
+	if o.Logo != "" {
+		manifest["logo"] = o.Logo
+	}
+
+	kept := make(map[string]interface{})
+	for _, key := range o.KeepBehaviorHints {
+		if v, ok := hints[key]; ok {
+			kept[key] = v
+		}
+	}
+	if len(kept) > 0 {
+		manifest["behaviorHints"] = kept
+	}
+
+	if types, ok := manifest["types"].([]interface{}); ok {
+		manifest["types"] = filterValues(types, func(v interface{}) bool {
+			t, _ := v.(string)
+			return !o.hidesType(t)
+		})
+	}
+
+	if catalogs, ok := manifest["catalogs"].([]interface{}); ok {
+		manifest["catalogs"] = filterValues(catalogs, func(v interface{}) bool {
+			cat, _ := v.(map[string]interface{})
+			t, _ := cat["type"].(string)
+			id, _ := cat["id"].(string)
+			return !o.hidesType(t) && !o.hidesCatalog(t, id)
+		})
+	}
+
+	// Object-form resources carry their own types and idPrefixes.
+	if resources, ok := manifest["resources"].([]interface{}); ok {
+		manifest["resources"] = filterValues(resources, func(v interface{}) bool {
+			res, ok := v.(map[string]interface{})
+			if !ok {
+				return true
+			}
+			if types, ok := res["types"].([]interface{}); ok {
+				types = filterValues(types, func(t interface{}) bool {
+					s, _ := t.(string)
+					return !o.hidesType(s)
+				})
+				if len(types) == 0 {
+					return false
+				}
+				res["types"] = types
+			}
+			if upstream, ok := res["idPrefixes"].([]interface{}); ok && len(o.IDPrefixes) > 0 {
+				prefixes := o.intersectIDPrefixes(upstream)
+				if len(prefixes) == 0 {
+					return false
+				}
+				res["idPrefixes"] = prefixes
+			}
+			return true
+		})
+	}
+
+	// The override narrows what the upstream serves; it can't add prefixes
+	// the addon never declared.
+	if len(o.IDPrefixes) > 0 {
+		if upstream, ok := manifest["idPrefixes"].([]interface{}); ok {
+			manifest["idPrefixes"] = o.intersectIDPrefixes(upstream)
+		} else {
+			manifest["idPrefixes"] = o.IDPrefixes
+		}
+	}
+}
+
+// allowsResource reports whether a resource request is still served under the
+// overrides. resourcePath is "type/id[/extra].json". Stremio shouldn't ask for
+// hidden content, but clients with a stale manifest might.
+func (o *ManifestOverrides) allowsResource(resource, resourcePath string) bool {
+	if o == nil {
+		return true
+	}
+
+	parts := strings.SplitN(resourcePath, "/", 3)
+	contentType := parts[0]
+	id := ""
+	if len(parts) > 1 {
+		id = strings.TrimSuffix(parts[1], ".json")
+		if unescaped, err := url.PathUnescape(id); err == nil {
+			id = unescaped
+		}
+	}
+
+	if o.hidesType(contentType) {
+		return false
+	}
+	switch resource {
+	case "catalog":
+		return !o.hidesCatalog(contentType, id)
+	case "meta", "stream", "subtitles":
+		return o.allowsID(id)
+	}
+	return true
+}
+
+// hidesType reports whether a content type is hidden.
+func (o *ManifestOverrides) hidesType(contentType string) bool {
+	for _, t := range o.HiddenTypes {
+		if t == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// hidesCatalog reports whether a catalog is hidden, matched as "type/id" or
+// by id alone.
+func (o *ManifestOverrides) hidesCatalog(contentType, id string) bool {
+	for _, c := range o.HiddenCatalogs {
+		if c == id || c == contentType+"/"+id {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsID reports whether an item ID matches the idPrefixes filter.
+func (o *ManifestOverrides) allowsID(id string) bool {
+	if len(o.IDPrefixes) == 0 {
+		return true
+	}
+	for _, p := range o.IDPrefixes {
+		if strings.HasPrefix(id, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// intersectIDPrefixes returns the prefixes an id must start with to match
+// both an upstream idPrefixes list and the override's: of every overlapping
+// pair, the longer prefix.
+func (o *ManifestOverrides) intersectIDPrefixes(upstream []interface{}) []interface{} {
+	out := make([]interface{}, 0, len(o.IDPrefixes))
+	seen := make(map[string]bool)
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	for _, v := range upstream {
+		u, ok := v.(string)
+		if !ok {
+			continue
+		}
+		for _, p := range o.IDPrefixes {
+			switch {
+			case strings.HasPrefix(p, u):
+				add(p)
+			case strings.HasPrefix(u, p):
+				add(u)
+			}
+		}
+	}
+	return out
+}
+
+// filterValues returns the elements of values for which keep returns true.
+func filterValues(values []interface{}, keep func(interface{}) bool) []interface{} {
+	out := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		if keep(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// cleanList trims entries and drops empty ones.
+func cleanList(list []string) []string {
+	var out []string
+	for _, s := range list {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
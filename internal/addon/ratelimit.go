@@ -0,0 +1,221 @@
+package addon
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	backoffBase = 2 * time.Second
+	backoffMax  = 5 * time.Minute
+	// rateMemory is how long a rate requested for a host keeps constraining
+	// its bucket after the last request made with it.
+	rateMemory = 10 * time.Minute
+)
+
+// throttledError is returned when the bridge itself holds a request back
+// because the upstream host is rate limited or backing off. It unwraps to
+// ErrRateLimited so it is handled like an upstream 429.
+type throttledError struct {
+	key  string
+	wait time.Duration
+}
+
+func (e *throttledError) Error() string {
+	return fmt.Sprintf("throttled: %s is rate limited, next slot in %s", e.key, e.wait.Round(time.Second))
+}
+
+func (e *throttledError) Unwrap() error { return ErrRateLimited }
+
+// HostLimitState is a snapshot of one host's limiter for diagnostics.
+type HostLimitState struct {
+	Tokens       float64    `json:"tokens"`
+	RatePerMin   int        `json:"ratePerMinute"`
+	Failures     int        `json:"consecutiveFailures"`
+	BackoffUntil *time.Time `json:"backoffUntil,omitempty"`
+}
+
+// bucket is a token bucket plus backoff state for one upstream host.
+type bucket struct {
+	tokens       float64
+	last         time.Time
+	ratePerMin   int               // strictest of rates
+	rates        map[int]time.Time // requested ratePerMin -> last requested
+	failures     int
+	backoffUntil time.Time
+}
+
+// hostLimiter rate limits upstream requests per host with token buckets and
+// applies exponential backoff (or the upstream's Retry-After) after 429 and
+// 5xx responses. Buckets are keyed by egress path and host, so a 429 on the
+// server's own IP doesn't hold back the relay tab or a proxy.
+type hostLimiter struct {
+	mu           sync.Mutex
+	buckets      map[string]*bucket
+	burst        int
+	queueTimeout time.Duration
+}
+
+func newHostLimiter(burst int, queueTimeout time.Duration) *hostLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &hostLimiter{
+		buckets:      make(map[string]*bucket),
+		burst:        burst,
+		queueTimeout: queueTimeout,
+	}
+}
+
+// limiterKey builds the bucket key for a fetch: egress path plus URL host.
+func limiterKey(egress, rawURL string) string {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return egress + "|" + host
+}
+
+// acquire waits for a token for key, refilled at ratePerMin (0 = unlimited).
+// If the host is backing off or no token frees up within the queue timeout,
+// it returns a *throttledError instead of waiting any longer.
+func (l *hostLimiter) acquire(key string, ratePerMin int) error {
+	return l.acquireBy(key, ratePerMin, time.Now().Add(l.queueTimeout))
+}
+
+// acquireBy is acquire with a caller-supplied deadline, for callers with a
+// shorter budget than the queue timeout.
+func (l *hostLimiter) acquireBy(key string, ratePerMin int, deadline time.Time) error {
+	for {
+		l.mu.Lock()
+		b := l.bucketLocked(key, ratePerMin)
+		now := time.Now()
+		l.refillLocked(b, now)
+
+		var wait time.Duration
+		switch {
+		case now.Before(b.backoffUntil):
+			wait = b.backoffUntil.Sub(now)
+		case b.ratePerMin <= 0:
+			l.mu.Unlock()
+			return nil
+		case b.tokens >= 1:
+			b.tokens--
+			l.mu.Unlock()
+			return nil
+		default:
+			perToken := time.Minute / time.Duration(b.ratePerMin)
+			wait = time.Duration((1 - b.tokens) * float64(perToken))
+		}
+		l.mu.Unlock()
+
+		if now.Add(wait).After(deadline) {
+			return &throttledError{key: key, wait: wait}
+		}
+		time.Sleep(wait)
+	}
+}
+
+// report updates backoff state after an upstream response. Rate limits and
+// server errors extend the backoff; anything else resets it.
+func (l *hostLimiter) report(key string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return
+	}
+
+	if !isBackoffError(err) {
+		b.failures = 0
+		b.backoffUntil = time.Time{}
+		return
+	}
+
+	b.failures++
+	d := time.Duration(float64(backoffBase) * math.Pow(2, float64(b.failures-1)))
+	if d > backoffMax {
+		d = backoffMax
+	}
+	if ra := RetryAfter(err); ra > d {
+		d = ra
+	}
+	b.backoffUntil = time.Now().Add(d)
+	fmt.Printf("wrapper: backing off %s for %s (%d consecutive failures)\n", key, d.Round(time.Second), b.failures)
+}
+
+// snapshot returns the state of every bucket.
+func (l *hostLimiter) snapshot() map[string]HostLimitState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	result := make(map[string]HostLimitState, len(l.buckets))
+	for key, b := range l.buckets {
+		l.refillLocked(b, now)
+		state := HostLimitState{
+			Tokens:     math.Floor(b.tokens*100) / 100,
+			RatePerMin: b.ratePerMin,
+			Failures:   b.failures,
+		}
+		if now.Before(b.backoffUntil) {
+			until := b.backoffUntil
+			state.BackoffUntil = &until
+		}
+		result[key] = state
+	}
+	return result
+}
+
+// bucketLocked returns the bucket for key, creating it full. Addons sharing a
+// host may ask for different rates; the bucket refills at the strictest one
+// requested within rateMemory, so one addon can't lift another's limit and
+// a rate no addon asks for any more stops applying. Caller must hold l.mu.
+func (l *hostLimiter) bucketLocked(key string, ratePerMin int) *bucket {
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now, rates: make(map[int]time.Time)}
+		l.buckets[key] = b
+	}
+
+	b.rates[ratePerMin] = now
+	b.ratePerMin = 0
+	for rate, seen := range b.rates {
+		if now.Sub(seen) > rateMemory {
+			delete(b.rates, rate)
+			continue
+		}
+		if rate > 0 && (b.ratePerMin == 0 || rate < b.ratePerMin) {
+			b.ratePerMin = rate
+		}
+	}
+	return b
+}
+
+// refillLocked adds the tokens earned since the last refill. Caller must hold l.mu.
+func (l *hostLimiter) refillLocked(b *bucket, now time.Time) {
+	if b.ratePerMin > 0 {
+		elapsed := now.Sub(b.last).Minutes()
+		b.tokens = math.Min(float64(l.burst), b.tokens+elapsed*float64(b.ratePerMin))
+	}
+	b.last = now
+}
+
+// isBackoffError reports whether an upstream error should trigger backoff:
+// rate limits and 5xx server errors.
+func isBackoffError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrMaintenance) {
+		return true
+	}
+	var ue *UpstreamError
+	return errors.As(err, &ue) && ue.StatusCode >= 500
+}
@@ -0,0 +1,163 @@
+package addon
+
+import (
+	"net/url"
+	"strings"
+)
+
+// secretMask replaces secret values in redacted URLs.
+const secretMask = "****"
+
+// secretNameHints are substrings of query parameter and config option names
+// whose values are treated as secrets.
+var secretNameHints = []string{"key", "token", "secret", "pass", "auth", "session", "cookie"}
+
+// debridServices are config option names used by Torrentio-style addons whose
+// value is the user's API key for that service.
+var debridServices = map[string]bool{
+	"realdebrid":  true,
+	"premiumize":  true,
+	"alldebrid":   true,
+	"debridlink":  true,
+	"offcloud":    true,
+	"torbox":      true,
+	"putio":       true,
+	"easydebrid":  true,
+	"debridplus":  true,
+	"stremthru":   true,
+	"mediafusion": true,
+}
+
+// RedactURL returns rawURL with embedded secrets masked so it can be shown in
+// API responses and logs. It masks userinfo, secret-looking query parameters,
+// secret options in config path segments (e.g. "realdebrid=KEY" in Torrentio
+// URLs) and opaque path segments such as base64 config blobs or raw API keys.
+// The scheme, host and ordinary path segments are kept so the URL stays
+// recognisable.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	var b strings.Builder
+	b.WriteString(u.Scheme)
+	b.WriteString("://")
+	if u.User != nil {
+		b.WriteString(secretMask)
+		b.WriteString("@")
+	}
+	b.WriteString(u.Host)
+
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, seg := range segments {
+		if i > 0 {
+			b.WriteString("/")
+		}
+		b.WriteString(redactPathSegment(seg))
+	}
+
+	if u.RawQuery != "" {
+		b.WriteString("?")
+		b.WriteString(redactQuery(u.RawQuery))
+	}
+	return b.String()
+}
+
+// HasSecrets reports whether RedactURL would mask anything in rawURL.
+func HasSecrets(rawURL string) bool {
+	return RedactURL(rawURL) != rawURL
+}
+
+// redactPathSegment masks secrets in one escaped path segment.
+func redactPathSegment(seg string) string {
+	if seg == "" {
+		return seg
+	}
+	decoded, err := url.PathUnescape(seg)
+	if err != nil {
+		decoded = seg
+	}
+
+	// Config segments: "opt=value|opt=value" (Torrentio) or "opt=value&...".
+	if strings.Contains(decoded, "=") && !looksOpaque(decoded) {
+		changed := false
+		parts := strings.FieldsFunc(decoded, func(r rune) bool { return r == '|' || r == '&' })
+		for i, part := range parts {
+			name, value, ok := strings.Cut(part, "=")
+			if !ok || value == "" {
+				continue
+			}
+			if isSecretName(name) || debridServices[strings.ToLower(name)] {
+				parts[i] = name + "=" + secretMask
+				changed = true
+			}
+		}
+		if !changed {
+			return seg
+		}
+		sep := "|"
+		if !strings.Contains(decoded, "|") {
+			sep = "&"
+		}
+		return strings.Join(parts, sep)
+	}
+
+	if looksOpaque(decoded) {
+		return secretMask
+	}
+	return seg
+}
+
+// redactQuery masks the values of secret-looking query parameters, keeping
+// parameter order.
+func redactQuery(rawQuery string) string {
+	pairs := strings.Split(rawQuery, "&")
+	for i, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || value == "" {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if isSecretName(name) || looksOpaque(value) {
+			pairs[i] = url.QueryEscape(name) + "=" + secretMask
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// isSecretName reports whether a parameter or option name suggests its value
+// is a credential.
+func isSecretName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, hint := range secretNameHints {
+		if strings.Contains(lower, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// looksOpaque reports whether s looks like an API key, token or encoded
+// config blob rather than a readable path component: long, made only of
+// token characters, and mixing letters with digits.
+func looksOpaque(s string) bool {
+	if len(s) < 20 {
+		return false
+	}
+	hasLetter, hasDigit := false, false
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			hasLetter = true
+		case r >= '0' && r <= '9':
+			hasDigit = true
+		case strings.ContainsRune("-_.=+/%", r):
+		default:
+			return false
+		}
+	}
+	return hasLetter && hasDigit
+}
@@ -0,0 +1,67 @@
+package addon
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	staleCacheMaxEntries = 500
+	staleCacheMaxAge     = 6 * time.Hour
+)
+
+// staleEntry is a previously successful upstream response.
+type staleEntry struct {
+	data      []byte
+	fetchedAt time.Time
+}
+
+// staleCache remembers the last successful response per addon+URL so that
+// requests held back by rate limiting can still be answered with slightly
+// old data instead of an empty result.
+type staleCache struct {
+	mu      sync.Mutex
+	entries map[string]*staleEntry
+}
+
+func newStaleCache() *staleCache {
+	return &staleCache{entries: make(map[string]*staleEntry)}
+}
+
+// put records a successful response, evicting the oldest entry when full.
+func (sc *staleCache) put(addonID, rawURL string, data []byte) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	key := addonID + "\x00" + rawURL
+	if _, exists := sc.entries[key]; !exists && len(sc.entries) >= staleCacheMaxEntries {
+		sc.evictOldestLocked()
+	}
+	sc.entries[key] = &staleEntry{data: data, fetchedAt: time.Now()}
+}
+
+// get returns the last successful response if it isn't older than
+// staleCacheMaxAge.
+func (sc *staleCache) get(addonID, rawURL string) ([]byte, time.Time, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	e, ok := sc.entries[addonID+"\x00"+rawURL]
+	if !ok || time.Since(e.fetchedAt) > staleCacheMaxAge {
+		return nil, time.Time{}, false
+	}
+	return e.data, e.fetchedAt, true
+}
+
+// evictOldestLocked drops the least recently fetched entry. Caller must hold sc.mu.
+func (sc *staleCache) evictOldestLocked() {
+	var oldestKey string
+	var oldest time.Time
+	for key, e := range sc.entries {
+		if oldestKey == "" || e.fetchedAt.Before(oldest) {
+			oldestKey = key
+			oldest = e.fetchedAt
+		}
+	}
+	delete(sc.entries, oldestKey)
+}
@@ -9,6 +9,8 @@ import (
 	"sort"
 	"sync"
 	"time"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/secret"
 )
 
 // AddonStore manages wrapped addons with thread-safe in-memory storage and JSON persistence
@@ -16,32 +18,63 @@ type AddonStore struct {
 	mu       sync.RWMutex
 	addons   map[string]*WrappedAddon
 	filePath string
+	cipher   *secret.Cipher // may be nil (URLs stored in plain text)
 }
 
-// NewAddonStore creates a new addon store with the specified data directory
-func NewAddonStore(dataDir string) (*AddonStore, error) {
+// NewAddonStore creates a new addon store with the specified data directory.
+// If secretKey is non-empty, addon and proxy URLs are encrypted at rest with
+// a key derived from it; existing plain-text entries are encrypted on load.
+func NewAddonStore(dataDir string, secretKey string) (*AddonStore, error) {
+	c, err := secret.New(secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up addon encryption: %w", err)
+	}
+
 	store := &AddonStore{
 		addons:   make(map[string]*WrappedAddon),
 		filePath: dataDir + "/addons.json",
+		cipher:   c,
 	}
 
 	// Load existing data from disk (if file doesn't exist, starts with empty map)
-	if err := store.load(); err != nil && !os.IsNotExist(err) {
+	migrate, err := store.load()
+	if err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("failed to load addon store: %w", err)
 	}
+	if migrate {
+		if err := store.save(); err != nil {
+			return nil, fmt.Errorf("failed to encrypt addon store: %w", err)
+		}
+		fmt.Println("addon store: encrypted plain-text addon URLs at rest")
+	}
 
 	return store, nil
 }
 
+// AddonID returns the wrap ID for an original manifest URL: the first 8 hex
+// characters of its SHA256 hash.
+func AddonID(originalURL string) string {
+	hash := sha256.Sum256([]byte(originalURL))
+	return hex.EncodeToString(hash[:])[:8]
+}
+
 // Add creates a new wrapped addon with the given original URL
 // If an addon with the same ID already exists, returns the existing addon (idempotent)
 func (s *AddonStore) Add(originalURL string) (*WrappedAddon, error) {
+	return s.add(originalURL, false)
+}
+
+// AddAuto is like Add but marks a newly created addon as auto-wrapped, i.e.
+// registered lazily by an /auto/ request rather than through the API.
+func (s *AddonStore) AddAuto(originalURL string) (*WrappedAddon, error) {
+	return s.add(originalURL, true)
+}
+
+func (s *AddonStore) add(originalURL string, auto bool) (*WrappedAddon, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Generate ID from SHA256 hash of the original URL
-	hash := sha256.Sum256([]byte(originalURL))
-	id := hex.EncodeToString(hash[:])[:8]
+	id := AddonID(originalURL)
 
 	// Check if addon already exists
 	if existing, found := s.addons[id]; found {
@@ -56,6 +89,8 @@ func (s *AddonStore) Add(originalURL string) (*WrappedAddon, error) {
 		FetchMethod: FetchMethodGlobal,
 		FetchStatus: FetchStatusUnknown,
 		CreatedAt:   time.Now(),
+		Priority:    s.nextPriorityLocked(),
+		AutoWrapped: auto,
 	}
 
 	s.addons[id] = addon
@@ -77,24 +112,82 @@ func (s *AddonStore) Get(id string) (*WrappedAddon, bool) {
 	return addon, found
 }
 
-// List returns all addons sorted by creation time
+// List returns all addons in priority order (creation time breaks ties)
 func (s *AddonStore) List() []*WrappedAddon {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	return s.sortedLocked()
+}
+
+// sortedLocked returns the addons sorted by priority, then creation time.
+// Caller must hold s.mu.
+func (s *AddonStore) sortedLocked() []*WrappedAddon {
 	result := make([]*WrappedAddon, 0, len(s.addons))
 	for _, addon := range s.addons {
 		result = append(result, addon)
 	}
 
-	// Sort by CreatedAt
 	sort.Slice(result, func(i, j int) bool {
+		if result[i].Priority != result[j].Priority {
+			return result[i].Priority < result[j].Priority
+		}
 		return result[i].CreatedAt.Before(result[j].CreatedAt)
 	})
 
 	return result
 }
 
+// nextPriorityLocked returns the priority that places a new addon last.
+// Caller must hold s.mu.
+func (s *AddonStore) nextPriorityLocked() int {
+	next := 0
+	for _, addon := range s.addons {
+		if addon.Priority >= next {
+			next = addon.Priority + 1
+		}
+	}
+	return next
+}
+
+// Reorder sets the addon order. ids lists addons in their new order; addons
+// not listed keep their relative order after the listed ones.
+func (s *AddonStore) Reorder(ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if _, found := s.addons[id]; !found {
+			return fmt.Errorf("addon with id %s not found", id)
+		}
+		if seen[id] {
+			return fmt.Errorf("addon %s listed more than once", id)
+		}
+		seen[id] = true
+	}
+
+	current := s.sortedLocked()
+	order := make([]*WrappedAddon, 0, len(current))
+	for _, id := range ids {
+		order = append(order, s.addons[id])
+	}
+	for _, addon := range current {
+		if !seen[addon.ID] {
+			order = append(order, addon)
+		}
+	}
+	for i, addon := range order {
+		addon.Priority = i
+	}
+
+	if err := s.save(); err != nil {
+		return fmt.Errorf("failed to save after reorder: %w", err)
+	}
+
+	return nil
+}
+
 // Remove deletes an addon by its ID
 func (s *AddonStore) Remove(id string) error {
 	s.mu.Lock()
@@ -134,6 +227,54 @@ func (s *AddonStore) UpdateName(id string, name string) error {
 	return nil
 }
 
+// UpdateManifestID records the rebranded manifest id an addon was served
+// under. Unchanged ids aren't saved again.
+func (s *AddonStore) UpdateManifestID(id string, manifestID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	addon, found := s.addons[id]
+	if !found {
+		return fmt.Errorf("addon with id %s not found", id)
+	}
+	if addon.ManifestID == manifestID {
+		return nil
+	}
+
+	addon.ManifestID = manifestID
+
+	// Save to disk
+	if err := s.save(); err != nil {
+		return fmt.Errorf("failed to save after manifest id update: %w", err)
+	}
+
+	return nil
+}
+
+// Update applies several changes to an addon at once: apply edits a copy,
+// which replaces the addon after a single save. If the save fails the addon
+// is left unchanged.
+func (s *AddonStore) Update(id string, apply func(a *WrappedAddon)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, found := s.addons[id]
+	if !found {
+		return fmt.Errorf("addon with id %s not found", id)
+	}
+
+	next := *prev
+	apply(&next)
+	s.addons[id] = &next
+
+	if err := s.save(); err != nil {
+		s.addons[id] = prev
+		return fmt.Errorf("failed to save after update: %w", err)
+	}
+
+	return nil
+}
+
 // UpdateFetchMethod sets the fetch method for an addon
 func (s *AddonStore) UpdateFetchMethod(id string, method string) error {
 	s.mu.Lock()
@@ -145,6 +286,8 @@ func (s *AddonStore) UpdateFetchMethod(id string, method string) error {
 	}
 
 	addon.FetchMethod = method
+	// A new explicit choice takes precedence over the remembered method.
+	addon.LastSuccessMethod = ""
 
 	if err := s.save(); err != nil {
 		return fmt.Errorf("failed to save after fetch method update: %w", err)
@@ -172,16 +315,115 @@ func (s *AddonStore) UpdateFetchStatus(id string, status string) error {
 	return nil
 }
 
-// load reads the addons from the JSON file on disk
-func (s *AddonStore) load() error {
+// RecordFetchResult updates an addon's fetch status after a fetch attempt.
+// On success the method that worked is remembered. The store is only written
+// to disk when the status or remembered method actually changes, so this is
+// cheap to call on every request.
+func (s *AddonStore) RecordFetchResult(id string, ok bool, method string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	addon, found := s.addons[id]
+	if !found {
+		return fmt.Errorf("addon with id %s not found", id)
+	}
+
+	status := FetchStatusBlocked
+	if ok {
+		status = FetchStatusOK
+	}
+
+	changed := false
+	if addon.FetchStatus != status {
+		now := time.Now()
+		addon.FetchStatus = status
+		addon.FetchStatusAt = &now
+		changed = true
+	}
+	if ok && addon.LastSuccessMethod != method {
+		addon.LastSuccessMethod = method
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	if err := s.save(); err != nil {
+		return fmt.Errorf("failed to save after fetch result: %w", err)
+	}
+
+	return nil
+}
+
+// Snapshot returns copies of all addons in priority order, with decrypted URLs.
+func (s *AddonStore) Snapshot() []WrappedAddon {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sorted := s.sortedLocked()
+	result := make([]WrappedAddon, 0, len(sorted))
+	for _, addon := range sorted {
+		result = append(result, *addon)
+	}
+	return result
+}
+
+// Replace swaps the whole addon set, e.g. when restoring a backup. If the new
+// set can't be saved, the previous one is kept.
+func (s *AddonStore) Replace(addons []WrappedAddon) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := make(map[string]*WrappedAddon, len(addons))
+	for i := range addons {
+		a := addons[i]
+		next[a.ID] = &a
+	}
+
+	prev := s.addons
+	s.addons = next
+	if err := s.save(); err != nil {
+		s.addons = prev
+		return fmt.Errorf("failed to save replaced addons: %w", err)
+	}
+
+	return nil
+}
+
+// load reads the addons from the JSON file on disk, decrypting addon and
+// proxy URLs that are encrypted at rest. It reports whether plain-text URLs were found while
+// encryption is enabled, so the caller can rewrite the file.
+func (s *AddonStore) load() (bool, error) {
 	data, err := os.ReadFile(s.filePath)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	var addons map[string]*WrappedAddon
 	if err := json.Unmarshal(data, &addons); err != nil {
-		return fmt.Errorf("failed to unmarshal addons: %w", err)
+		return false, fmt.Errorf("failed to unmarshal addons: %w", err)
+	}
+
+	migrate := false
+	for id, a := range addons {
+		for _, field := range []*string{&a.OriginalURL, &a.ProxyURL} {
+			if *field == "" {
+				continue
+			}
+			if !secret.IsEncrypted(*field) {
+				migrate = migrate || s.cipher != nil
+				continue
+			}
+			if s.cipher == nil {
+				return false, fmt.Errorf("addon %s is encrypted but ADDON_SECRET_KEY is not set", id)
+			}
+			plain, err := s.cipher.Decrypt(*field)
+			if err != nil {
+				return false, fmt.Errorf("addon %s: %w", id, err)
+			}
+			*field = plain
+		}
 	}
 
 	// Backward compatibility: set defaults for addons loaded from older formats.
@@ -195,19 +437,43 @@ func (s *AddonStore) load() error {
 	}
 
 	s.addons = addons
-	return nil
+	return migrate, nil
 }
 
 // save writes the addons to the JSON file on disk
 func (s *AddonStore) save() error {
-	data, err := json.MarshalIndent(s.addons, "", "  ")
+	out := s.addons
+	if s.cipher != nil {
+		out = make(map[string]*WrappedAddon, len(s.addons))
+		for id, a := range s.addons {
+			enc, err := s.cipher.Encrypt(a.OriginalURL)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt addon %s: %w", id, err)
+			}
+			cp := *a
+			cp.OriginalURL = enc
+			if a.ProxyURL != "" {
+				if cp.ProxyURL, err = s.cipher.Encrypt(a.ProxyURL); err != nil {
+					return fmt.Errorf("failed to encrypt proxy URL of addon %s: %w", id, err)
+				}
+			}
+			out[id] = &cp
+		}
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal addons: %w", err)
 	}
 
-	if err := os.WriteFile(s.filePath, data, 0644); err != nil {
+	// Write to a temp file and rename so a crash never leaves a truncated file.
+	tmp := s.filePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
 		return fmt.Errorf("failed to write addons file: %w", err)
 	}
+	if err := os.Rename(tmp, s.filePath); err != nil {
+		return fmt.Errorf("failed to replace addons file: %w", err)
+	}
 
 	return nil
 }
@@ -0,0 +1,274 @@
+package addon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/engine"
+	"github.com/krizcold/stremio-torrent-bridge/internal/subtitles"
+)
+
+const (
+	// maxSubtitleFileSize rejects "subtitle" files too large to be one.
+	maxSubtitleFileSize = 4 << 20
+	// subtitleFetchTimeout bounds reading a subtitle file, which may still
+	// have to be downloaded from the swarm.
+	subtitleFetchTimeout = 30 * time.Second
+	// subtitleLookupTimeout bounds listing the engine's torrents.
+	subtitleLookupTimeout = 5 * time.Second
+	// maxConvertedSubtitles bounds the in-memory cache of converted files.
+	maxConvertedSubtitles = 50
+)
+
+// videoExtensions identify the video files of a torrent, to tell single
+// videos from packs.
+var videoExtensions = map[string]bool{
+	".mkv": true, ".mp4": true, ".m4v": true, ".avi": true, ".webm": true,
+	".mov": true, ".ts": true, ".m2ts": true, ".wmv": true, ".mpg": true,
+}
+
+// subtitleEntry is one subtitle in a Stremio subtitles response.
+type subtitleEntry struct {
+	ID   string `json:"id"`
+	URL  string `json:"url"`
+	Lang string `json:"lang"`
+}
+
+// HandleSubtitles lists the subtitle files shipped inside the torrent being
+// watched, converted to WebVTT by HandleSubtitleFile, and the text subtitle
+// tracks embedded in its video if it is a Matroska file, extracted by
+// HandleEmbeddedSubtitle. The torrent is found by
+// the videoHash Stremio sends (as computed by the video hasher), then by the
+// filename and videoSize hints, and finally by the item the torrent's stream
+// was listed for, most recently played first.
+//
+// Route: GET /subtitles/:type/:id.json and /subtitles/:type/:id/:extra.json
+func (w *Wrapper) HandleSubtitles(c *fiber.Ctx) {
+	c.Set("Content-Type", "application/json")
+
+	extra, _ := url.ParseQuery(param(c, "extra"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), subtitleLookupTimeout)
+	torrents, err := w.engine.ListTorrents(ctx)
+	cancel()
+	if err != nil {
+		fmt.Printf("wrapper: subtitles: list torrents: %v\n", err)
+		c.SendString(`{"subtitles":[]}`)
+		return
+	}
+
+	t, videoIdx := w.subtitleTorrent(param(c, "type"), param(c, "id"), extra, torrents)
+	if t == nil {
+		c.SendString(`{"subtitles":[]}`)
+		return
+	}
+
+	// Some engines (rqbit) list torrents without their files; ask for the
+	// matched one in full.
+	ctx, cancel = context.WithTimeout(context.Background(), subtitleLookupTimeout)
+	t, err = w.engine.GetTorrent(ctx, t.InfoHash)
+	cancel()
+	if err != nil || t == nil {
+		if err != nil {
+			fmt.Printf("wrapper: subtitles: get torrent: %v\n", err)
+		}
+		c.SendString(`{"subtitles":[]}`)
+		return
+	}
+
+	base := w.resolveExternalURL(c)
+	hash := strings.ToLower(t.InfoHash)
+	entries := make([]subtitleEntry, 0)
+	video, videos := torrentVideo(t, videoIdx)
+	stem := videoStem(video)
+	for _, f := range siblingSubtitles(t, video, videos) {
+		entries = append(entries, subtitleEntry{
+			ID:   fmt.Sprintf("bridge-%s-%d", hash, f.Index),
+			URL:  fmt.Sprintf("%s/subtitles/%s/%d.vtt", base, hash, f.Index),
+			Lang: subtitles.DetectLanguage(f.Path, stem),
+		})
+	}
+	if video != nil {
+		for _, track := range w.embeddedSubtitles(hash, video) {
+			entries = append(entries, subtitleEntry{
+				ID:   fmt.Sprintf("bridge-%s-%d-%d", hash, video.Index, track.Number),
+				URL:  fmt.Sprintf("%s/subtitles/%s/%d/%d.vtt", base, hash, video.Index, track.Number),
+				Lang: subtitles.LanguageCode(track.Language),
+			})
+		}
+	}
+
+	out, _ := json.Marshal(map[string]interface{}{"subtitles": entries})
+	c.Send(out)
+}
+
+// subtitleTorrent finds the torrent a subtitles request is for among the
+// engine's torrents, and the index of the video file if known (-1 if not).
+func (w *Wrapper) subtitleTorrent(contentType, itemID string, extra url.Values, torrents []engine.TorrentInfo) (*engine.TorrentInfo, int) {
+	byHash := make(map[string]*engine.TorrentInfo, len(torrents))
+	for i := range torrents {
+		byHash[strings.ToLower(torrents[i].InfoHash)] = &torrents[i]
+	}
+
+	if videoHash := extra.Get("videoHash"); videoHash != "" && w.hasher != nil {
+		if hash, fileIdx, ok := w.hasher.Find(videoHash); ok && byHash[hash] != nil {
+			return byHash[hash], fileIdx
+		}
+	}
+
+	if filename := extra.Get("filename"); filename != "" {
+		size, _ := strconv.ParseInt(extra.Get("videoSize"), 10, 64)
+		for i := range torrents {
+			for _, f := range torrents[i].Files {
+				if path.Base(f.Path) == filename && (size == 0 || f.Size == size) {
+					return &torrents[i], f.Index
+				}
+			}
+		}
+	}
+
+	if w.cacheManager != nil {
+		// GetStats lists torrents most recently accessed first.
+		for _, entry := range w.cacheManager.GetStats().Torrents {
+			hash := strings.ToLower(entry.InfoHash)
+			origin := w.origins.get(hash)
+			if origin == nil || origin.Type != contentType || origin.ItemID != itemID {
+				continue
+			}
+			if t := byHash[hash]; t != nil {
+				return t, -1
+			}
+		}
+	}
+
+	return nil, -1
+}
+
+// torrentVideo returns the video file at videoIdx (-1 picks the largest
+// video) and how many video files the torrent has.
+func torrentVideo(t *engine.TorrentInfo, videoIdx int) (*engine.TorrentFile, int) {
+	var video *engine.TorrentFile
+	videos := 0
+	for i := range t.Files {
+		f := &t.Files[i]
+		if !videoExtensions[strings.ToLower(path.Ext(f.Path))] {
+			continue
+		}
+		videos++
+		if f.Index == videoIdx || (videoIdx < 0 && (video == nil || f.Size > video.Size)) {
+			video = f
+		}
+	}
+	return video, videos
+}
+
+// siblingSubtitles returns the subtitle files of a torrent that belong to
+// video. In single-video torrents that is every subtitle file; in packs only
+// those whose path contains the video's name, e.g. "Show.S01E02.en.srt" or
+// "Subs/Show.S01E02/2_English.srt".
+func siblingSubtitles(t *engine.TorrentInfo, video *engine.TorrentFile, videos int) []engine.TorrentFile {
+	var stem string
+	if videos > 1 {
+		stem = videoStem(video)
+	}
+
+	var subs []engine.TorrentFile
+	for _, f := range t.Files {
+		if !subtitles.IsSubtitleFile(f.Path) || f.Size > maxSubtitleFileSize {
+			continue
+		}
+		if stem != "" && !strings.Contains(strings.ToLower(f.Path), stem) {
+			continue
+		}
+		subs = append(subs, f)
+	}
+	return subs
+}
+
+// videoStem returns the lowercased file name of video without its extension,
+// or "" if video is nil.
+func videoStem(video *engine.TorrentFile) string {
+	if video == nil {
+		return ""
+	}
+	name := strings.ToLower(path.Base(video.Path))
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// HandleSubtitleFile serves a subtitle file from a torrent as WebVTT. The file
+// is read through the engine and converted on first request, then kept in
+// memory.
+//
+// Route: GET /subtitles/:infoHash/:fileIdx.vtt
+func (w *Wrapper) HandleSubtitleFile(c *fiber.Ctx) {
+	infoHash := strings.ToLower(param(c, "infoHash"))
+	fileIdx, err := strconv.Atoi(param(c, "fileIdx"))
+	if infoHash == "" || err != nil {
+		c.Status(http.StatusBadRequest)
+		c.Set("Content-Type", "application/json")
+		c.SendString(`{"error":"invalid subtitle path"}`)
+		return
+	}
+
+	cacheKey := infoHash + "/" + strconv.Itoa(fileIdx)
+	vtt, ok := w.subs.Get(cacheKey)
+	if !ok {
+		vtt, err = w.fetchSubtitle(infoHash, fileIdx)
+		if err != nil {
+			fmt.Printf("wrapper: subtitle %s file %d: %v\n", infoHash, fileIdx, err)
+			c.Status(http.StatusBadGateway)
+			c.Set("Content-Type", "application/json")
+			errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+			c.Send(errJSON)
+			return
+		}
+		w.subs.Put(cacheKey, vtt)
+	}
+
+	c.Set("Content-Type", "text/vtt; charset=utf-8")
+	c.Send(vtt)
+}
+
+// fetchSubtitle reads a subtitle file through the engine and converts it to
+// WebVTT.
+func (w *Wrapper) fetchSubtitle(infoHash string, fileIdx int) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), subtitleFetchTimeout)
+	defer cancel()
+
+	file, err := engine.FindFile(ctx, w.engine, infoHash, fileIdx)
+	if err != nil {
+		return nil, fmt.Errorf("look up file: %w", err)
+	}
+	if !subtitles.IsSubtitleFile(file.Path) {
+		return nil, fmt.Errorf("not a subtitle file")
+	}
+	if file.Size > maxSubtitleFileSize {
+		return nil, fmt.Errorf("subtitle file too large (%d bytes)", file.Size)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://localhost/stream/%s/%d", infoHash, fileIdx), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	resp, err := w.engine.StreamFile(ctx, infoHash, fileIdx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSubtitleFileSize))
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	return subtitles.ToVTT(file.Path, data)
+}
@@ -0,0 +1,55 @@
+package addon
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/scrape"
+)
+
+// scrapeSwarms asks the trackers of each torrent for its swarm size, within
+// TRACKER_SCRAPE_TIMEOUT_MS. Torrents no tracker answered for in time are
+// missing from the result.
+func (w *Wrapper) scrapeSwarms(trackers map[string][]string) map[string]scrape.Result {
+	timeout := time.Duration(w.config.TrackerScrapeTimeoutMs) * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return w.scraper.Scrape(ctx, trackers)
+}
+
+// annotateSwarms adds the live seeder and leecher counts to stream titles.
+// With TRACKER_SCRAPE_DROP_DEAD, torrents the trackers report without
+// seeders are removed, unless the engine already has them complete.
+// streamHashes is filtered along with streams so indexes keep matching.
+func (w *Wrapper) annotateSwarms(streams []interface{}, streamHashes []string, swarms map[string]scrape.Result, progress map[string]float64) ([]interface{}, []string) {
+	keptStreams := make([]interface{}, 0, len(streams))
+	keptHashes := make([]string, 0, len(streams))
+	dropped := 0
+
+	for i, raw := range streams {
+		hash := streamHashes[i]
+		swarm, scraped := swarms[hash]
+		if scraped && swarm.Seeders == 0 && w.config.TrackerScrapeDropDead && progress[hash] < 1 {
+			dropped++
+			continue
+		}
+
+		if item, ok := raw.(map[string]interface{}); ok && scraped {
+			line := fmt.Sprintf("🌱 %d seeders · %d leechers (live)", swarm.Seeders, swarm.Leechers)
+			if title, ok := item["title"].(string); ok {
+				item["title"] = title + "\n" + line
+			} else if desc, ok := item["description"].(string); ok {
+				item["description"] = desc + "\n" + line
+			}
+		}
+
+		keptStreams = append(keptStreams, raw)
+		keptHashes = append(keptHashes, hash)
+	}
+
+	if dropped > 0 {
+		fmt.Printf("wrapper: dropped %d dead torrents (no seeders on any tracker)\n", dropped)
+	}
+	return keptStreams, keptHashes
+}
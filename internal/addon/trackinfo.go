@@ -0,0 +1,44 @@
+package addon
+
+import (
+	"github.com/krizcold/stremio-torrent-bridge/internal/engine"
+)
+
+// describeTracks adds a line describing the video, audio and subtitle
+// tracks to the titles of streams whose file has been probed. Files of
+// torrents the engine has started downloading are probed in the background
+// for the next listing: engines fetch the head of a file first, which holds
+// the headers of most files. streamHashes and streamFiles hold the infoHash
+// and file index of each stream by index.
+func (w *Wrapper) describeTracks(streams []interface{}, streamHashes []string, streamFiles []int, torrents map[string]*engine.TorrentInfo) {
+	for i, raw := range streams {
+		hash := streamHashes[i]
+		t := torrents[hash]
+		if t == nil {
+			continue
+		}
+		item, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		fileIdx := streamFiles[i]
+		info, ok := w.prober.Get(hash, fileIdx)
+		if !ok {
+			if t.Completed > 0 {
+				w.prober.Request(hash, fileIdx)
+			}
+			continue
+		}
+
+		line := info.Summary()
+		if line == "" {
+			continue
+		}
+		if title, ok := item["title"].(string); ok {
+			item["title"] = title + "\n" + line
+		} else if desc, ok := item["description"].(string); ok {
+			item["description"] = desc + "\n" + line
+		}
+	}
+}
@@ -37,7 +37,38 @@ type WrappedAddon struct {
 	ID          string    `json:"id"`
 	OriginalURL string    `json:"originalUrl"`
 	Name        string    `json:"name"`
-	FetchMethod string    `json:"fetchMethod"` // Per-addon fetch method ("global" = use default)
-	FetchStatus string    `json:"fetchStatus"` // ok, blocked, unknown
+	FetchMethod string    `json:"fetchMethod"`                  // Per-addon fetch method ("global" = use default)
+	ProxyURL    string    `json:"proxyUrl,omitempty"`           // Per-addon proxy for the "proxy" method ("" = global PROXY_URL)
+	RateLimit   int       `json:"rateLimitPerMinute,omitempty"` // Per-addon upstream rate limit (0 = global default)
+	FetchStatus string    `json:"fetchStatus"`                  // ok, blocked, unknown
 	CreatedAt   time.Time `json:"createdAt"`
+	Disabled    bool      `json:"disabled,omitempty"`    // Serves empty responses without contacting upstream
+	Priority    int       `json:"priority"`              // Position in the addon list (lower first)
+	AutoWrapped bool      `json:"autoWrapped,omitempty"` // Created lazily by an /auto/ request
+	ManifestID  string    `json:"manifestId,omitempty"`  // Rebranded manifest id last served, kept for the disabled manifest
+
+	// Fetch tracking, updated automatically by the wrapper's fallback chain.
+	FetchStatusAt     *time.Time `json:"fetchStatusAt,omitempty"`     // When FetchStatus last changed
+	LastSuccessMethod string     `json:"lastSuccessMethod,omitempty"` // Method tried first on the next fetch
+
+	Overrides *ManifestOverrides `json:"overrides,omitempty"` // Per-addon manifest customisation (nil = defaults)
+}
+
+// ManifestOverrides customises how a wrapped addon's manifest is presented to
+// Stremio. Empty fields keep the default behaviour.
+type ManifestOverrides struct {
+	Name              string   `json:"name,omitempty"`              // Display name (default: "[Torrent-Bridge] " + upstream name)
+	Logo              string   `json:"logo,omitempty"`              // Logo URL (default: upstream logo)
+	HiddenTypes       []string `json:"hiddenTypes,omitempty"`       // Content types removed from the manifest
+	HiddenCatalogs    []string `json:"hiddenCatalogs,omitempty"`    // Catalogs removed, as "type/id" or just "id"
+	KeepBehaviorHints []string `json:"keepBehaviorHints,omitempty"` // behaviorHints keys kept (default: all stripped)
+	IDPrefixes        []string `json:"idPrefixes,omitempty"`        // Only these idPrefixes are advertised and served
+}
+
+// FetchChainOrder is the order in which fetch methods are tried when the
+// preferred method fails.
+var FetchChainOrder = []string{
+	FetchMethodDirect,
+	FetchMethodProxy,
+	FetchMethodTabRelay,
 }
@@ -0,0 +1,66 @@
+package addon
+
+import (
+	"path"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/engine"
+)
+
+// fillVideoHints restores the behaviorHints Stremio loses when a torrent
+// stream becomes a plain url: filename and videoSize come from the engine's
+// file list when the addon didn't set them, and videoHash from the hasher
+// once it has been computed. Subtitle addons match on these.
+//
+// Hashing is requested here only for torrents the engine has complete, whose
+// first and last pieces can be read without downloading anything; playback
+// requests it for the rest. streamHashes and streamFiles hold the infoHash
+// and file index of each stream by index.
+func (w *Wrapper) fillVideoHints(streams []interface{}, streamHashes []string, streamFiles []int, torrents map[string]*engine.TorrentInfo) {
+	for i, raw := range streams {
+		hash := streamHashes[i]
+		if hash == "" {
+			continue
+		}
+		item, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		hints, _ := item["behaviorHints"].(map[string]interface{})
+		if hints == nil {
+			hints = make(map[string]interface{})
+		}
+
+		fileIdx := streamFiles[i]
+		var file *engine.TorrentFile
+		t := torrents[hash]
+		if t != nil {
+			for j := range t.Files {
+				if t.Files[j].Index == fileIdx {
+					file = &t.Files[j]
+					break
+				}
+			}
+		}
+
+		if file != nil {
+			if _, ok := hints["filename"]; !ok && file.Path != "" {
+				hints["filename"] = path.Base(file.Path)
+			}
+			if _, ok := hints["videoSize"]; !ok && file.Size > 0 {
+				hints["videoSize"] = file.Size
+			}
+		}
+
+		if _, ok := hints["videoHash"]; !ok && w.hasher != nil {
+			if sum, ok := w.hasher.Get(hash, fileIdx); ok {
+				hints["videoHash"] = sum
+			} else if file != nil && t.TotalSize > 0 && t.Completed >= t.TotalSize {
+				w.hasher.Request(hash, fileIdx, file.Size)
+			}
+		}
+
+		if len(hints) > 0 {
+			item["behaviorHints"] = hints
+		}
+	}
+}
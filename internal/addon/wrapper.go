@@ -3,6 +3,7 @@ package addon
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,9 +14,17 @@ import (
 
 	"github.com/gofiber/fiber"
 
+	"github.com/krizcold/stremio-torrent-bridge/internal/cache"
 	"github.com/krizcold/stremio-torrent-bridge/internal/config"
 	"github.com/krizcold/stremio-torrent-bridge/internal/engine"
+	"github.com/krizcold/stremio-torrent-bridge/internal/matroska"
+	"github.com/krizcold/stremio-torrent-bridge/internal/preload"
+	"github.com/krizcold/stremio-torrent-bridge/internal/probe"
+	"github.com/krizcold/stremio-torrent-bridge/internal/proxy"
 	"github.com/krizcold/stremio-torrent-bridge/internal/relay"
+	"github.com/krizcold/stremio-torrent-bridge/internal/scrape"
+	"github.com/krizcold/stremio-torrent-bridge/internal/videohash"
+	"github.com/krizcold/stremio-torrent-bridge/pkg/fifocache"
 	"github.com/krizcold/stremio-torrent-bridge/pkg/httpclient"
 )
 
@@ -32,32 +41,103 @@ func param(c *fiber.Ctx, key string) string {
 // as bridge addons, and replaces torrent infoHash streams with direct HTTP
 // stream URLs served by the local torrent engine.
 type Wrapper struct {
-	store       *AddonStore
-	config      *config.Config
-	engine      engine.Engine
-	relay       *relay.Server // may be nil
-	externalURL string        // BRIDGE_EXTERNAL_URL or empty (falls back to Host header)
-	httpClient  *http.Client
-
-	manifestMu    sync.RWMutex
-	manifestCache map[string][]byte // wrapID -> last known good modified manifest JSON
+	store        *AddonStore
+	config       *config.Config
+	engine       engine.Engine
+	relay        *relay.Server          // may be nil
+	preloader    *preload.Scheduler     // may be nil (preloading disabled)
+	passthrough  *proxy.HTTPPassthrough // may be nil (url streams left untouched)
+	cacheManager *cache.CacheManager    // may be nil (no cached catalog)
+	scraper      *scrape.Client         // may be nil (tracker scraping disabled)
+	hasher       *videohash.Hasher      // may be nil (VIDEO_HASH disabled)
+	prober       *probe.Prober          // container track info, for PROBE_TITLES
+	externalURL  string                 // BRIDGE_EXTERNAL_URL or empty (falls back to Host header)
+	httpClient   *http.Client
+	autoClient   *http.Client // public addresses only, for auto-wrapped addons
+
+	proxyMu      sync.Mutex
+	proxyClients map[string]*http.Client // proxy URL -> client with its own connection pool
+
+	manifests *manifestCache                      // last known good modified manifests, persisted in DATA_DIR
+	fetches   *fetchTracker                       // per-addon, per-method fetch outcomes
+	coalesce  *coalescer                          // shares in-flight upstream fetches between identical requests
+	limiter   *hostLimiter                        // per-host token buckets and backoff
+	stale     *staleCache                         // last good responses, served while rate limited
+	origins   *originRegistry                     // infoHash -> addon and item its stream was listed for
+	metas     *metaCache                          // resolved meta previews for the cached catalog
+	subs      *fifocache.Cache[[]byte]            // subtitle files and tracks converted to WebVTT
+	embedded  *fifocache.Cache[[]*matroska.Track] // subtitle tracks found in Matroska videos
+
+	extractions *coalescer // shares in-flight embedded subtitle extractions
+
+	engineHealth engineHealth   // last engine ping, for placeholder streams
+	engineList   engineSnapshot // last engine torrent list, for badges and hints
+
+	autoWrapMu sync.Mutex // serializes auto-wrap registrations against AUTO_WRAP_MAX
+}
+
+// WrapperDeps are the components a Wrapper uses besides the addon store, the
+// config and the engine. Prober is required; the others may be nil to
+// disable what they provide.
+type WrapperDeps struct {
+	Relay        *relay.Server          // Browser Tab Relay fetches
+	Preloader    *preload.Scheduler     // metadata preloading
+	Passthrough  *proxy.HTTPPassthrough // bridging of url streams
+	CacheManager *cache.CacheManager    // cached catalog
+	Scraper      *scrape.Client         // tracker scraping
+	Hasher       *videohash.Hasher      // OpenSubtitles hashes (VIDEO_HASH)
+	Prober       *probe.Prober          // container track info, for PROBE_TITLES
 }
 
 // NewWrapper creates a Wrapper that proxies and rewrites Stremio addon responses.
-func NewWrapper(store *AddonStore, cfg *config.Config, eng engine.Engine, relayServer *relay.Server) *Wrapper {
-	return &Wrapper{
-		store:         store,
-		config:        cfg,
-		engine:        eng,
-		relay:         relayServer,
-		externalURL:   strings.TrimRight(cfg.ExternalURL, "/"),
-		httpClient:    httpclient.New(),
-		manifestCache: make(map[string][]byte),
-	}
+func NewWrapper(store *AddonStore, cfg *config.Config, eng engine.Engine, deps WrapperDeps) *Wrapper {
+	var keepOrigin func(string) bool
+	if deps.CacheManager != nil {
+		keepOrigin = deps.CacheManager.Tracks
+	}
+
+	w := &Wrapper{
+		store:        store,
+		config:       cfg,
+		engine:       eng,
+		relay:        deps.Relay,
+		preloader:    deps.Preloader,
+		passthrough:  deps.Passthrough,
+		cacheManager: deps.CacheManager,
+		scraper:      deps.Scraper,
+		hasher:       deps.Hasher,
+		prober:       deps.Prober,
+		externalURL:  strings.TrimRight(cfg.ExternalURL, "/"),
+		httpClient:   httpclient.New(),
+		proxyClients: make(map[string]*http.Client),
+		manifests:    newManifestCache(cfg.DataDir),
+		fetches:      newFetchTracker(),
+		coalesce:     newCoalescer(),
+		limiter:      newHostLimiter(cfg.UpstreamBurst, time.Duration(cfg.UpstreamQueueTimeoutSec)*time.Second),
+		stale:        newStaleCache(),
+		origins:      newOriginRegistry(cfg.DataDir, keepOrigin),
+		metas:        newMetaCache(),
+		subs:         fifocache.New[[]byte](maxConvertedSubtitles),
+		embedded:     fifocache.New[[]*matroska.Track](maxEmbeddedTrackLists),
+		extractions:  newCoalescer(),
+	}
+	w.autoClient = httpclient.NewPublicOnly(w.autoWrapHostListed)
+	w.ForgetRemovedAddons()
+	return w
+}
+
+// ForgetRemovedAddons drops the cached manifests of addons that are no longer
+// in the store. Call it after removing addons or restoring a backup.
+func (w *Wrapper) ForgetRemovedAddons() {
+	w.manifests.retain(func(wrapID string) bool {
+		_, found := w.store.Get(wrapID)
+		return found
+	})
 }
 
 // HandleManifest fetches the original addon manifest, rebrands it for the
-// bridge, and strips behaviorHints so Stremio doesn't prompt for configuration.
+// bridge and applies the addon's manifest overrides. By default behaviorHints
+// are stripped so Stremio doesn't prompt for configuration.
 //
 // Route: GET /wrap/:wrapId/manifest.json
 func (w *Wrapper) HandleManifest(c *fiber.Ctx) {
@@ -71,56 +151,51 @@ func (w *Wrapper) HandleManifest(c *fiber.Ctx) {
 		return
 	}
 
+	if addon.Disabled {
+		w.sendDisabledManifest(c, addon)
+		return
+	}
+
 	// Fetch the original manifest from the upstream addon.
 	data, err := w.fetchForAddon(wrapID, addon.OriginalURL)
+	fresh := err == nil
 	if err != nil {
-		fmt.Printf("wrapper: fetch manifest from %s: %v\n", addon.OriginalURL, err)
+		fmt.Printf("wrapper: fetch manifest from %s: %v\n", RedactURL(addon.OriginalURL), err)
 
-		// Serve cached manifest if available (Cloudflare may block direct fetch).
-		w.manifestMu.RLock()
-		cached := w.manifestCache[wrapID]
-		w.manifestMu.RUnlock()
-
-		if cached != nil {
-			fmt.Printf("wrapper: serving cached manifest for %s\n", wrapID)
+		// Fall back to the cached manifest if available (Cloudflare may block
+		// direct fetch).
+		cached := w.manifests.get(wrapID)
+		if cached == nil {
+			c.Status(http.StatusBadGateway)
 			c.Set("Content-Type", "application/json")
-			c.Send(cached)
+			c.SendString(`{"error":"failed to fetch original manifest"}`)
 			return
 		}
-
-		c.Status(http.StatusBadGateway)
-		c.Set("Content-Type", "application/json")
-		c.SendString(`{"error":"failed to fetch original manifest"}`)
-		return
+		fmt.Printf("wrapper: serving cached manifest for %s (fetched %s ago)\n",
+			wrapID, time.Since(cached.FetchedAt).Round(time.Second))
+		data = cached.Data
 	}
 
 	// Parse into a generic map so we can modify arbitrary fields without
 	// needing to know the full Stremio manifest schema.
 	var manifest map[string]interface{}
 	if err := json.Unmarshal(data, &manifest); err != nil {
-		fmt.Printf("wrapper: parse manifest from %s: %v\n", addon.OriginalURL, err)
+		fmt.Printf("wrapper: parse manifest from %s: %v\n", RedactURL(addon.OriginalURL), err)
 		c.Status(http.StatusBadGateway)
 		c.Set("Content-Type", "application/json")
 		c.SendString(`{"error":"failed to parse original manifest"}`)
 		return
 	}
 
-	// Capture original name before we modify anything.
-	originalName := ""
-	if name, ok := manifest["name"].(string); ok {
-		originalName = name
-	}
-
-	// Rebrand: prefix the ID and name so it's clear this goes through the bridge.
-	if origID, ok := manifest["id"].(string); ok {
-		manifest["id"] = "com.yundera.bridge." + origID
-	}
-	if name, ok := manifest["name"].(string); ok {
-		manifest["name"] = "[Torrent-Bridge] " + name
+	// Cache the upstream manifest so future requests work even when
+	// upstream is unreachable (Cloudflare blocking datacenter IP), including
+	// after a restart. Overrides are applied on every request, so edits take
+	// effect without a refetch.
+	if fresh {
+		w.manifests.put(wrapID, data)
 	}
 
-	// Remove behaviorHints to prevent Stremio from showing config prompts.
-	delete(manifest, "behaviorHints")
+	originalName := RebrandManifest(manifest, addon.Overrides)
 
 	// If the store doesn't have a name yet, persist the original name.
 	if addon.Name == "" && originalName != "" {
@@ -129,6 +204,14 @@ func (w *Wrapper) HandleManifest(c *fiber.Ctx) {
 		}
 	}
 
+	// Remember the id Stremio installed the addon under, so the disabled
+	// manifest keeps it even when no upstream manifest is cached.
+	if id, ok := manifest["id"].(string); ok && id != "" && id != addon.ManifestID {
+		if err := w.store.UpdateManifestID(wrapID, id); err != nil {
+			fmt.Printf("wrapper: update manifest id for %s: %v\n", wrapID, err)
+		}
+	}
+
 	out, err := json.Marshal(manifest)
 	if err != nil {
 		fmt.Printf("wrapper: marshal modified manifest: %v\n", err)
@@ -138,23 +221,74 @@ func (w *Wrapper) HandleManifest(c *fiber.Ctx) {
 		return
 	}
 
-	// Cache the modified manifest so future requests work even when
-	// upstream is unreachable (Cloudflare blocking datacenter IP).
-	w.manifestMu.Lock()
-	w.manifestCache[wrapID] = out
-	w.manifestMu.Unlock()
+	c.Set("Content-Type", "application/json")
+	c.Send(out)
+}
+
+// sendDisabledManifest answers for a disabled addon with a valid manifest that
+// declares no resources, so Stremio keeps the addon installed but never asks
+// it for anything. The upstream isn't contacted; the id is the one last
+// served, and the cached manifest supplies the version when available.
+func (w *Wrapper) sendDisabledManifest(c *fiber.Ctx, addon *WrappedAddon) {
+	id := addon.ManifestID
+	if id == "" {
+		id = bridgeIDPrefix + addon.ID
+	}
+	version := "0.0.0"
+	if cached := w.manifests.get(addon.ID); cached != nil {
+		var upstream struct {
+			ID      string `json:"id"`
+			Version string `json:"version"`
+		}
+		if json.Unmarshal(cached.Data, &upstream) == nil {
+			if addon.ManifestID == "" && upstream.ID != "" {
+				id = bridgeIDPrefix + strings.TrimPrefix(upstream.ID, bridgeIDPrefix)
+			}
+			if upstream.Version != "" {
+				version = upstream.Version
+			}
+		}
+	}
+
+	name := addon.Name
+	if addon.Overrides != nil && addon.Overrides.Name != "" {
+		name = addon.Overrides.Name
+	}
 
+	out, _ := json.Marshal(map[string]interface{}{
+		"id":          id,
+		"version":     version,
+		"name":        bridgeNamePrefix + name + " (disabled)",
+		"description": "This addon is disabled in the Torrent Bridge.",
+		"resources":   []string{},
+		"types":       []string{},
+		"catalogs":    []interface{}{},
+	})
 	c.Set("Content-Type", "application/json")
 	c.Send(out)
 }
 
-// HandleCatalog proxies a catalog request to the original addon.
+// resourceFallbacks is the empty-but-valid body returned for each standard
+// Stremio resource when the upstream fetch fails, so clients don't error out.
+var resourceFallbacks = map[string]string{
+	"catalog":       `{"metas":[]}`,
+	"meta":          `{"meta":{}}`,
+	"stream":        `{"streams":[]}`,
+	"subtitles":     `{"subtitles":[]}`,
+	"addon_catalog": `{"addons":[]}`,
+}
+
+// HandleResource proxies any resource request the upstream manifest declares
+// (catalog, meta, subtitles, addon_catalog, ...) to the original addon
+// unchanged, using the addon's fetch method. The resource path is forwarded
+// verbatim so extra-args segments like "top/search=x.json" keep their
+// original encoding.
 //
-// Route: GET /wrap/:wrapId/catalog/:type/:catalogId.json
-func (w *Wrapper) HandleCatalog(c *fiber.Ctx) {
+// Route: GET /wrap/:wrapId/:resource/:type/:id[/:extra].json
+func (w *Wrapper) HandleResource(c *fiber.Ctx) {
 	wrapID := param(c, "wrapId")
-	contentType := param(c, "type")
-	catalogID := param(c, "catalogId")
+	resource := param(c, "resource")
+	resourcePath := param(c, "resourcePath") // e.g. "movie/top/search=x.json"
 
 	addon, found := w.store.Get(wrapID)
 	if !found {
@@ -164,43 +298,31 @@ func (w *Wrapper) HandleCatalog(c *fiber.Ctx) {
 		return
 	}
 
-	originalURL := getBaseURL(addon.OriginalURL) + "/catalog/" + contentType + "/" + catalogID + ".json"
-
-	data, err := w.fetchForAddon(wrapID, originalURL)
-	if err != nil {
-		fmt.Printf("wrapper: fetch catalog from %s: %v\n", originalURL, err)
+	if !w.declaresResource(wrapID, resource) {
+		c.Status(http.StatusNotFound)
 		c.Set("Content-Type", "application/json")
-		c.SendString(`{"metas":[]}`)
+		c.SendString(`{"error":"resource not provided by this addon"}`)
 		return
 	}
 
-	c.Set("Content-Type", "application/json")
-	c.Send(data)
-}
-
-// HandleMeta proxies a meta request to the original addon.
-//
-// Route: GET /wrap/:wrapId/meta/:type/:metaId.json
-func (w *Wrapper) HandleMeta(c *fiber.Ctx) {
-	wrapID := param(c, "wrapId")
-	contentType := param(c, "type")
-	metaID := param(c, "metaId")
+	fallback, ok := resourceFallbacks[resource]
+	if !ok {
+		fallback = `{}`
+	}
 
-	addon, found := w.store.Get(wrapID)
-	if !found {
-		c.Status(http.StatusNotFound)
+	if addon.Disabled || !addon.Overrides.allowsResource(resource, resourcePath) {
 		c.Set("Content-Type", "application/json")
-		c.SendString(`{"error":"addon not found"}`)
+		c.SendString(fallback)
 		return
 	}
 
-	originalURL := getBaseURL(addon.OriginalURL) + "/meta/" + contentType + "/" + metaID + ".json"
+	originalURL := getBaseURL(addon.OriginalURL) + "/" + resource + "/" + resourcePath
 
 	data, err := w.fetchForAddon(wrapID, originalURL)
 	if err != nil {
-		fmt.Printf("wrapper: fetch meta from %s: %v\n", originalURL, err)
+		fmt.Printf("wrapper: fetch %s from %s: %v\n", resource, RedactURL(originalURL), err)
 		c.Set("Content-Type", "application/json")
-		c.SendString(`{"meta":{}}`)
+		c.SendString(fallback)
 		return
 	}
 
@@ -208,6 +330,21 @@ func (w *Wrapper) HandleMeta(c *fiber.Ctx) {
 	c.Send(data)
 }
 
+// declaresResource reports whether the addon's cached manifest lists the given
+// resource. When no manifest is cached yet we can't tell, so the request is
+// allowed through -- Stremio only asks for resources it saw in the manifest.
+func (w *Wrapper) declaresResource(wrapID, resource string) bool {
+	cached := w.manifests.get(wrapID)
+	if cached == nil {
+		return true
+	}
+	resources := declaredResources(cached.Data)
+	if resources == nil {
+		return true
+	}
+	return resources[resource]
+}
+
 // HandleStream fetches stream results from the original addon, registers any
 // torrents with the local engine, and rewrites infoHash-based streams to point
 // at our direct HTTP stream proxy endpoint.
@@ -226,12 +363,28 @@ func (w *Wrapper) HandleStream(c *fiber.Ctx) {
 		return
 	}
 
+	if addon.Disabled || !addon.Overrides.allowsResource("stream", contentType+"/"+streamID+".json") {
+		c.Set("Content-Type", "application/json")
+		c.SendString(`{"streams":[]}`)
+		return
+	}
+
 	originalURL := getBaseURL(addon.OriginalURL) + "/stream/" + contentType + "/" + streamID + ".json"
 
 	data, err := w.fetchForAddon(wrapID, originalURL)
 	if err != nil {
-		fmt.Printf("wrapper: fetch streams from %s: %v\n", originalURL, err)
+		fmt.Printf("wrapper: fetch streams from %s: %v\n", RedactURL(originalURL), err)
 		c.Set("Content-Type", "application/json")
+		if w.config.PlaceholderStreams {
+			relayConnected := w.relay != nil && w.relay.Connected()
+			if reason, msg := DiagnoseFetchFailure(err, w.resolveEffectiveMethod(wrapID), relayConnected); reason != "" {
+				out, _ := json.Marshal(map[string]interface{}{
+					"streams": []interface{}{placeholderStream(w.resolveExternalURL(c), reason, msg)},
+				})
+				c.Send(out)
+				return
+			}
+		}
 		c.SendString(`{"streams":[]}`)
 		return
 	}
@@ -239,7 +392,7 @@ func (w *Wrapper) HandleStream(c *fiber.Ctx) {
 	// Parse the upstream response as generic JSON.
 	var resp map[string]interface{}
 	if err := json.Unmarshal(data, &resp); err != nil {
-		fmt.Printf("wrapper: parse stream response from %s: %v\n", originalURL, err)
+		fmt.Printf("wrapper: parse stream response from %s: %v\n", RedactURL(originalURL), err)
 		c.Set("Content-Type", "application/json")
 		c.SendString(`{"streams":[]}`)
 		return
@@ -260,6 +413,10 @@ func (w *Wrapper) HandleStream(c *fiber.Ctx) {
 	}
 
 	externalBase := w.resolveExternalURL(c)
+	var infoHashes []string
+	streamHashes := make([]string, len(streams)) // infoHash by stream index
+	streamFiles := make([]int, len(streams))     // file index by stream index
+	trackers := make(map[string][]string)        // infoHash -> tracker URLs, for scraping
 
 	for i, raw := range streams {
 		item, ok := raw.(map[string]interface{})
@@ -269,6 +426,11 @@ func (w *Wrapper) HandleStream(c *fiber.Ctx) {
 
 		infoHash, ok := item["infoHash"].(string)
 		if !ok || infoHash == "" {
+			// Plain url streams (debrid, direct HTTP) are optionally routed
+			// through the HTTP passthrough for CORS and proxyHeaders support.
+			if w.passthrough != nil {
+				w.rewriteURLStream(item, externalBase)
+			}
 			continue
 		}
 
@@ -278,18 +440,20 @@ func (w *Wrapper) HandleStream(c *fiber.Ctx) {
 			for _, s := range sources {
 				if tracker, ok := s.(string); ok {
 					magnetURI += "&tr=" + url.QueryEscape(tracker)
+					if u := scrape.TrackerURL(tracker); u != "" {
+						trackers[strings.ToLower(infoHash)] = append(trackers[strings.ToLower(infoHash)], u)
+					}
 				}
 			}
 		}
 
-		// Fire-and-forget: pre-warm the torrent metadata so the engine has it
-		// ready when the user clicks play. No file data is downloaded here --
-		// actual downloading begins in StreamFile when playback is requested.
-		go func(magnet string) {
-			if _, err := w.engine.PreloadTorrent(context.Background(), magnet); err != nil {
-				fmt.Printf("wrapper: background preload torrent: %v\n", err)
-			}
-		}(magnetURI)
+		// Queue a metadata pre-warm for the top-ranked streams so the engine
+		// has them ready when the user clicks play. No file data is downloaded
+		// here -- actual downloading begins in StreamFile when playback is
+		// requested.
+		if w.preloader != nil && i < w.config.PreloadLimit {
+			w.preloader.Enqueue(magnetURI, i)
+		}
 
 		// Determine the file index within the torrent.
 		fileIdx := 0
@@ -297,6 +461,10 @@ func (w *Wrapper) HandleStream(c *fiber.Ctx) {
 			fileIdx = int(fi)
 		}
 
+		infoHashes = append(infoHashes, strings.ToLower(infoHash))
+		streamHashes[i] = strings.ToLower(infoHash)
+		streamFiles[i] = fileIdx
+
 		// Replace the infoHash stream with a direct HTTP URL to our proxy.
 		delete(item, "infoHash")
 		delete(item, "fileIdx")
@@ -311,8 +479,53 @@ func (w *Wrapper) HandleStream(c *fiber.Ctx) {
 		streams[i] = item
 	}
 
+	// Torrent streams can't play while the engine is down; say so instead.
+	engineDown := false
+	if w.config.PlaceholderStreams && len(infoHashes) > 0 {
+		if err := w.engineReachable(); err != nil {
+			fmt.Printf("wrapper: engine unreachable, replacing torrent streams: %v\n", err)
+			streams = w.engineOfflineStreams(streams, streamHashes, externalBase)
+			engineDown = true
+		}
+	}
+
+	// Otherwise scrape the trackers for live swarm sizes while asking the
+	// engine which torrents it already holds, then restore the video hints
+	// and annotate the streams.
+	if len(infoHashes) > 0 && !engineDown {
+		var swarms map[string]scrape.Result
+		scraped := make(chan struct{})
+		go func() {
+			defer close(scraped)
+			if w.scraper != nil && len(trackers) > 0 {
+				swarms = w.scrapeSwarms(trackers)
+			}
+		}()
+
+		torrents := w.engineTorrents(streamHashes)
+		var progress map[string]float64
+		if w.config.InstantBadges {
+			progress = torrentProgress(torrents)
+		}
+		<-scraped
+
+		w.fillVideoHints(streams, streamHashes, streamFiles, torrents)
+		if w.config.ProbeTitles {
+			w.describeTracks(streams, streamHashes, streamFiles, torrents)
+		}
+		if len(swarms) > 0 {
+			streams, streamHashes = w.annotateSwarms(streams, streamHashes, swarms, progress)
+		}
+		if len(progress) > 0 {
+			streams = w.markInstant(streams, streamHashes, progress)
+		}
+	}
+
 	resp["streams"] = streams
 
+	// Remember which item these torrents belong to, for the cached catalog.
+	w.origins.record(wrapID, contentType, streamID, infoHashes)
+
 	out, err := json.Marshal(resp)
 	if err != nil {
 		fmt.Printf("wrapper: marshal modified streams: %v\n", err)
@@ -326,11 +539,106 @@ func (w *Wrapper) HandleStream(c *fiber.Ctx) {
 	c.Send(out)
 }
 
+// rewriteURLStream points a plain HTTP(S) url stream at the bridge's
+// passthrough endpoint, moving any behaviorHints.proxyHeaders into the signed
+// token so they are applied server-side. Non-HTTP urls are left untouched.
+func (w *Wrapper) rewriteURLStream(item map[string]interface{}, externalBase string) {
+	rawURL, ok := item["url"].(string)
+	if !ok || !(strings.HasPrefix(rawURL, "http://") || strings.HasPrefix(rawURL, "https://")) {
+		return
+	}
+
+	var reqHeaders, respHeaders map[string]string
+	filename := ""
+	hints, _ := item["behaviorHints"].(map[string]interface{})
+	if hints != nil {
+		if ph, ok := hints["proxyHeaders"].(map[string]interface{}); ok {
+			reqHeaders = stringMap(ph["request"])
+			respHeaders = stringMap(ph["response"])
+		}
+		if fn, ok := hints["filename"].(string); ok {
+			filename = fn
+		}
+	}
+
+	token, err := w.passthrough.Token(rawURL, reqHeaders, respHeaders)
+	if err != nil {
+		fmt.Printf("wrapper: passthrough token for %s: %v\n", RedactURL(rawURL), err)
+		return
+	}
+
+	streamURL := externalBase + "/stream/http/" + token
+	if filename != "" {
+		streamURL += "/" + url.PathEscape(filename)
+	}
+	item["url"] = streamURL
+
+	if hints != nil {
+		delete(hints, "proxyHeaders")
+	}
+
+	if title, ok := item["title"].(string); ok {
+		item["title"] = title + " [Torrent-Bridge]"
+	}
+}
+
+// stringMap converts a decoded JSON object to a map of string values,
+// skipping non-string entries. Returns nil for anything that isn't an object.
+func stringMap(v interface{}) map[string]string {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	result := make(map[string]string, len(obj))
+	for k, val := range obj {
+		if s, ok := val.(string); ok {
+			result[k] = s
+		}
+	}
+	return result
+}
+
 // HasCachedManifest returns true if a modified manifest is cached for the given addon.
 func (w *Wrapper) HasCachedManifest(wrapID string) bool {
-	w.manifestMu.RLock()
-	defer w.manifestMu.RUnlock()
-	return w.manifestCache[wrapID] != nil
+	return w.manifests.get(wrapID) != nil
+}
+
+// CachedManifestTime returns when the cached manifest for the given addon was
+// last fetched from upstream, and false if no manifest is cached.
+func (w *Wrapper) CachedManifestTime(wrapID string) (time.Time, bool) {
+	cached := w.manifests.get(wrapID)
+	if cached == nil {
+		return time.Time{}, false
+	}
+	return cached.FetchedAt, true
+}
+
+// declaredResources returns the set of resource names listed in a manifest's
+// "resources" array, which may mix plain strings and {"name": ...} objects.
+// Returns nil if the manifest can't be parsed.
+func declaredResources(manifest []byte) map[string]bool {
+	var m struct {
+		Resources []json.RawMessage `json:"resources"`
+	}
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return nil
+	}
+
+	result := make(map[string]bool, len(m.Resources))
+	for _, raw := range m.Resources {
+		var name string
+		if err := json.Unmarshal(raw, &name); err == nil {
+			result[name] = true
+			continue
+		}
+		var obj struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(raw, &obj); err == nil && obj.Name != "" {
+			result[obj.Name] = true
+		}
+	}
+	return result
 }
 
 // getBaseURL strips the /manifest.json suffix (and any query string) from a
@@ -376,22 +684,101 @@ func (w *Wrapper) resolveEffectiveMethod(addonID string) string {
 	return method
 }
 
-// fetchForAddon fetches JSON from a URL using the effective fetch method for
-// the given addon. It routes to direct fetch, relay, or falls back as needed.
+// fetchForAddon fetches JSON from a URL for the given addon. It starts with
+// the addon's last working (or configured) fetch method and falls back through
+// the remaining methods on failure.
+//
+// Concurrent identical requests (same addon and URL) share one upstream call.
 func (w *Wrapper) fetchForAddon(addonID, rawURL string) ([]byte, error) {
-	method := w.resolveEffectiveMethod(addonID)
-
-	switch method {
-	case FetchMethodTabRelay:
-		return w.fetchViaRelay(rawURL)
-	case FetchMethodDirect:
-		return w.fetchJSON(rawURL)
-	case FetchMethodProxy:
-		// TODO: proxy support will be added later
-		return w.fetchJSON(rawURL)
-	default:
-		return w.fetchJSON(rawURL)
+	return w.coalesce.do(addonID, rawURL, func() ([]byte, error) {
+		data, err := w.fetchWithFallback(addonID, rawURL)
+		if err == nil {
+			w.stale.put(addonID, rawURL, data)
+			return data, nil
+		}
+
+		// Rate limited: answer with the last good response if we have one
+		// rather than returning nothing.
+		if errors.Is(err, ErrRateLimited) {
+			if cached, fetchedAt, ok := w.stale.get(addonID, rawURL); ok {
+				fmt.Printf("wrapper: %s rate limited, serving response from %s ago\n",
+					addonID, time.Since(fetchedAt).Round(time.Second))
+				return cached, nil
+			}
+		}
+		return nil, err
+	})
+}
+
+// fetchForAddonContext is fetchForAddon bounded by ctx. The upstream call
+// may be shared with other requests, so it is not cancelled; the caller just
+// stops waiting for it, and a late result still lands in the stale cache.
+func (w *Wrapper) fetchForAddonContext(ctx context.Context, addonID, rawURL string) ([]byte, error) {
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := w.fetchForAddon(addonID, rawURL)
+		done <- result{data, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// CoalesceStats returns the global and per-addon request coalescing counters.
+func (w *Wrapper) CoalesceStats() (CoalesceStats, map[string]CoalesceStats) {
+	return w.coalesce.snapshot()
+}
+
+// fetchViaProxy fetches through the addon's proxy, or the global PROXY_URL
+// when the addon doesn't set its own.
+func (w *Wrapper) fetchViaProxy(addonID, rawURL string) ([]byte, error) {
+	proxyURL := w.proxyURLFor(addonID)
+	if proxyURL == "" {
+		return nil, fmt.Errorf("proxy: no proxy URL configured")
+	}
+
+	client, err := w.proxyClient(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	return w.fetchJSON(client, rawURL)
+}
+
+// proxyURLFor returns the proxy an addon should use: its own ProxyURL, or
+// the global PROXY_URL.
+func (w *Wrapper) proxyURLFor(addonID string) string {
+	if addon, found := w.store.Get(addonID); found && addon.ProxyURL != "" {
+		return addon.ProxyURL
+	}
+	return w.config.ProxyURL
+}
+
+// proxyClient returns the pooled HTTP client for a proxy URL, creating it on
+// first use.
+func (w *Wrapper) proxyClient(proxyURL string) (*http.Client, error) {
+	w.proxyMu.Lock()
+	defer w.proxyMu.Unlock()
+
+	if client, ok := w.proxyClients[proxyURL]; ok {
+		return client, nil
+	}
+
+	u, err := httpclient.ParseProxyURL(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %w", err)
 	}
+
+	client := httpclient.NewWithProxy(u)
+	w.proxyClients[proxyURL] = client
+	return client, nil
 }
 
 // fetchViaRelay sends the fetch request to the connected browser tab.
@@ -403,33 +790,78 @@ func (w *Wrapper) fetchViaRelay(rawURL string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	if statusCode < 200 || statusCode >= 300 {
-		return nil, fmt.Errorf("relay: unexpected status %d from %s", statusCode, rawURL)
+	if err := classifyResponse(rawURL, statusCode, nil, data); err != nil {
+		return nil, fmt.Errorf("relay: %w", err)
 	}
 	return data, nil
 }
 
-// fetchJSON performs a GET request and returns the response body as bytes.
-func (w *Wrapper) fetchJSON(rawURL string) ([]byte, error) {
-	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+// fetchJSON performs a GET request with the given client and returns the
+// response body as bytes. Non-JSON and non-2xx responses are returned as a
+// classified *UpstreamError.
+func (w *Wrapper) fetchJSON(client *http.Client, rawURL string) ([]byte, error) {
+	return w.fetchJSONContext(context.Background(), client, rawURL)
+}
+
+// fetchJSONContext is fetchJSON with a caller-supplied context.
+func (w *Wrapper) fetchJSONContext(ctx context.Context, client *http.Client, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 
-	resp, err := w.httpClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
+		// *url.Error embeds the full URL, which may carry an API key.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = RedactURL(urlErr.URL)
+		}
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, rawURL)
-	}
-
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("read response: %w", err)
 	}
 
+	if err := classifyResponse(rawURL, resp.StatusCode, resp.Header, data); err != nil {
+		return nil, err
+	}
+
 	return data, nil
 }
+
+// FetchManifest fetches an upstream manifest through the same fetch method
+// chain its wrapped addon would use and lints it. The raw manifest and report
+// are returned even when the manifest is rejected so callers can show what
+// was found.
+func (w *Wrapper) FetchManifest(originalURL string) ([]byte, *ManifestReport, error) {
+	data, err := w.fetchForAddon(AddonID(originalURL), originalURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	report, err := LintManifest(data)
+	return data, report, err
+}
+
+// ProbeDirect fetches an addon URL directly from the server (no proxy or
+// relay) and returns the classified error, if any. The probe counts against
+// the direct egress rate limit like any other fetch, and a host that is
+// backing off is reported as rate limited without being contacted. Used by
+// the health check.
+func (w *Wrapper) ProbeDirect(ctx context.Context, addonID, rawURL string) error {
+	deadline := time.Now().Add(w.limiter.queueTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	key := limiterKey(w.egressFor(addonID, FetchMethodDirect), rawURL)
+	if err := w.limiter.acquireBy(key, w.rateLimitFor(addonID), deadline); err != nil {
+		return err
+	}
+
+	_, err := w.fetchJSONContext(ctx, w.directClientFor(addonID), rawURL)
+	w.limiter.report(key, err)
+	return err
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/addon"
+	"github.com/krizcold/stremio-torrent-bridge/internal/cache"
+	"github.com/krizcold/stremio-torrent-bridge/internal/config"
+	"github.com/krizcold/stremio-torrent-bridge/internal/engine"
+	"github.com/krizcold/stremio-torrent-bridge/pkg/httpclient"
+)
+
+// Backup archive identification. Bump backupVersion when the layout changes
+// incompatibly; restore accepts any version up to the current one.
+const (
+	backupFormat  = "stremio-torrent-bridge-backup"
+	backupVersion = 1
+)
+
+// backupArchive is the body of GET /api/backup and POST /api/restore.
+// Addon URLs are included in plain text (they are needed to recreate the
+// wrapped addons on another host), so the archive should be kept private.
+type backupArchive struct {
+	Format    string               `json:"format"`
+	Version   int                  `json:"version"`
+	CreatedAt time.Time            `json:"createdAt"`
+	Addons    []addon.WrappedAddon `json:"addons"`
+	Config    config.RuntimeConfig `json:"config"`
+	AccessLog []cache.AccessEntry  `json:"accessLog"`
+	// StreamOrigins records which addon and item each cached torrent was
+	// listed for, so cached torrents keep showing as Stremio items.
+	StreamOrigins []addon.StreamOrigin `json:"streamOrigins"`
+	// Magnets are the magnet URIs of streams the engine was not given yet
+	// (qBittorrent only); without them those streams can't start.
+	Magnets []engine.MagnetEntry `json:"magnets"`
+}
+
+// HandleBackup handles GET /api/backup.
+// It returns the bridge state (addons with their overrides, runtime config,
+// cache access log, stream origins and the engine's magnet registry) as a
+// versioned JSON archive download.
+func (h *Handlers) HandleBackup(c *fiber.Ctx) {
+	archive := backupArchive{
+		Format:    backupFormat,
+		Version:   backupVersion,
+		CreatedAt: time.Now().UTC(),
+		Addons:    h.store.Snapshot(),
+		Config:    h.config.Runtime(),
+		AccessLog: []cache.AccessEntry{},
+	}
+	if h.cacheManager != nil {
+		archive.AccessLog = h.cacheManager.GetStats().Torrents
+	}
+	archive.StreamOrigins = []addon.StreamOrigin{}
+	if h.wrapper != nil {
+		archive.StreamOrigins = h.wrapper.StreamOrigins()
+	}
+	archive.Magnets = []engine.MagnetEntry{}
+	if reg, ok := h.engine.(engine.MagnetRegistry); ok {
+		archive.Magnets = reg.Magnets()
+	}
+
+	out, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		c.Set("Content-Type", "application/json")
+		c.SendString(`{"error":"failed to encode backup"}`)
+		return
+	}
+
+	filename := "bridge-backup-" + archive.CreatedAt.Format("20060102-150405") + ".json"
+	c.Set("Content-Type", "application/json")
+	c.Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Send(out)
+}
+
+// HandleRestore handles POST /api/restore.
+// It validates a backup archive completely before applying anything, then
+// replaces addons, cache access log, stream origins, magnet registry and
+// runtime config. If any step fails the
+// earlier steps are rolled back, so the bridge is never left half-restored.
+func (h *Handlers) HandleRestore(c *fiber.Ctx) {
+	var archive backupArchive
+	if err := json.Unmarshal([]byte(c.Body()), &archive); err != nil {
+		c.Status(http.StatusBadRequest)
+		c.Set("Content-Type", "application/json")
+		c.SendString(`{"error":"invalid JSON body"}`)
+		return
+	}
+
+	if err := validateBackup(&archive); err != nil {
+		c.Status(http.StatusBadRequest)
+		c.Set("Content-Type", "application/json")
+		errJSON, _ := json.Marshal(map[string]string{"error": "invalid backup: " + err.Error()})
+		c.Send(errJSON)
+		return
+	}
+
+	prevAddons := h.store.Snapshot()
+	var prevOrigins []addon.StreamOrigin
+	if h.wrapper != nil {
+		prevOrigins = h.wrapper.StreamOrigins()
+	}
+	reg, hasMagnets := h.engine.(engine.MagnetRegistry)
+	var prevMagnets []engine.MagnetEntry
+	if hasMagnets {
+		prevMagnets = reg.Magnets()
+	}
+	prevConfig := h.config.Runtime()
+	var prevAccess []cache.AccessEntry
+	if h.cacheManager != nil {
+		prevAccess = h.cacheManager.GetStats().Torrents
+	}
+
+	fail := func(step string, err error) {
+		fmt.Printf("handlers: restore %s: %v (rolling back)\n", step, err)
+		if rbErr := h.store.Replace(prevAddons); rbErr != nil {
+			fmt.Printf("handlers: roll back addons: %v\n", rbErr)
+		}
+		if h.cacheManager != nil {
+			if rbErr := h.cacheManager.ReplaceAccessLog(prevAccess); rbErr != nil {
+				fmt.Printf("handlers: roll back access log: %v\n", rbErr)
+			}
+		}
+		if h.wrapper != nil {
+			if rbErr := h.wrapper.ReplaceStreamOrigins(prevOrigins); rbErr != nil {
+				fmt.Printf("handlers: roll back stream origins: %v\n", rbErr)
+			}
+		}
+		if hasMagnets {
+			if rbErr := reg.ReplaceMagnets(prevMagnets); rbErr != nil {
+				fmt.Printf("handlers: roll back magnets: %v\n", rbErr)
+			}
+		}
+		h.config.ApplyRuntime(prevConfig)
+		c.Status(http.StatusInternalServerError)
+		c.Set("Content-Type", "application/json")
+		errJSON, _ := json.Marshal(map[string]string{"error": "failed to restore " + step})
+		c.Send(errJSON)
+	}
+
+	if err := h.store.Replace(archive.Addons); err != nil {
+		fail("addons", err)
+		return
+	}
+	if h.cacheManager != nil {
+		if err := h.cacheManager.ReplaceAccessLog(archive.AccessLog); err != nil {
+			fail("access log", err)
+			return
+		}
+	}
+	if h.wrapper != nil {
+		if err := h.wrapper.ReplaceStreamOrigins(archive.StreamOrigins); err != nil {
+			fail("stream origins", err)
+			return
+		}
+	}
+	if hasMagnets {
+		if err := reg.ReplaceMagnets(archive.Magnets); err != nil {
+			fail("magnets", err)
+			return
+		}
+	}
+	h.config.ApplyRuntime(archive.Config)
+	if err := h.config.SaveRuntime(); err != nil {
+		fail("config", err)
+		return
+	}
+	if h.wrapper != nil {
+		h.wrapper.ForgetRemovedAddons()
+	}
+
+	fmt.Printf("handlers: restored backup from %s (%d addons, %d access entries, %d stream origins, %d magnets)\n",
+		archive.CreatedAt.Format(time.RFC3339), len(archive.Addons), len(archive.AccessLog), len(archive.StreamOrigins), len(archive.Magnets))
+
+	out, _ := json.Marshal(map[string]interface{}{
+		"success":       true,
+		"addons":        len(archive.Addons),
+		"accessLog":     len(archive.AccessLog),
+		"streamOrigins": len(archive.StreamOrigins),
+		"magnets":       len(archive.Magnets),
+	})
+	c.Set("Content-Type", "application/json")
+	c.Send(out)
+}
+
+// validateBackup checks an archive before anything is applied and fills in
+// defaults for fields older versions didn't have.
+func validateBackup(a *backupArchive) error {
+	if a.Format != backupFormat {
+		return fmt.Errorf("format must be %q", backupFormat)
+	}
+	if a.Version < 1 || a.Version > backupVersion {
+		return fmt.Errorf("unsupported version %d (this bridge supports up to %d)", a.Version, backupVersion)
+	}
+
+	seen := make(map[string]bool, len(a.Addons))
+	for i := range a.Addons {
+		ad := &a.Addons[i]
+		u, err := url.Parse(ad.OriginalURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("addon %s: originalUrl must be an http(s) URL", ad.ID)
+		}
+		// Wrapped URLs installed in Stremio contain the ID, so it must match.
+		if ad.ID != addon.AddonID(ad.OriginalURL) {
+			return fmt.Errorf("addon %s: id does not match its originalUrl", ad.ID)
+		}
+		if seen[ad.ID] {
+			return fmt.Errorf("addon %s listed more than once", ad.ID)
+		}
+		seen[ad.ID] = true
+
+		if ad.FetchMethod == "" {
+			ad.FetchMethod = addon.FetchMethodGlobal
+		}
+		if !addon.ValidFetchMethods[ad.FetchMethod] {
+			return fmt.Errorf("addon %s: invalid fetchMethod %q", ad.ID, ad.FetchMethod)
+		}
+		if ad.FetchStatus == "" {
+			ad.FetchStatus = addon.FetchStatusUnknown
+		}
+		if ad.ProxyURL != "" {
+			if _, err := httpclient.ParseProxyURL(ad.ProxyURL); err != nil {
+				return fmt.Errorf("addon %s: proxyUrl: %w", ad.ID, err)
+			}
+		}
+		if ad.RateLimit < 0 {
+			return fmt.Errorf("addon %s: rateLimitPerMinute must not be negative", ad.ID)
+		}
+		overrides, err := addon.NormalizeOverrides(ad.Overrides)
+		if err != nil {
+			return fmt.Errorf("addon %s: overrides: %w", ad.ID, err)
+		}
+		ad.Overrides = overrides
+	}
+
+	r := a.Config
+	switch r.DefaultEngine {
+	case "", "torrserver", "rqbit", "qbittorrent":
+	default:
+		return errors.New("config.defaultEngine must be one of: torrserver, rqbit, qbittorrent")
+	}
+	if r.DefaultFetchMethod != "" && !addon.ValidGlobalFetchMethods[r.DefaultFetchMethod] {
+		return errors.New("config.defaultFetchMethod must be one of: tab_relay, direct, proxy")
+	}
+	if r.ProxyURL != "" {
+		if _, err := httpclient.ParseProxyURL(r.ProxyURL); err != nil {
+			return fmt.Errorf("config.proxyURL: %w", err)
+		}
+	}
+	if r.CacheSizeGB < 0 || r.CacheMaxAgeDays < 0 {
+		return errors.New("config cache limits must be positive")
+	}
+
+	for _, e := range a.AccessLog {
+		if e.InfoHash == "" {
+			return errors.New("accessLog entry without infoHash")
+		}
+	}
+	for _, o := range a.StreamOrigins {
+		if o.InfoHash == "" || o.AddonID == "" {
+			return errors.New("streamOrigins entry without infoHash or addonId")
+		}
+	}
+	for _, m := range a.Magnets {
+		if m.InfoHash == "" || !strings.HasPrefix(m.MagnetURI, "magnet:?") {
+			return fmt.Errorf("magnets entry %q: needs an infoHash and a magnet: URI", m.InfoHash)
+		}
+	}
+
+	return nil
+}
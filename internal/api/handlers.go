@@ -3,9 +3,13 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gofiber/fiber"
@@ -14,7 +18,9 @@ import (
 	"github.com/krizcold/stremio-torrent-bridge/internal/cache"
 	"github.com/krizcold/stremio-torrent-bridge/internal/config"
 	"github.com/krizcold/stremio-torrent-bridge/internal/engine"
+	"github.com/krizcold/stremio-torrent-bridge/internal/probe"
 	"github.com/krizcold/stremio-torrent-bridge/internal/relay"
+	"github.com/krizcold/stremio-torrent-bridge/pkg/httpclient"
 )
 
 // Handlers groups the HTTP handlers for the management REST API.
@@ -25,10 +31,11 @@ type Handlers struct {
 	cacheManager *cache.CacheManager // may be nil
 	wrapper      *addon.Wrapper      // for health check (manifest cache status)
 	relay        *relay.Server       // for health check (relay status)
+	prober       *probe.Prober       // for file track info
 }
 
 // NewHandlers creates a new Handlers instance wired to the given dependencies.
-func NewHandlers(store *addon.AddonStore, cfg *config.Config, eng engine.Engine, cm *cache.CacheManager, w *addon.Wrapper, rs *relay.Server) *Handlers {
+func NewHandlers(store *addon.AddonStore, cfg *config.Config, eng engine.Engine, cm *cache.CacheManager, w *addon.Wrapper, rs *relay.Server, prober *probe.Prober) *Handlers {
 	return &Handlers{
 		store:        store,
 		config:       cfg,
@@ -36,6 +43,7 @@ func NewHandlers(store *addon.AddonStore, cfg *config.Config, eng engine.Engine,
 		cacheManager: cm,
 		wrapper:      w,
 		relay:        rs,
+		prober:       prober,
 	}
 }
 
@@ -46,10 +54,20 @@ type addAddonRequest struct {
 }
 
 type addAddonResponse struct {
-	ID          string `json:"id"`
-	OriginalURL string `json:"originalUrl"`
-	WrappedURL  string `json:"wrappedUrl"`
-	Name        string `json:"name"`
+	ID          string   `json:"id"`
+	OriginalURL string   `json:"originalUrl"`
+	WrappedURL  string   `json:"wrappedUrl"`
+	Name        string   `json:"name"`
+	Resources   []string `json:"resources"`
+	Types       []string `json:"types"`
+	Warnings    []string `json:"warnings"`
+}
+
+// addAddonError is the body returned when an addon can't be registered.
+type addAddonError struct {
+	Error          string   `json:"error"`
+	Classification string   `json:"classification,omitempty"`
+	Problems       []string `json:"problems,omitempty"`
 }
 
 type listAddonItem struct {
@@ -58,8 +76,19 @@ type listAddonItem struct {
 	WrappedURL  string    `json:"wrappedUrl"`
 	Name        string    `json:"name"`
 	FetchMethod string    `json:"fetchMethod"`
+	ProxyURL    string    `json:"proxyUrl,omitempty"`
+	RateLimit   int       `json:"rateLimitPerMinute,omitempty"`
 	FetchStatus string    `json:"fetchStatus"`
 	CreatedAt   time.Time `json:"createdAt"`
+	Enabled     bool      `json:"enabled"`
+	Priority    int       `json:"priority"`
+	AutoWrapped bool      `json:"autoWrapped,omitempty"`
+
+	FetchStatusAt     *time.Time `json:"fetchStatusAt,omitempty"`
+	LastSuccessMethod string     `json:"lastSuccessMethod,omitempty"`
+	SecretsMasked     bool       `json:"secretsMasked,omitempty"` // originalUrl has API keys masked
+
+	Overrides *addon.ManifestOverrides `json:"overrides,omitempty"`
 }
 
 type engineStatus struct {
@@ -85,13 +114,22 @@ type updateConfigRequest struct {
 }
 
 type updateAddonRequest struct {
-	FetchMethod *string `json:"fetchMethod"`
+	FetchMethod *string                  `json:"fetchMethod"`
+	ProxyURL    *string                  `json:"proxyUrl"`
+	RateLimit   *int                     `json:"rateLimitPerMinute"`
+	Overrides   *addon.ManifestOverrides `json:"overrides"` // replaces all overrides; {} clears them
+	Enabled     *bool                    `json:"enabled"`
+}
+
+type reorderAddonsRequest struct {
+	IDs []string `json:"ids"`
 }
 
 // --- addon endpoints ---------------------------------------------------------
 
 // HandleAddAddon handles POST /api/addons.
-// It registers a new upstream Stremio addon and returns its wrapped URL.
+// It fetches and validates the upstream manifest, registers the addon and
+// returns its wrapped URL along with any manifest warnings.
 func (h *Handlers) HandleAddAddon(c *fiber.Ctx) {
 	var req addAddonRequest
 	if err := json.Unmarshal([]byte(c.Body()), &req); err != nil {
@@ -108,7 +146,35 @@ func (h *Handlers) HandleAddAddon(c *fiber.Ctx) {
 		return
 	}
 
-	wrapped, err := h.store.Add(req.ManifestURL)
+	manifestURL := strings.TrimSpace(req.ManifestURL)
+	if u, err := url.Parse(manifestURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		c.Status(http.StatusBadRequest)
+		c.Set("Content-Type", "application/json")
+		c.SendString(`{"error":"manifestUrl must be an http(s) URL"}`)
+		return
+	}
+
+	// Fetch and validate the manifest before registering anything, using the
+	// fetch method chain the wrapped addon will use.
+	_, report, err := h.wrapper.FetchManifest(manifestURL)
+	if err != nil {
+		var manifestErr *addon.ManifestError
+		if errors.As(err, &manifestErr) {
+			writeAddAddonError(c, http.StatusUnprocessableEntity, addAddonError{
+				Error:    "addon manifest is not usable",
+				Problems: manifestErr.Problems,
+			})
+			return
+		}
+		fmt.Printf("handlers: fetch manifest %s: %v\n", addon.RedactURL(manifestURL), err)
+		writeAddAddonError(c, http.StatusBadGateway, addAddonError{
+			Error:          "could not fetch manifest: " + describeFetchError(err),
+			Classification: addon.Classify(err),
+		})
+		return
+	}
+
+	wrapped, err := h.store.Add(manifestURL)
 	if err != nil {
 		c.Status(http.StatusInternalServerError)
 		c.Set("Content-Type", "application/json")
@@ -116,18 +182,25 @@ func (h *Handlers) HandleAddAddon(c *fiber.Ctx) {
 		return
 	}
 
-	// Best-effort: fetch the manifest to populate the addon name immediately.
-	if wrapped.Name == "" {
-		go h.fetchAddonName(wrapped.ID, req.ManifestURL)
+	if wrapped.Name != report.Name {
+		if err := h.store.UpdateName(wrapped.ID, report.Name); err != nil {
+			fmt.Printf("handlers: update addon name for %s: %v\n", wrapped.ID, err)
+		}
 	}
 
 	externalBase := resolveExternalURL(h.config, c)
 
 	resp := addAddonResponse{
 		ID:          wrapped.ID,
-		OriginalURL: wrapped.OriginalURL,
+		OriginalURL: addon.RedactURL(wrapped.OriginalURL),
 		WrappedURL:  externalBase + "/wrap/" + wrapped.ID + "/manifest.json",
-		Name:        wrapped.Name,
+		Name:        report.Name,
+		Resources:   report.Resources,
+		Types:       report.Types,
+		Warnings:    report.Warnings,
+	}
+	if resp.Warnings == nil {
+		resp.Warnings = []string{}
 	}
 
 	out, _ := json.Marshal(resp)
@@ -146,12 +219,23 @@ func (h *Handlers) HandleListAddons(c *fiber.Ctx) {
 	for _, a := range addons {
 		items = append(items, listAddonItem{
 			ID:          a.ID,
-			OriginalURL: a.OriginalURL,
+			OriginalURL: addon.RedactURL(a.OriginalURL),
 			WrappedURL:  externalBase + "/wrap/" + a.ID + "/manifest.json",
 			Name:        a.Name,
 			FetchMethod: a.FetchMethod,
+			ProxyURL:    addon.RedactURL(a.ProxyURL),
+			RateLimit:   a.RateLimit,
 			FetchStatus: a.FetchStatus,
 			CreatedAt:   a.CreatedAt,
+			Enabled:     !a.Disabled,
+			Priority:    a.Priority,
+			AutoWrapped: a.AutoWrapped,
+
+			FetchStatusAt:     a.FetchStatusAt,
+			LastSuccessMethod: a.LastSuccessMethod,
+			SecretsMasked:     addon.HasSecrets(a.OriginalURL),
+
+			Overrides: a.Overrides,
 		})
 	}
 
@@ -171,17 +255,21 @@ func (h *Handlers) HandleRemoveAddon(c *fiber.Ctx) {
 		c.SendString(`{"error":"addon not found"}`)
 		return
 	}
+	if h.wrapper != nil {
+		h.wrapper.ForgetRemovedAddons()
+	}
 
 	c.Set("Content-Type", "application/json")
 	c.SendString(`{"success":true}`)
 }
 
 // HandleUpdateAddon handles PATCH /api/addons/:id.
-// It updates per-addon settings like fetch method.
+// It updates per-addon settings like fetch method and manifest overrides.
 func (h *Handlers) HandleUpdateAddon(c *fiber.Ctx) {
 	id := c.Params("id")
 
-	if _, found := h.store.Get(id); !found {
+	current, found := h.store.Get(id)
+	if !found {
 		c.Status(http.StatusNotFound)
 		c.Set("Content-Type", "application/json")
 		c.SendString(`{"error":"addon not found"}`)
@@ -196,19 +284,96 @@ func (h *Handlers) HandleUpdateAddon(c *fiber.Ctx) {
 		return
 	}
 
-	if req.FetchMethod != nil {
-		if !addon.ValidFetchMethods[*req.FetchMethod] {
+	// Validate every field before changing anything, so a bad field doesn't
+	// leave the ones before it applied.
+	if req.FetchMethod != nil && !addon.ValidFetchMethods[*req.FetchMethod] {
+		c.Status(http.StatusBadRequest)
+		c.Set("Content-Type", "application/json")
+		c.SendString(`{"error":"fetchMethod must be one of: global, tab_relay, direct, proxy"}`)
+		return
+	}
+
+	var proxyURL string
+	if req.ProxyURL != nil {
+		proxyURL = submittedProxyURL(strings.TrimSpace(*req.ProxyURL), current.ProxyURL)
+		if proxyURL != "" {
+			if _, err := httpclient.ParseProxyURL(proxyURL); err != nil {
+				c.Status(http.StatusBadRequest)
+				c.Set("Content-Type", "application/json")
+				errJSON, _ := json.Marshal(map[string]string{"error": "proxyUrl: " + err.Error()})
+				c.Send(errJSON)
+				return
+			}
+		}
+	}
+
+	if req.RateLimit != nil && *req.RateLimit < 0 {
+		c.Status(http.StatusBadRequest)
+		c.Set("Content-Type", "application/json")
+		c.SendString(`{"error":"rateLimitPerMinute must be zero (global default) or positive"}`)
+		return
+	}
+
+	var overrides *addon.ManifestOverrides
+	if req.Overrides != nil {
+		var err error
+		overrides, err = addon.NormalizeOverrides(req.Overrides)
+		if err != nil {
 			c.Status(http.StatusBadRequest)
 			c.Set("Content-Type", "application/json")
-			c.SendString(`{"error":"fetchMethod must be one of: global, tab_relay, direct, proxy"}`)
+			errJSON, _ := json.Marshal(map[string]string{"error": "overrides: " + err.Error()})
+			c.Send(errJSON)
 			return
 		}
-		if err := h.store.UpdateFetchMethod(id, *req.FetchMethod); err != nil {
-			c.Status(http.StatusInternalServerError)
-			c.Set("Content-Type", "application/json")
-			c.SendString(`{"error":"failed to update fetch method"}`)
-			return
+	}
+
+	err := h.store.Update(id, func(a *addon.WrappedAddon) {
+		if req.FetchMethod != nil {
+			a.FetchMethod = *req.FetchMethod
+			// A new explicit choice takes precedence over the remembered method.
+			a.LastSuccessMethod = ""
 		}
+		if req.ProxyURL != nil {
+			a.ProxyURL = proxyURL
+		}
+		if req.RateLimit != nil {
+			a.RateLimit = *req.RateLimit
+		}
+		if req.Overrides != nil {
+			a.Overrides = overrides
+		}
+		if req.Enabled != nil {
+			a.Disabled = !*req.Enabled
+		}
+	})
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		c.Set("Content-Type", "application/json")
+		c.SendString(`{"error":"failed to update addon"}`)
+		return
+	}
+
+	c.Set("Content-Type", "application/json")
+	c.SendString(`{"success":true}`)
+}
+
+// HandleReorderAddons handles PUT /api/addons/order.
+// It sets the addon priority order from a list of addon IDs.
+func (h *Handlers) HandleReorderAddons(c *fiber.Ctx) {
+	var req reorderAddonsRequest
+	if err := json.Unmarshal([]byte(c.Body()), &req); err != nil {
+		c.Status(http.StatusBadRequest)
+		c.Set("Content-Type", "application/json")
+		c.SendString(`{"error":"invalid JSON body"}`)
+		return
+	}
+
+	if err := h.store.Reorder(req.IDs); err != nil {
+		c.Status(http.StatusBadRequest)
+		c.Set("Content-Type", "application/json")
+		errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+		c.Send(errJSON)
+		return
 	}
 
 	c.Set("Content-Type", "application/json")
@@ -250,7 +415,7 @@ func (h *Handlers) HandleGetConfig(c *fiber.Ctx) {
 	resp := configResponse{
 		DefaultEngine:      h.config.DefaultEngine,
 		DefaultFetchMethod: h.config.DefaultFetchMethod,
-		ProxyURL:           h.config.ProxyURL,
+		ProxyURL:           addon.RedactURL(h.config.ProxyURL),
 		CacheSizeGB:        h.config.CacheSizeGB,
 		CacheMaxAgeDays:    h.config.CacheMaxAgeDays,
 		Engines:            engines,
@@ -262,7 +427,7 @@ func (h *Handlers) HandleGetConfig(c *fiber.Ctx) {
 }
 
 // HandleUpdateConfig handles PUT /api/config.
-// It applies partial runtime configuration updates (not persisted to disk).
+// It applies partial runtime configuration updates and persists them to disk.
 func (h *Handlers) HandleUpdateConfig(c *fiber.Ctx) {
 	var req updateConfigRequest
 	if err := json.Unmarshal([]byte(c.Body()), &req); err != nil {
@@ -321,9 +486,23 @@ func (h *Handlers) HandleUpdateConfig(c *fiber.Ctx) {
 		h.config.DefaultFetchMethod = *req.DefaultFetchMethod
 	}
 
-	// Update proxyURL if provided.
+	// Validate proxyURL if provided (empty clears it).
 	if req.ProxyURL != nil {
-		h.config.ProxyURL = *req.ProxyURL
+		proxyURL := submittedProxyURL(strings.TrimSpace(*req.ProxyURL), h.config.ProxyURL)
+		if proxyURL != "" {
+			if _, err := httpclient.ParseProxyURL(proxyURL); err != nil {
+				c.Status(http.StatusBadRequest)
+				c.Set("Content-Type", "application/json")
+				errJSON, _ := json.Marshal(map[string]string{"error": "proxyURL: " + err.Error()})
+				c.Send(errJSON)
+				return
+			}
+		}
+		h.config.ProxyURL = proxyURL
+	}
+
+	if err := h.config.SaveRuntime(); err != nil {
+		fmt.Printf("handlers: save runtime config: %v\n", err)
 	}
 
 	// Return the updated config using the same format as GET /api/config,
@@ -331,7 +510,7 @@ func (h *Handlers) HandleUpdateConfig(c *fiber.Ctx) {
 	resp := configResponse{
 		DefaultEngine:      h.config.DefaultEngine,
 		DefaultFetchMethod: h.config.DefaultFetchMethod,
-		ProxyURL:           h.config.ProxyURL,
+		ProxyURL:           addon.RedactURL(h.config.ProxyURL),
 		CacheSizeGB:        h.config.CacheSizeGB,
 		CacheMaxAgeDays:    h.config.CacheMaxAgeDays,
 		Engines: map[string]*engineStatus{
@@ -421,19 +600,31 @@ func (h *Handlers) HandleRemoveTorrent(c *fiber.Ctx) {
 
 // addonHealthItem is the per-addon health status.
 type addonHealthItem struct {
-	ID              string `json:"id"`
-	Name            string `json:"name"`
-	OriginalURL     string `json:"originalUrl"`
-	FetchMethod     string `json:"fetchMethod"`     // Per-addon setting (may be "global")
-	EffectiveMethod string `json:"effectiveMethod"` // Resolved method
-	DirectReachable bool   `json:"directReachable"` // Can the server fetch the manifest directly?
-	DirectError     string `json:"directError,omitempty"`
-	RelayConnected  bool   `json:"relayConnected"`
-	ManifestCached  bool   `json:"manifestCached"`
-	Status          string `json:"status"` // "ok", "degraded", "failing"
-	Recommendation  string `json:"recommendation,omitempty"`
+	ID               string                         `json:"id"`
+	Name             string                         `json:"name"`
+	OriginalURL      string                         `json:"originalUrl"`
+	FetchMethod      string                         `json:"fetchMethod"`     // Per-addon setting (may be "global")
+	EffectiveMethod  string                         `json:"effectiveMethod"` // Resolved method
+	DirectReachable  bool                           `json:"directReachable"` // Can the server fetch the manifest directly?
+	DirectError      string                         `json:"directError,omitempty"`
+	RelayConnected   bool                           `json:"relayConnected"`
+	ManifestCached   bool                           `json:"manifestCached"`
+	ManifestCachedAt *time.Time                     `json:"manifestCachedAt,omitempty"` // When the cached manifest was fetched
+	ManifestAgeSec   int64                          `json:"manifestAgeSeconds,omitempty"`
+	FetchStatus      string                         `json:"fetchStatus"`                 // Live status from the fetch chain
+	FetchStatusAt    *time.Time                     `json:"fetchStatusAt,omitempty"`     // When FetchStatus last changed
+	LastMethod       string                         `json:"lastSuccessMethod,omitempty"` // Method that last worked
+	Methods          map[string]addon.MethodOutcome `json:"methods,omitempty"`
+	Classification   string                         `json:"classification,omitempty"` // Why the direct fetch failed (cloudflare, rate_limited, ...)
+	RetryAfterSec    int64                          `json:"retryAfterSeconds,omitempty"`
+	Status           string                         `json:"status"` // "ok", "degraded", "failing"
+	Recommendation   string                         `json:"recommendation,omitempty"`
 }
 
+// healthProbeConcurrency bounds the direct fetches one health check runs at
+// once.
+const healthProbeConcurrency = 8
+
 // HandleHealthCheck handles GET /api/health.
 // Tests connectivity to each addon and returns diagnostic info.
 func (h *Handlers) HandleHealthCheck(c *fiber.Ctx) {
@@ -444,69 +635,89 @@ func (h *Handlers) HandleHealthCheck(c *fiber.Ctx) {
 		relayConnected = h.relay.Connected()
 	}
 
+	// Test direct fetches in parallel (with a short timeout), through the
+	// same per-host limiter as regular fetches.
+	probeErrs := make([]error, len(addons))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, healthProbeConcurrency)
+	for i, a := range addons {
+		if h.wrapper == nil {
+			probeErrs[i] = fmt.Errorf("wrapper not available")
+			continue
+		}
+		wg.Add(1)
+		go func(i int, a *addon.WrappedAddon) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			probeErrs[i] = h.wrapper.ProbeDirect(ctx, a.ID, a.OriginalURL)
+		}(i, a)
+	}
+	wg.Wait()
+
 	items := make([]addonHealthItem, 0, len(addons))
-	for _, a := range addons {
+	for i, a := range addons {
 		effective := a.FetchMethod
 		if effective == "" || effective == addon.FetchMethodGlobal {
 			effective = h.config.DefaultFetchMethod
 		}
 
 		cached := false
+		var cachedAt *time.Time
 		if h.wrapper != nil {
-			cached = h.wrapper.HasCachedManifest(a.ID)
+			if t, ok := h.wrapper.CachedManifestTime(a.ID); ok {
+				cached = true
+				cachedAt = &t
+			}
 		}
 
 		item := addonHealthItem{
 			ID:              a.ID,
 			Name:            a.Name,
-			OriginalURL:     a.OriginalURL,
+			OriginalURL:     addon.RedactURL(a.OriginalURL),
 			FetchMethod:     a.FetchMethod,
 			EffectiveMethod: effective,
 			RelayConnected:  relayConnected,
 			ManifestCached:  cached,
+			FetchStatus:     a.FetchStatus,
+			FetchStatusAt:   a.FetchStatusAt,
+			LastMethod:      a.LastSuccessMethod,
+		}
+		if h.wrapper != nil {
+			item.Methods = h.wrapper.FetchOutcomes(a.ID)
+		}
+		if cachedAt != nil {
+			item.ManifestCachedAt = cachedAt
+			item.ManifestAgeSec = int64(time.Since(*cachedAt).Seconds())
 		}
 
-		// Test direct fetch (with short timeout).
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		req, err := http.NewRequestWithContext(ctx, http.MethodHead, a.OriginalURL, nil)
-		if err == nil {
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
-				item.DirectReachable = false
-				item.DirectError = "connection failed"
-			} else {
-				resp.Body.Close()
-				if resp.StatusCode >= 200 && resp.StatusCode < 400 {
-					item.DirectReachable = true
-				} else {
-					item.DirectReachable = false
-					item.DirectError = fmt.Sprintf("HTTP %d", resp.StatusCode)
-				}
-			}
+		// Classify any direct fetch failure.
+		probeErr := probeErrs[i]
+		if probeErr == nil {
+			item.DirectReachable = true
 		} else {
 			item.DirectReachable = false
-			item.DirectError = "invalid URL"
+			item.Classification = addon.Classify(probeErr)
+			item.DirectError = describeFetchError(probeErr)
+			if ra := addon.RetryAfter(probeErr); ra > 0 {
+				item.RetryAfterSec = int64(ra.Seconds())
+			}
 		}
-		cancel()
 
-		// Determine status and recommendation.
+		// Determine status and recommendation. The recommendation is the
+		// same explanation placeholder streams give in Stremio.
 		switch {
 		case item.DirectReachable:
 			item.Status = "ok"
 		case relayConnected || cached:
 			item.Status = "degraded"
-			if !item.DirectReachable && effective == "direct" {
-				item.Recommendation = "This addon is Cloudflare-protected. Switch to Browser Tab Relay (keep this tab open) or a Custom Proxy."
-			} else if !relayConnected && effective == "tab_relay" {
-				item.Recommendation = "Relay disconnected. Keep this tab open while using Stremio."
-			}
 		default:
 			item.Status = "failing"
-			if effective == "direct" {
-				item.Recommendation = "This addon is Cloudflare-protected and unreachable. Switch to Browser Tab Relay (keep this tab open) or a Custom Proxy."
-			} else if effective == "tab_relay" {
-				item.Recommendation = "Relay disconnected. Keep this tab open while using Stremio."
-			}
+		}
+		if !item.DirectReachable {
+			_, item.Recommendation = addon.DiagnoseFetchFailure(probeErr, effective, relayConnected)
 		}
 
 		items = append(items, item)
@@ -517,6 +728,64 @@ func (h *Handlers) HandleHealthCheck(c *fiber.Ctx) {
 	c.Send(out)
 }
 
+// describeFetchError returns a short human-readable reason for a failed
+// upstream fetch, based on its classification.
+func describeFetchError(err error) string {
+	var ue *addon.UpstreamError
+	hasStatus := errors.As(err, &ue)
+
+	switch addon.Classify(err) {
+	case addon.ClassCloudflare:
+		return "Cloudflare challenge"
+	case addon.ClassRateLimited:
+		if ra := addon.RetryAfter(err); ra > 0 {
+			return fmt.Sprintf("rate limited, retry in %s", ra.Round(time.Second))
+		}
+		return "rate limited"
+	case addon.ClassCaptcha:
+		return "captcha page"
+	case addon.ClassMaintenance:
+		return "maintenance page"
+	case addon.ClassInvalidJSON:
+		return "invalid JSON response"
+	case addon.ClassNotFound, addon.ClassHTTPError:
+		if hasStatus {
+			return fmt.Sprintf("HTTP %d", ue.StatusCode)
+		}
+		return "HTTP error"
+	default:
+		return "connection failed"
+	}
+}
+
+// --- diagnostics endpoints --------------------------------------------------
+
+// coalescingDiagnostics reports how many upstream fetches were shared.
+type coalescingDiagnostics struct {
+	Total    addon.CoalesceStats            `json:"total"`
+	PerAddon map[string]addon.CoalesceStats `json:"perAddon"`
+}
+
+// diagnosticsResponse is the body of GET /api/diagnostics.
+type diagnosticsResponse struct {
+	Coalescing coalescingDiagnostics           `json:"coalescing"`
+	RateLimits map[string]addon.HostLimitState `json:"rateLimits"`
+}
+
+// HandleDiagnostics handles GET /api/diagnostics.
+// Returns internal counters useful for troubleshooting upstream load.
+func (h *Handlers) HandleDiagnostics(c *fiber.Ctx) {
+	var resp diagnosticsResponse
+	if h.wrapper != nil {
+		resp.Coalescing.Total, resp.Coalescing.PerAddon = h.wrapper.CoalesceStats()
+		resp.RateLimits = h.wrapper.RateLimitStats()
+	}
+
+	out, _ := json.Marshal(resp)
+	c.Set("Content-Type", "application/json")
+	c.Send(out)
+}
+
 // --- live torrent stats endpoints --------------------------------------------
 
 // torrentStatsItem is a single torrent's live stats for the API response.
@@ -568,43 +837,63 @@ func (h *Handlers) HandleTorrentStats(c *fiber.Ctx) {
 	c.Send(out)
 }
 
+// HandleProbeFile handles GET /api/torrents/:hash/files/:idx/probe.
+// Describes the container, duration and tracks of a file by reading its
+// headers through the engine. Results are cached, so only the first request
+// for a file waits on the engine.
+func (h *Handlers) HandleProbeFile(c *fiber.Ctx) {
+	hash := strings.ToLower(c.Params("hash"))
+	idx, err := strconv.Atoi(c.Params("idx"))
+	if hash == "" || err != nil {
+		c.Status(http.StatusBadRequest)
+		c.Set("Content-Type", "application/json")
+		c.SendString(`{"error":"invalid hash or file index"}`)
+		return
+	}
 
-// fetchAddonName fetches a manifest URL and extracts the "name" field to
-// update the addon store. Best-effort; failures are silently logged.
-func (h *Handlers) fetchAddonName(addonID, manifestURL string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, manifestURL, nil)
+	info, err := h.prober.Probe(ctx, hash, idx)
 	if err != nil {
+		status := http.StatusBadGateway
+		switch {
+		case errors.Is(err, engine.ErrFileNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, probe.ErrUnsupported):
+			status = http.StatusUnsupportedMediaType
+		}
+		c.Status(status)
+		c.Set("Content-Type", "application/json")
+		errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+		c.Send(errJSON)
 		return
 	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		fmt.Printf("handlers: fetch addon name from %s: %v\n", manifestURL, err)
-		return
-	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return
-	}
+	out, _ := json.Marshal(info)
+	c.Set("Content-Type", "application/json")
+	c.Send(out)
+}
 
-	var manifest struct {
-		Name string `json:"name"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
-		return
-	}
+// --- helpers -----------------------------------------------------------------
 
-	if manifest.Name != "" {
-		if err := h.store.UpdateName(addonID, manifest.Name); err != nil {
-			fmt.Printf("handlers: update addon name for %s: %v\n", addonID, err)
-		}
-	}
+// writeAddAddonError writes a JSON error body for HandleAddAddon.
+func writeAddAddonError(c *fiber.Ctx, status int, body addAddonError) {
+	out, _ := json.Marshal(body)
+	c.Status(status)
+	c.Set("Content-Type", "application/json")
+	c.Send(out)
 }
 
-// --- helpers -----------------------------------------------------------------
+// submittedProxyURL resolves a proxy URL sent by a client. Proxy URLs are
+// only ever returned redacted, so getting the redacted form of the current
+// value back (a client saving the form it was shown) keeps the current one.
+func submittedProxyURL(submitted, current string) string {
+	if current != "" && addon.HasSecrets(current) && submitted == addon.RedactURL(current) {
+		return current
+	}
+	return submitted
+}
 
 // resolveExternalURL determines the base URL that external clients should use
 // to reach this bridge. It prefers the explicit ExternalURL from config and
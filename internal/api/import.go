@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/addon"
+)
+
+// wrappedManifestPath matches the manifest URL of an addon wrapped by a bridge.
+var wrappedManifestPath = regexp.MustCompile(`/wrap/[0-9a-f]{8}/manifest\.json$`)
+
+// Import result statuses.
+const (
+	importStatusImported  = "imported"  // newly wrapped
+	importStatusExisting  = "existing"  // already registered, transportUrl rewritten
+	importStatusSkipped   = "skipped"   // left unchanged in the collection
+	importStatusDuplicate = "duplicate" // removed from the collection
+)
+
+// importResult reports what happened to one collection entry.
+type importResult struct {
+	TransportURL string `json:"transportUrl"` // secrets masked
+	Name         string `json:"name,omitempty"`
+	Status       string `json:"status"`
+	Reason       string `json:"reason,omitempty"`
+	ID           string `json:"id,omitempty"`
+	WrappedURL   string `json:"wrappedUrl,omitempty"`
+}
+
+// importResponse is the body of POST /api/addons/import. Addons is the
+// rewritten collection, ready to be sent back with addonCollectionSet.
+type importResponse struct {
+	Addons   []map[string]interface{} `json:"addons"`
+	Imported int                      `json:"imported"`
+	Results  []importResult           `json:"results"`
+}
+
+// HandleImportAddons handles POST /api/addons/import.
+// It accepts a Stremio addon collection (a bare array, {"addons": [...]}, or
+// the Stremio API's {"result": {"addons": [...]}}), wraps every addon that
+// serves streams, and returns the collection with transportUrls pointing at
+// the wrapped manifests. Protected addons (Cinemeta, local files), addons
+// that are already wrapped and addons that aren't torrent-capable are kept
+// unchanged; duplicate entries are dropped.
+func (h *Handlers) HandleImportAddons(c *fiber.Ctx) {
+	collection, err := parseAddonCollection([]byte(c.Body()))
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		c.Set("Content-Type", "application/json")
+		errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+		c.Send(errJSON)
+		return
+	}
+
+	externalBase := resolveExternalURL(h.config, c)
+	resp := importResponse{
+		Addons:  make([]map[string]interface{}, 0, len(collection)),
+		Results: make([]importResult, 0, len(collection)),
+	}
+	seen := make(map[string]bool, len(collection))
+
+	for _, entry := range collection {
+		transportURL, _ := entry["transportUrl"].(string)
+		transportURL = strings.TrimSpace(transportURL)
+		result := importResult{TransportURL: addon.RedactURL(transportURL)}
+
+		if seen[transportURL] && transportURL != "" {
+			result.Status = importStatusDuplicate
+			resp.Results = append(resp.Results, result)
+			continue
+		}
+		seen[transportURL] = true
+
+		if reason := h.importEntry(entry, transportURL, externalBase, &result); reason != "" {
+			result.Status = importStatusSkipped
+			result.Reason = reason
+		} else if result.Status == importStatusImported {
+			resp.Imported++
+		}
+
+		resp.Addons = append(resp.Addons, entry)
+		resp.Results = append(resp.Results, result)
+	}
+
+	fmt.Printf("handlers: imported addon collection (%d entries, %d newly wrapped)\n", len(collection), resp.Imported)
+
+	out, _ := json.Marshal(resp)
+	c.Set("Content-Type", "application/json")
+	c.Send(out)
+}
+
+// importEntry wraps one collection entry in place, rewriting its transportUrl
+// and manifest. It returns a non-empty reason when the entry is left as is.
+func (h *Handlers) importEntry(entry map[string]interface{}, transportURL, externalBase string, result *importResult) string {
+	if transportURL == "" {
+		return "missing transportUrl"
+	}
+	if flags, ok := entry["flags"].(map[string]interface{}); ok {
+		if protected, _ := flags["protected"].(bool); protected {
+			return "protected addon"
+		}
+	}
+	if wrappedManifestPath.MatchString(transportURL) {
+		return "already wrapped"
+	}
+	if !strings.HasPrefix(transportURL, "http://") && !strings.HasPrefix(transportURL, "https://") {
+		return "not an http(s) addon"
+	}
+
+	// Prefer the manifest embedded in the collection; fetch it otherwise.
+	var data []byte
+	if embedded, ok := entry["manifest"].(map[string]interface{}); ok {
+		data, _ = json.Marshal(embedded)
+	} else {
+		fetched, _, err := h.wrapper.FetchManifest(transportURL)
+		if err != nil {
+			return "could not fetch manifest: " + describeFetchError(err)
+		}
+		data = fetched
+	}
+
+	report, err := addon.LintManifest(data)
+	if err != nil {
+		var manifestErr *addon.ManifestError
+		if errors.As(err, &manifestErr) {
+			return "not torrent-capable: " + strings.Join(manifestErr.Problems, "; ")
+		}
+		return err.Error()
+	}
+	result.Name = report.Name
+
+	id := addon.AddonID(transportURL)
+	wrapped, found := h.store.Get(id)
+	if found {
+		result.Status = importStatusExisting
+	} else {
+		wrapped, err = h.store.Add(transportURL)
+		if err != nil {
+			return "failed to add addon"
+		}
+		if err := h.store.UpdateName(id, report.Name); err != nil {
+			fmt.Printf("handlers: update addon name for %s: %v\n", id, err)
+		}
+		result.Status = importStatusImported
+	}
+
+	result.ID = id
+	result.WrappedURL = externalBase + "/wrap/" + id + "/manifest.json"
+
+	var manifest map[string]interface{}
+	if err := json.Unmarshal(data, &manifest); err == nil {
+		addon.RebrandManifest(manifest, wrapped.Overrides)
+		entry["manifest"] = manifest
+	}
+	entry["transportUrl"] = result.WrappedURL
+	return ""
+}
+
+// parseAddonCollection accepts the collection shapes Stremio produces.
+func parseAddonCollection(body []byte) ([]map[string]interface{}, error) {
+	var list []map[string]interface{}
+	if err := json.Unmarshal(body, &list); err == nil {
+		return list, nil
+	}
+
+	var wrapper struct {
+		Addons []map[string]interface{} `json:"addons"`
+		Result *struct {
+			Addons []map[string]interface{} `json:"addons"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &wrapper); err != nil {
+		return nil, errors.New("body must be a Stremio addon collection JSON")
+	}
+	switch {
+	case wrapper.Addons != nil:
+		return wrapper.Addons, nil
+	case wrapper.Result != nil && wrapper.Result.Addons != nil:
+		return wrapper.Result.Addons, nil
+	}
+	return nil, errors.New(`no "addons" array found in body`)
+}
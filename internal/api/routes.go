@@ -1,6 +1,10 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
 	"path/filepath"
 	"strings"
 
@@ -28,19 +32,30 @@ type AddonRouter interface {
 //   - h: the management API handlers
 //   - w: the Stremio addon wrapper (manifest rewrite, stream interception)
 //   - sp: the video stream proxy
-func RegisterRoutes(router AddonRouter, h *Handlers, w *addonpkg.Wrapper, sp *proxy.StreamProxy, rs *relay.Server) {
+//   - pt: the HTTP passthrough for plain url streams (may be nil)
+//   - bridgeManifest: the bridge's own manifest JSON, served at /manifest.json
+//     with the addon_catalog of wrapped addons and the cached catalogs added
+func RegisterRoutes(router AddonRouter, h *Handlers, w *addonpkg.Wrapper, sp *proxy.StreamProxy, pt *proxy.HTTPPassthrough, rs *relay.Server, bridgeManifest []byte) {
 	// --- Management API routes -----------------------------------------------
 
 	router.AddEndpoint("POST", "/api/addons", h.HandleAddAddon)
 	router.AddEndpoint("GET", "/api/addons", h.HandleListAddons)
 	router.AddEndpoint("DELETE", "/api/addons/:id", h.HandleRemoveAddon)
 	router.AddEndpoint("PATCH", "/api/addons/:id", h.HandleUpdateAddon)
+	router.AddEndpoint("PUT", "/api/addons/order", h.HandleReorderAddons)
+	router.AddEndpoint("POST", "/api/addons/import", h.HandleImportAddons)
 	router.AddEndpoint("GET", "/api/config", h.HandleGetConfig)
 	router.AddEndpoint("PUT", "/api/config", h.HandleUpdateConfig)
 
+	// --- Backup routes -------------------------------------------------------
+
+	router.AddEndpoint("GET", "/api/backup", h.HandleBackup)
+	router.AddEndpoint("POST", "/api/restore", h.HandleRestore)
+
 	// --- Health check routes -------------------------------------------------
 
 	router.AddEndpoint("GET", "/api/health", h.HandleHealthCheck)
+	router.AddEndpoint("GET", "/api/diagnostics", h.HandleDiagnostics)
 
 	// --- Cache management routes ---------------------------------------------
 
@@ -51,19 +66,39 @@ func RegisterRoutes(router AddonRouter, h *Handlers, w *addonpkg.Wrapper, sp *pr
 	// --- Live torrent stats routes -------------------------------------------
 
 	router.AddEndpoint("GET", "/api/torrents/stats", h.HandleTorrentStats)
+	router.AddEndpoint("GET", "/api/torrents/:hash/files/:idx/probe", h.HandleProbeFile)
 
 	// --- Stremio wrap routes (addon protocol) --------------------------------
 	// Registered as middleware so they run BEFORE go-stremio's built-in route
 	// handlers, which would otherwise intercept paths containing manifest.json,
-	// /stream/, and /catalog/ patterns.
+	// /stream/, and /catalog/ patterns. /auto/{encoded-manifest-url}/ serves
+	// the same routes for addons that were never registered (AUTO_WRAP).
 
 	router.AddMiddleware("/wrap", wrapMiddleware(w))
+	router.AddMiddleware("/auto", autoWrapMiddleware(w))
+
+	// --- Bridge addon catalog --------------------------------------------------
+	// go-stremio serves a static manifest without addon catalogs, so the
+	// extended one is served by middleware ahead of it. It also declares the
+	// "Cached on bridge" catalogs of torrents the engine already holds.
+
+	router.AddMiddleware("/manifest.json", bridgeManifestMiddleware(bridgeManifest))
+	router.AddEndpoint("GET", "/addon_catalog/:type/:id.json", w.HandleAddonCatalog)
+	router.AddEndpoint("GET", "/catalog/:type/:id.json", w.HandleCachedCatalog)
+
+	// --- Bridge subtitles ------------------------------------------------------
+	// Subtitle files found inside torrents, listed for the subtitles resource
+	// and served converted to WebVTT. Middleware because go-stremio would
+	// otherwise answer /subtitles/ paths itself.
+
+	router.AddMiddleware("/subtitles", subtitlesMiddleware(w))
 
 	// --- Stream proxy route --------------------------------------------------
 	// Also registered as middleware to avoid conflict with go-stremio's
-	// /stream/:type/:id.json handler.
+	// /stream/:type/:id.json handler. Plain HTTP passthrough streams live at
+	// /stream/http/{token} so they share the same CORS handling.
 
-	router.AddMiddleware("/stream", streamProxyMiddleware(sp))
+	router.AddMiddleware("/stream", streamProxyMiddleware(sp, pt))
 
 	// --- Browser Tab Relay routes ---------------------------------------------
 
@@ -112,72 +147,212 @@ func wrapMiddleware(w *addonpkg.Wrapper) func(*fiber.Ctx) {
 			return
 		}
 
-		// CORS headers for Stremio Web. go-stremio's global CORS middleware
-		// may set Vary: Origin before we run, which causes browsers to cache
-		// responses per-Origin. Since we always return "*", override Vary to
-		// prevent stale CORS failures from being cached.
-		c.Set("Access-Control-Allow-Origin", "*")
-		c.Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-		c.Set("Access-Control-Allow-Headers", "Content-Type")
-		c.Set("Vary", "")
-		c.Set("Cache-Control", "no-cache")
+		if !addonPreflight(c) {
+			return
+		}
 
-		if c.Method() == "OPTIONS" {
-			c.Status(204)
+		parts := strings.SplitN(rest, "/", 2)
+		if len(parts) < 2 {
+			c.Next()
 			return
 		}
 
-		if c.Method() != "GET" {
+		wrapID := parts[0]
+		remainder := parts[1] // e.g. "manifest.json", "stream/movie/tt123.json"
+
+		dispatchWrapped(c, w, wrapID, remainder, rawWrapRemainder(c, wrapID, remainder))
+	}
+}
+
+// autoWrapMiddleware returns a Fiber handler for the /auto/{encoded-manifest-url}/
+// route family. The encoded URL is resolved to a (lazily created) wrapped
+// addon and the rest of the path is served exactly like /wrap/{wrapId}/.
+func autoWrapMiddleware(w *addonpkg.Wrapper) func(*fiber.Ctx) {
+	return func(c *fiber.Ctx) {
+		if !strings.HasPrefix(c.Path(), "/auto/") {
 			c.Next()
 			return
 		}
 
-		parts := strings.SplitN(rest, "/", 2)
-		if len(parts) < 2 {
+		if !addonPreflight(c) {
+			return
+		}
+
+		// Work on the raw path: the decoded one has the encoded URL's
+		// slashes already turned into path separators.
+		raw := c.OriginalURL()
+		if idx := strings.Index(raw, "?"); idx != -1 {
+			raw = raw[:idx]
+		}
+		parts := strings.SplitN(strings.TrimPrefix(raw, "/auto/"), "/", 2)
+		if len(parts) < 2 || parts[0] == "" {
 			c.Next()
 			return
 		}
+		rawRemainder := parts[1]
+		remainder, err := url.PathUnescape(rawRemainder)
+		if err != nil {
+			remainder = rawRemainder
+		}
 
-		wrapID := parts[0]
-		remainder := parts[1] // e.g. "manifest.json", "stream/movie/tt123.json"
+		wrapID, err := w.ResolveAutoWrap(parts[0])
+		if err != nil {
+			status := http.StatusBadRequest
+			switch {
+			case errors.Is(err, addonpkg.ErrAutoWrapDisabled):
+				status = http.StatusNotFound
+			case errors.Is(err, addonpkg.ErrAutoWrapHost), errors.Is(err, addonpkg.ErrAutoWrapLimit):
+				status = http.StatusForbidden
+			case !errors.Is(err, addonpkg.ErrAutoWrapInvalidURL):
+				status = http.StatusInternalServerError
+			}
+			c.Status(status)
+			c.Set("Content-Type", "application/json")
+			errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+			c.Send(errJSON)
+			return
+		}
 
-		// Inject wrapId as a Fiber local so handlers can read it.
-		c.Locals("wrapId", wrapID)
+		dispatchWrapped(c, w, wrapID, remainder, rawRemainder)
+	}
+}
+
+// bridgeManifestMiddleware serves the extended bridge manifest at
+// /manifest.json instead of go-stremio's static one.
+func bridgeManifestMiddleware(manifest []byte) func(*fiber.Ctx) {
+	return func(c *fiber.Ctx) {
+		if c.Path() != "/manifest.json" || c.Method() != "GET" {
+			c.Next()
+			return
+		}
+		c.Set("Access-Control-Allow-Origin", "*")
+		c.Set("Content-Type", "application/json")
+		c.Send(manifest)
+	}
+}
+
+// addonPreflight sets the CORS headers Stremio Web needs on addon protocol
+// responses and answers OPTIONS. It returns false if the request has been
+// handled (or passed on) and the caller should stop.
+func addonPreflight(c *fiber.Ctx) bool {
+	// CORS headers for Stremio Web. go-stremio's global CORS middleware
+	// may set Vary: Origin before we run, which causes browsers to cache
+	// responses per-Origin. Since we always return "*", override Vary to
+	// prevent stale CORS failures from being cached.
+	c.Set("Access-Control-Allow-Origin", "*")
+	c.Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	c.Set("Access-Control-Allow-Headers", "Content-Type")
+	c.Set("Vary", "")
+	c.Set("Cache-Control", "no-cache")
+
+	if c.Method() == "OPTIONS" {
+		c.Status(204)
+		return false
+	}
+
+	if c.Method() != "GET" {
+		c.Next()
+		return false
+	}
+
+	return true
+}
+
+// dispatchWrapped routes an addon protocol request for a wrapped addon to the
+// matching Wrapper method. remainder is the decoded path after the addon
+// prefix; rawRemainder is the same part still percent-encoded.
+func dispatchWrapped(c *fiber.Ctx, w *addonpkg.Wrapper, wrapID, remainder, rawRemainder string) {
+	// Inject wrapId as a Fiber local so handlers can read it.
+	c.Locals("wrapId", wrapID)
+
+	switch {
+	case remainder == "manifest.json":
+		w.HandleManifest(c)
+	case strings.HasPrefix(remainder, "stream/"):
+		seg := strings.TrimPrefix(remainder, "stream/")
+		typAndID := strings.SplitN(seg, "/", 2)
+		if len(typAndID) == 2 {
+			c.Locals("type", typAndID[0])
+			c.Locals("streamId", strings.TrimSuffix(typAndID[1], ".json"))
+			w.HandleStream(c)
+		} else {
+			c.Next()
+		}
+	default:
+		// Any other resource the upstream declares: catalog, meta,
+		// subtitles, addon_catalog, ... as {resource}/{type}/{id}[/{extra}].json.
+		// Use the raw request path so percent-encoded extra args (e.g.
+		// search=the%20matrix) are forwarded exactly as Stremio sent them.
+		resAndPath := strings.SplitN(rawRemainder, "/", 2)
+		if len(resAndPath) == 2 && strings.HasSuffix(resAndPath[1], ".json") && strings.Contains(resAndPath[1], "/") {
+			c.Locals("resource", resAndPath[0])
+			c.Locals("resourcePath", resAndPath[1])
+			w.HandleResource(c)
+		} else {
+			c.Next()
+		}
+	}
+}
+
+// rawWrapRemainder returns the still-encoded part of the request path after
+// /wrap/{wrapId}/. Falls back to the decoded remainder if the raw URI doesn't
+// have the expected shape.
+func rawWrapRemainder(c *fiber.Ctx, wrapID, decoded string) string {
+	raw := c.OriginalURL()
+	if idx := strings.Index(raw, "?"); idx != -1 {
+		raw = raw[:idx]
+	}
+	prefix := "/wrap/" + wrapID + "/"
+	if !strings.HasPrefix(raw, prefix) {
+		return decoded
+	}
+	return strings.TrimPrefix(raw, prefix)
+}
+
+// subtitlesMiddleware returns a Fiber handler for the bridge's subtitles
+// resource: /subtitles/{type}/{id}[/{extra}].json lists the subtitles of the
+// torrent being watched, /subtitles/{infoHash}/{fileIdx}.vtt serves a subtitle
+// file and /subtitles/{infoHash}/{fileIdx}/{track}.vtt a track embedded in a
+// Matroska video.
+func subtitlesMiddleware(w *addonpkg.Wrapper) func(*fiber.Ctx) {
+	return func(c *fiber.Ctx) {
+		if !strings.HasPrefix(c.Path(), "/subtitles/") {
+			c.Next()
+			return
+		}
+
+		if !addonPreflight(c) {
+			return
+		}
+
+		// Work on the raw path so percent-encoded extra args (filenames
+		// with "&" or "/") survive until they are parsed as a query.
+		raw := c.OriginalURL()
+		if idx := strings.Index(raw, "?"); idx != -1 {
+			raw = raw[:idx]
+		}
+		parts := strings.Split(strings.TrimPrefix(raw, "/subtitles/"), "/")
+		last := parts[len(parts)-1]
 
 		switch {
-		case remainder == "manifest.json":
-			w.HandleManifest(c)
-		case strings.HasPrefix(remainder, "catalog/"):
-			// catalog/{type}/{catalogId}.json
-			seg := strings.TrimPrefix(remainder, "catalog/")
-			typAndID := strings.SplitN(seg, "/", 2)
-			if len(typAndID) == 2 {
-				c.Locals("type", typAndID[0])
-				c.Locals("catalogId", strings.TrimSuffix(typAndID[1], ".json"))
-				w.HandleCatalog(c)
-			} else {
-				c.Next()
-			}
-		case strings.HasPrefix(remainder, "meta/"):
-			seg := strings.TrimPrefix(remainder, "meta/")
-			typAndID := strings.SplitN(seg, "/", 2)
-			if len(typAndID) == 2 {
-				c.Locals("type", typAndID[0])
-				c.Locals("metaId", strings.TrimSuffix(typAndID[1], ".json"))
-				w.HandleMeta(c)
-			} else {
-				c.Next()
-			}
-		case strings.HasPrefix(remainder, "stream/"):
-			seg := strings.TrimPrefix(remainder, "stream/")
-			typAndID := strings.SplitN(seg, "/", 2)
-			if len(typAndID) == 2 {
-				c.Locals("type", typAndID[0])
-				c.Locals("streamId", strings.TrimSuffix(typAndID[1], ".json"))
-				w.HandleStream(c)
-			} else {
-				c.Next()
+		case len(parts) == 2 && strings.HasSuffix(last, ".vtt"):
+			c.Locals("infoHash", parts[0])
+			c.Locals("fileIdx", strings.TrimSuffix(last, ".vtt"))
+			w.HandleSubtitleFile(c)
+		case len(parts) == 3 && strings.HasSuffix(last, ".vtt"):
+			c.Locals("infoHash", parts[0])
+			c.Locals("fileIdx", parts[1])
+			c.Locals("track", strings.TrimSuffix(last, ".vtt"))
+			w.HandleEmbeddedSubtitle(c)
+		case (len(parts) == 2 || len(parts) == 3) && strings.HasSuffix(last, ".json"):
+			contentType, _ := url.PathUnescape(parts[0])
+			id, _ := url.PathUnescape(strings.TrimSuffix(parts[1], ".json"))
+			c.Locals("type", contentType)
+			c.Locals("id", id)
+			if len(parts) == 3 {
+				c.Locals("extra", strings.TrimSuffix(last, ".json"))
 			}
+			w.HandleSubtitles(c)
 		default:
 			c.Next()
 		}
@@ -186,8 +361,9 @@ func wrapMiddleware(w *addonpkg.Wrapper) func(*fiber.Ctx) {
 
 // streamProxyMiddleware returns a Fiber handler that intercepts requests under
 // /stream/ for the video stream proxy. It matches /stream/{infoHash}/{fileIndex}
-// (no .json suffix) and prevents go-stremio from catching these.
-func streamProxyMiddleware(sp *proxy.StreamProxy) func(*fiber.Ctx) {
+// and /stream/http/{token} (no .json suffix) and prevents go-stremio from
+// catching these.
+func streamProxyMiddleware(sp *proxy.StreamProxy, pt *proxy.HTTPPassthrough) func(*fiber.Ctx) {
 	return func(c *fiber.Ctx) {
 		path := c.Path()
 		rest := strings.TrimPrefix(path, "/stream/")
@@ -198,7 +374,7 @@ func streamProxyMiddleware(sp *proxy.StreamProxy) func(*fiber.Ctx) {
 
 		// CORS headers for Stremio Web (see wrapMiddleware for rationale).
 		c.Set("Access-Control-Allow-Origin", "*")
-		c.Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		c.Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
 		c.Set("Access-Control-Allow-Headers", "Content-Type, Range")
 		c.Set("Vary", "")
 		c.Set("Cache-Control", "no-cache")
@@ -208,7 +384,9 @@ func streamProxyMiddleware(sp *proxy.StreamProxy) func(*fiber.Ctx) {
 			return
 		}
 
-		if c.Method() != "GET" {
+		// HEAD is only forwarded for HTTP passthrough streams.
+		head := c.Method() == "HEAD" && strings.HasPrefix(rest, "http/")
+		if c.Method() != "GET" && !head {
 			c.Next()
 			return
 		}
@@ -227,6 +405,16 @@ func streamProxyMiddleware(sp *proxy.StreamProxy) func(*fiber.Ctx) {
 			return
 		}
 
+		if parts[0] == "http" {
+			if pt == nil {
+				c.Next()
+				return
+			}
+			c.Locals("token", parts[1])
+			pt.HandleStream(c)
+			return
+		}
+
 		c.Locals("infoHash", parts[0])
 		c.Locals("fileIndex", parts[1])
 		sp.HandleStream(c)
@@ -91,6 +91,15 @@ func (cm *CacheManager) RecordAccess(infoHash, name string, totalSize int64) {
 	}()
 }
 
+// Tracks reports whether a torrent is in the access log, i.e. held by the
+// engine as far as the cache manager knows.
+func (cm *CacheManager) Tracks(infoHash string) bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	_, ok := cm.accessLog[infoHash]
+	return ok
+}
+
 // Start launches the background cleanup goroutine. It runs cleanup
 // immediately on startup and then every hour until Stop is called.
 func (cm *CacheManager) Start() {
@@ -315,6 +324,31 @@ func (cm *CacheManager) GetStats() *CacheStats {
 	return stats
 }
 
+// ReplaceAccessLog swaps the whole access log, e.g. when restoring a backup,
+// and persists it. Entries for torrents the engine doesn't have are dropped
+// on the next engine sync.
+func (cm *CacheManager) ReplaceAccessLog(entries []AccessEntry) error {
+	next := make(map[string]*AccessEntry, len(entries))
+	for i := range entries {
+		e := entries[i]
+		next[e.InfoHash] = &e
+	}
+
+	cm.mu.Lock()
+	prev := cm.accessLog
+	cm.accessLog = next
+	cm.mu.Unlock()
+
+	if err := cm.save(); err != nil {
+		cm.mu.Lock()
+		cm.accessLog = prev
+		cm.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
 // load reads the persisted access log from disk. Returns nil if the file
 // does not exist (a fresh start is fine).
 func (cm *CacheManager) load() error {
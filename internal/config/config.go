@@ -2,8 +2,10 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // Config holds all configuration for the stremio-torrent-bridge
@@ -18,11 +20,11 @@ type Config struct {
 
 	// Engine URLs
 	TorrServerURL      string // env: TORRSERVER_URL, default: "http://torrserver:8090"
-	TorrServerUsername  string // env: TORRSERVER_USERNAME, default: "" (no auth)
-	TorrServerPassword  string // env: TORRSERVER_PASSWORD, default: ""
+	TorrServerUsername string // env: TORRSERVER_USERNAME, default: "" (no auth)
+	TorrServerPassword string // env: TORRSERVER_PASSWORD, default: ""
 	RqbitURL           string // env: RQBIT_URL, default: "http://rqbit:3030"
-	RqbitUsername       string // env: RQBIT_USERNAME, default: "" (no auth)
-	RqbitPassword       string // env: RQBIT_PASSWORD, default: ""
+	RqbitUsername      string // env: RQBIT_USERNAME, default: "" (no auth)
+	RqbitPassword      string // env: RQBIT_PASSWORD, default: ""
 	QBittorrentURL     string // env: QBITTORRENT_URL, default: "http://qbittorrent:8080"
 	QBitDownloadPath   string // env: QBITTORRENT_DOWNLOAD_PATH, default: "/downloads"
 	QBitUsername       string // env: QBITTORRENT_USERNAME, default: "admin"
@@ -32,12 +34,70 @@ type Config struct {
 	DefaultFetchMethod string // env: DEFAULT_FETCH_METHOD, default: "direct"
 	ProxyURL           string // env: PROXY_URL, default: "" (for custom proxy fetch method)
 
+	// Upstream rate limiting (per host, token bucket). Individual addons can
+	// override the rate.
+	UpstreamRatePerMinute   int // env: UPSTREAM_RATE_PER_MINUTE, default: 60 (0 = unlimited)
+	UpstreamBurst           int // env: UPSTREAM_BURST, default: 10
+	UpstreamQueueTimeoutSec int // env: UPSTREAM_QUEUE_TIMEOUT_SECONDS, default: 10
+
+	// Auto-wrap: serve /auto/{encoded-manifest-url}/... for addons that were
+	// never registered. Off by default since it lets anyone who can reach the
+	// bridge make it fetch arbitrary URLs; restrict it with the host allowlist.
+	// Hosts resolving to loopback, private or link-local addresses are only
+	// auto-wrapped when listed explicitly.
+	AutoWrap      bool     // env: AUTO_WRAP, default: false
+	AutoWrapHosts []string // env: AUTO_WRAP_HOSTS, default: "" (comma-separated, empty = any public host; subdomains match)
+	AutoWrapMax   int      // env: AUTO_WRAP_MAX, default: 50 (auto-wrapped addons kept in the store)
+
+	// HTTP passthrough: route plain url streams (debrid, direct HTTP) through
+	// the bridge so Stremio Web gets CORS headers and proxyHeaders are applied.
+	// Stream URLs come from addons, so only public addresses are fetched
+	// unless the host is listed in the private host allowlist.
+	HTTPPassthrough             bool     // env: HTTP_PASSTHROUGH, default: false
+	HTTPPassthroughPrivateHosts []string // env: HTTP_PASSTHROUGH_PRIVATE_HOSTS, default: "" (comma-separated; subdomains match)
+
+	// Instant availability: badge streams whose torrent is already (partly)
+	// downloaded in the engine. The engine check has a short deadline so a
+	// slow engine never delays stream responses.
+	InstantBadges         bool // env: INSTANT_BADGES, default: true
+	InstantSortFirst      bool // env: INSTANT_SORT_FIRST, default: false
+	InstantCheckTimeoutMs int  // env: INSTANT_CHECK_TIMEOUT_MS, default: 750
+
+	// Tracker scrape: ask the trackers listed in each stream's sources for the
+	// live swarm size (HTTP and UDP scrape), shown in stream titles.
+	TrackerScrape          bool // env: TRACKER_SCRAPE, default: false
+	TrackerScrapeTimeoutMs int  // env: TRACKER_SCRAPE_TIMEOUT_MS, default: 1500
+	TrackerScrapeDropDead  bool // env: TRACKER_SCRAPE_DROP_DEAD, default: false (drop torrents without seeders)
+
+	// Placeholder streams: when the engine is offline or the upstream fetch
+	// fails, answer with one non-playable stream explaining why instead of an
+	// empty list.
+	PlaceholderStreams bool // env: PLACEHOLDER_STREAMS, default: true
+
+	// Video hints: fill stream behaviorHints (filename, videoSize, videoHash)
+	// from engine metadata so subtitle addons can match torrent streams.
+	VideoHash bool // env: VIDEO_HASH, default: true (compute OpenSubtitles hashes)
+
+	// Track info: add the video resolution, audio tracks and subtitle
+	// languages read from the container headers to the titles of streams
+	// the engine has started downloading.
+	ProbeTitles bool // env: PROBE_TITLES, default: true
+
 	// Cache
 	CacheSizeGB     int // env: CACHE_SIZE_GB, default: 60
 	CacheMaxAgeDays int // env: CACHE_MAX_AGE_DAYS, default: 7
 
+	// Preload
+	PreloadConcurrency int // env: PRELOAD_CONCURRENCY, default: 2
+	PreloadLimit       int // env: PRELOAD_LIMIT, default: 5 (top-ranked streams per response, 0 = disabled)
+	PreloadTTLMinutes  int // env: PRELOAD_TTL_MINUTES, default: 30 (0 = never remove unplayed preloads)
+
 	// Storage
 	DataDir string // env: DATA_DIR, default: "/data"
+
+	// AddonSecretKey enables encryption at rest of addon URLs (which often
+	// embed API keys) and per-addon proxy URLs in addons.json.
+	AddonSecretKey string // env: ADDON_SECRET_KEY, default: "" (stored in plain text)
 }
 
 // Load creates a new Config with defaults and overrides from environment variables
@@ -63,10 +123,39 @@ func Load() *Config {
 		DefaultFetchMethod: "direct",
 		ProxyURL:           "",
 
+		// Upstream rate limit defaults
+		UpstreamRatePerMinute:   60,
+		UpstreamBurst:           10,
+		UpstreamQueueTimeoutSec: 10,
+
+		// Auto-wrap defaults
+		AutoWrapMax: 50,
+
+		// Instant availability defaults
+		InstantBadges:         true,
+		InstantCheckTimeoutMs: 750,
+
+		// Tracker scrape defaults
+		TrackerScrapeTimeoutMs: 1500,
+
+		// Placeholder stream defaults
+		PlaceholderStreams: true,
+
+		// Video hint defaults
+		VideoHash: true,
+
+		// Track info defaults
+		ProbeTitles: true,
+
 		// Cache defaults
 		CacheSizeGB:     60,
 		CacheMaxAgeDays: 7,
 
+		// Preload defaults
+		PreloadConcurrency: 2,
+		PreloadLimit:       5,
+		PreloadTTLMinutes:  30,
+
 		// Storage defaults
 		DataDir: "/data",
 	}
@@ -122,6 +211,95 @@ func Load() *Config {
 	if v := os.Getenv("PROXY_URL"); v != "" {
 		c.ProxyURL = v
 	}
+	if v := os.Getenv("UPSTREAM_RATE_PER_MINUTE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.UpstreamRatePerMinute = n
+		}
+	}
+	if v := os.Getenv("UPSTREAM_BURST"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.UpstreamBurst = n
+		}
+	}
+	if v := os.Getenv("UPSTREAM_QUEUE_TIMEOUT_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.UpstreamQueueTimeoutSec = n
+		}
+	}
+	if v := os.Getenv("AUTO_WRAP"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			c.AutoWrap = b
+		}
+	}
+	if v := os.Getenv("AUTO_WRAP_HOSTS"); v != "" {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+				c.AutoWrapHosts = append(c.AutoWrapHosts, h)
+			}
+		}
+	}
+	if v := os.Getenv("AUTO_WRAP_MAX"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			c.AutoWrapMax = n
+		}
+	}
+	if v := os.Getenv("HTTP_PASSTHROUGH"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			c.HTTPPassthrough = b
+		}
+	}
+	if v := os.Getenv("HTTP_PASSTHROUGH_PRIVATE_HOSTS"); v != "" {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+				c.HTTPPassthroughPrivateHosts = append(c.HTTPPassthroughPrivateHosts, h)
+			}
+		}
+	}
+	if v := os.Getenv("INSTANT_BADGES"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			c.InstantBadges = b
+		}
+	}
+	if v := os.Getenv("INSTANT_SORT_FIRST"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			c.InstantSortFirst = b
+		}
+	}
+	if v := os.Getenv("INSTANT_CHECK_TIMEOUT_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.InstantCheckTimeoutMs = n
+		}
+	}
+	if v := os.Getenv("TRACKER_SCRAPE"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			c.TrackerScrape = b
+		}
+	}
+	if v := os.Getenv("TRACKER_SCRAPE_TIMEOUT_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.TrackerScrapeTimeoutMs = n
+		}
+	}
+	if v := os.Getenv("TRACKER_SCRAPE_DROP_DEAD"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			c.TrackerScrapeDropDead = b
+		}
+	}
+	if v := os.Getenv("PLACEHOLDER_STREAMS"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			c.PlaceholderStreams = b
+		}
+	}
+	if v := os.Getenv("VIDEO_HASH"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			c.VideoHash = b
+		}
+	}
+	if v := os.Getenv("PROBE_TITLES"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			c.ProbeTitles = b
+		}
+	}
 	if v := os.Getenv("CACHE_SIZE_GB"); v != "" {
 		if size, err := strconv.Atoi(v); err == nil {
 			c.CacheSizeGB = size
@@ -132,9 +310,27 @@ func Load() *Config {
 			c.CacheMaxAgeDays = age
 		}
 	}
+	if v := os.Getenv("PRELOAD_CONCURRENCY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.PreloadConcurrency = n
+		}
+	}
+	if v := os.Getenv("PRELOAD_LIMIT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.PreloadLimit = n
+		}
+	}
+	if v := os.Getenv("PRELOAD_TTL_MINUTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.PreloadTTLMinutes = n
+		}
+	}
 	if v := os.Getenv("DATA_DIR"); v != "" {
 		c.DataDir = v
 	}
+	if v := os.Getenv("ADDON_SECRET_KEY"); v != "" {
+		c.AddonSecretKey = v
+	}
 
 	return c
 }
@@ -155,8 +351,45 @@ func (c *Config) LogSummary() {
 	fmt.Printf("    qBittorrent:   %s\n", c.QBittorrentURL)
 	fmt.Printf("  Fetch Method:    %s\n", c.DefaultFetchMethod)
 	if c.ProxyURL != "" {
-		fmt.Printf("  Proxy URL:       %s\n", c.ProxyURL)
+		fmt.Printf("  Proxy URL:       %s\n", redactURLPassword(c.ProxyURL))
+	}
+	fmt.Printf("  Upstream Limit:  %d req/min per host, burst %d, queue timeout %ds\n", c.UpstreamRatePerMinute, c.UpstreamBurst, c.UpstreamQueueTimeoutSec)
+	if c.HTTPPassthrough && len(c.HTTPPassthroughPrivateHosts) > 0 {
+		fmt.Printf("  Passthrough:     true (private hosts: %s)\n", strings.Join(c.HTTPPassthroughPrivateHosts, ", "))
+	} else {
+		fmt.Printf("  Passthrough:     %t\n", c.HTTPPassthrough)
 	}
+	if c.AutoWrap && len(c.AutoWrapHosts) > 0 {
+		fmt.Printf("  Auto-wrap:       %s (max %d addons)\n", strings.Join(c.AutoWrapHosts, ", "), c.AutoWrapMax)
+	} else if c.AutoWrap {
+		fmt.Printf("  Auto-wrap:       any public host (max %d addons)\n", c.AutoWrapMax)
+	} else {
+		fmt.Printf("  Auto-wrap:       disabled\n")
+	}
+	if c.InstantBadges {
+		fmt.Printf("  Instant Badges:  enabled (check timeout %dms, sort first %t)\n", c.InstantCheckTimeoutMs, c.InstantSortFirst)
+	} else {
+		fmt.Printf("  Instant Badges:  disabled\n")
+	}
+	if c.TrackerScrape {
+		fmt.Printf("  Tracker Scrape:  enabled (timeout %dms, drop dead %t)\n", c.TrackerScrapeTimeoutMs, c.TrackerScrapeDropDead)
+	} else {
+		fmt.Printf("  Tracker Scrape:  disabled\n")
+	}
+	fmt.Printf("  Placeholders:    %t\n", c.PlaceholderStreams)
+	fmt.Printf("  Video Hash:      %t\n", c.VideoHash)
+	fmt.Printf("  Probe Titles:    %t\n", c.ProbeTitles)
 	fmt.Printf("  Cache:           %d GB, max age %d days\n", c.CacheSizeGB, c.CacheMaxAgeDays)
+	fmt.Printf("  Preload:         top %d streams, %d concurrent, unplayed TTL %d min\n", c.PreloadLimit, c.PreloadConcurrency, c.PreloadTTLMinutes)
 	fmt.Printf("  Data Directory:  %s\n", c.DataDir)
+	fmt.Printf("  URL Encryption:  %t\n", c.AddonSecretKey != "")
+}
+
+// redactURLPassword masks the password in a URL's userinfo for logging.
+func redactURLPassword(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	return u.Redacted()
 }
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/secret"
+)
+
+// RuntimeConfig holds the settings that can be changed at runtime through the
+// management API. They are persisted to DATA_DIR/runtime_config.json and take
+// precedence over the environment on the next start. The proxy URL, which may
+// carry credentials, is encrypted in the file when ADDON_SECRET_KEY is set.
+type RuntimeConfig struct {
+	DefaultEngine      string `json:"defaultEngine"`
+	DefaultFetchMethod string `json:"defaultFetchMethod"`
+	ProxyURL           string `json:"proxyURL"`
+	CacheSizeGB        int    `json:"cacheSizeGB"`
+	CacheMaxAgeDays    int    `json:"cacheMaxAgeDays"`
+}
+
+// Runtime returns the current runtime-editable settings.
+func (c *Config) Runtime() RuntimeConfig {
+	return RuntimeConfig{
+		DefaultEngine:      c.DefaultEngine,
+		DefaultFetchMethod: c.DefaultFetchMethod,
+		ProxyURL:           c.ProxyURL,
+		CacheSizeGB:        c.CacheSizeGB,
+		CacheMaxAgeDays:    c.CacheMaxAgeDays,
+	}
+}
+
+// ApplyRuntime replaces the runtime-editable settings. Empty or zero values
+// keep the current setting, except ProxyURL where empty means no proxy.
+func (c *Config) ApplyRuntime(r RuntimeConfig) {
+	if r.DefaultEngine != "" {
+		c.DefaultEngine = r.DefaultEngine
+	}
+	if r.DefaultFetchMethod != "" {
+		c.DefaultFetchMethod = r.DefaultFetchMethod
+	}
+	c.ProxyURL = r.ProxyURL
+	if r.CacheSizeGB > 0 {
+		c.CacheSizeGB = r.CacheSizeGB
+	}
+	if r.CacheMaxAgeDays > 0 {
+		c.CacheMaxAgeDays = r.CacheMaxAgeDays
+	}
+}
+
+// runtimeFilePath is where runtime settings are persisted.
+func (c *Config) runtimeFilePath() string {
+	return c.DataDir + "/runtime_config.json"
+}
+
+// LoadRuntime applies previously saved runtime settings, if any, decrypting
+// the proxy URL. A missing file is not an error.
+func (c *Config) LoadRuntime() error {
+	data, err := os.ReadFile(c.runtimeFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read %s: %w", c.runtimeFilePath(), err)
+	}
+
+	var r RuntimeConfig
+	if err := json.Unmarshal(data, &r); err != nil {
+		return fmt.Errorf("parse %s: %w", c.runtimeFilePath(), err)
+	}
+
+	migrate := r.ProxyURL != "" && !secret.IsEncrypted(r.ProxyURL) && c.AddonSecretKey != ""
+	if secret.IsEncrypted(r.ProxyURL) {
+		cipher, err := secret.New(c.AddonSecretKey)
+		if err != nil {
+			return fmt.Errorf("set up encryption: %w", err)
+		}
+		if cipher == nil {
+			return fmt.Errorf("%s: proxy URL is encrypted but ADDON_SECRET_KEY is not set", c.runtimeFilePath())
+		}
+		if r.ProxyURL, err = cipher.Decrypt(r.ProxyURL); err != nil {
+			return fmt.Errorf("%s: proxy URL: %w", c.runtimeFilePath(), err)
+		}
+	}
+
+	c.ApplyRuntime(r)
+	if migrate {
+		// Encrypt a proxy URL saved before ADDON_SECRET_KEY was set.
+		return c.SaveRuntime()
+	}
+	return nil
+}
+
+// SaveRuntime persists the current runtime settings. The file is replaced
+// atomically so a crash never leaves it half-written, and is only readable by
+// the bridge's user.
+func (c *Config) SaveRuntime() error {
+	r := c.Runtime()
+	if r.ProxyURL != "" {
+		cipher, err := secret.New(c.AddonSecretKey)
+		if err != nil {
+			return fmt.Errorf("set up encryption: %w", err)
+		}
+		if cipher != nil {
+			if r.ProxyURL, err = cipher.Encrypt(r.ProxyURL); err != nil {
+				return fmt.Errorf("encrypt proxy URL: %w", err)
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal runtime config: %w", err)
+	}
+
+	tmp := c.runtimeFilePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, c.runtimeFilePath()); err != nil {
+		return fmt.Errorf("replace %s: %w", c.runtimeFilePath(), err)
+	}
+
+	return nil
+}
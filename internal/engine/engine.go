@@ -2,6 +2,7 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/url"
@@ -46,6 +47,7 @@ type TorrentInfo struct {
 	Files     []TorrentFile `json:"files"`
 	EngineID  string        `json:"engineId"`  // Internal engine ID (rqbit uses numeric IDs)
 	TotalSize int64         `json:"totalSize"` // Total size in bytes (from engine metadata)
+	Completed int64         `json:"completed"` // Bytes downloaded so far (0 if the engine doesn't report it)
 	Stats     *TorrentStats `json:"stats,omitempty"`
 }
 
@@ -94,3 +96,24 @@ type Engine interface {
 	// Ping checks if the engine is reachable.
 	Ping(ctx context.Context) error
 }
+
+// ErrFileNotFound is returned by FindFile when the torrent or the file index
+// is unknown to the engine.
+var ErrFileNotFound = errors.New("file not found in torrent")
+
+// FindFile returns the file with the given index in a torrent.
+func FindFile(ctx context.Context, eng Engine, infoHash string, fileIndex int) (*TorrentFile, error) {
+	info, err := eng.GetTorrent(ctx, infoHash)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, ErrFileNotFound
+	}
+	for i := range info.Files {
+		if info.Files[i].Index == fileIndex {
+			return &info.Files[i], nil
+		}
+	}
+	return nil, ErrFileNotFound
+}
@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// maxPendingMagnets bounds the qBittorrent magnet registry. Every
+	// preloaded stream is remembered until played, so without a limit it
+	// would grow with every title browsed.
+	maxPendingMagnets = 2000
+	// magnetSaveDelay batches the preloads of one stream response into one
+	// write.
+	magnetSaveDelay = 2 * time.Second
+)
+
+// MagnetEntry is a magnet URI remembered for a torrent the engine has not
+// been given yet.
+type MagnetEntry struct {
+	InfoHash  string `json:"infoHash"`
+	MagnetURI string `json:"magnetUri"`
+}
+
+// MagnetRegistry is implemented by engines that remember the magnet URIs of
+// preloaded torrents instead of adding them, and add them on first play
+// (qBittorrent). The registry is what makes stream URLs handed out before a
+// restart or a move to another host playable, so it is persisted and backed
+// up.
+type MagnetRegistry interface {
+	// Magnets returns the remembered magnet URIs, oldest first.
+	Magnets() []MagnetEntry
+	// ReplaceMagnets replaces the registry, as when restoring a backup.
+	ReplaceMagnets(entries []MagnetEntry) error
+}
+
+// Magnets returns the magnet URIs saved by PreloadTorrent and not yet
+// consumed by StreamFile, oldest first.
+func (q *QBittorrentAdapter) Magnets() []MagnetEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries := make([]MagnetEntry, 0, len(q.magnetOrder))
+	for _, hash := range q.magnetOrder {
+		entries = append(entries, MagnetEntry{InfoHash: hash, MagnetURI: q.magnets[hash]})
+	}
+	return entries
+}
+
+// ReplaceMagnets replaces the magnet registry and saves it. If it cannot be
+// saved the previous registry is kept.
+func (q *QBittorrentAdapter) ReplaceMagnets(entries []MagnetEntry) error {
+	q.mu.Lock()
+	prev, prevOrder := q.magnets, q.magnetOrder
+	q.magnets = make(map[string]string, len(entries))
+	q.magnetOrder = nil
+	for _, e := range entries {
+		q.rememberMagnetLocked(e.InfoHash, e.MagnetURI)
+	}
+	q.mu.Unlock()
+
+	if err := q.saveMagnets(); err != nil {
+		q.mu.Lock()
+		q.magnets, q.magnetOrder = prev, prevOrder
+		q.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// rememberMagnetLocked records the magnet URI of infoHash, dropping the
+// oldest entries above maxPendingMagnets. Caller must hold q.mu.
+func (q *QBittorrentAdapter) rememberMagnetLocked(infoHash, magnetURI string) {
+	if _, ok := q.magnets[infoHash]; !ok {
+		q.magnetOrder = append(q.magnetOrder, infoHash)
+	}
+	q.magnets[infoHash] = magnetURI
+	for len(q.magnetOrder) > maxPendingMagnets {
+		delete(q.magnets, q.magnetOrder[0])
+		q.magnetOrder = q.magnetOrder[1:]
+	}
+}
+
+// takeMagnetLocked returns and forgets the magnet URI of infoHash, or "" if
+// none is remembered. Caller must hold q.mu.
+func (q *QBittorrentAdapter) takeMagnetLocked(infoHash string) string {
+	magnetURI, ok := q.magnets[infoHash]
+	if !ok {
+		return ""
+	}
+	delete(q.magnets, infoHash)
+	for i, hash := range q.magnetOrder {
+		if hash == infoHash {
+			q.magnetOrder = append(q.magnetOrder[:i:i], q.magnetOrder[i+1:]...)
+			break
+		}
+	}
+	return magnetURI
+}
+
+// scheduleMagnetSaveLocked saves the registry after magnetSaveDelay unless a
+// save is already scheduled. Caller must hold q.mu.
+func (q *QBittorrentAdapter) scheduleMagnetSaveLocked() {
+	if q.magnetsPath == "" || q.magnetSave != nil {
+		return
+	}
+	q.magnetSave = time.AfterFunc(magnetSaveDelay, func() {
+		q.mu.Lock()
+		q.magnetSave = nil
+		q.mu.Unlock()
+
+		if err := q.saveMagnets(); err != nil {
+			fmt.Printf("qbittorrent: failed to save magnets: %v\n", err)
+		}
+	})
+}
+
+// loadMagnets reads the persisted registry. Returns nil if the file does not
+// exist (a fresh start is fine).
+func (q *QBittorrentAdapter) loadMagnets() error {
+	data, err := os.ReadFile(q.magnetsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read %s: %w", q.magnetsPath, err)
+	}
+
+	var entries []MagnetEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("parse %s: %w", q.magnetsPath, err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, e := range entries {
+		if e.InfoHash != "" && e.MagnetURI != "" {
+			q.rememberMagnetLocked(e.InfoHash, e.MagnetURI)
+		}
+	}
+
+	return nil
+}
+
+// saveMagnets writes the registry to disk, replacing the file atomically.
+func (q *QBittorrentAdapter) saveMagnets() error {
+	if q.magnetsPath == "" {
+		return nil
+	}
+
+	q.saveMu.Lock()
+	defer q.saveMu.Unlock()
+
+	data, err := json.Marshal(q.Magnets())
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	tmp := q.magnetsPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, q.magnetsPath); err != nil {
+		return fmt.Errorf("replace %s: %w", q.magnetsPath, err)
+	}
+
+	return nil
+}
@@ -27,16 +27,23 @@ type QBittorrentAdapter struct {
 	password     string
 	client       *http.Client
 
-	mu      sync.Mutex
-	sid     string            // Session ID cookie from /api/v2/auth/login
-	magnets map[string]string // infoHash → magnet URI, saved by PreloadTorrent for StreamFile
+	mu          sync.Mutex
+	sid         string            // Session ID cookie from /api/v2/auth/login
+	magnets     map[string]string // infoHash → magnet URI, saved by PreloadTorrent for StreamFile
+	magnetOrder []string          // infoHashes in magnets, oldest first
+	magnetSave  *time.Timer       // scheduled save of magnets, if any
+
+	magnetsPath string     // persisted magnets; empty = memory only
+	saveMu      sync.Mutex // serializes magnet saves
 }
 
 // NewQBittorrentAdapter creates a new qBittorrent engine adapter.
 // baseURL is the qBittorrent WebUI address (e.g., "http://qbittorrent:8080").
 // downloadPath is the local mount point for qBittorrent's download directory.
-func NewQBittorrentAdapter(baseURL, downloadPath, username, password string) *QBittorrentAdapter {
-	return &QBittorrentAdapter{
+// Magnets of preloaded torrents are persisted under dataDir (empty = not
+// persisted).
+func NewQBittorrentAdapter(baseURL, downloadPath, username, password, dataDir string) *QBittorrentAdapter {
+	q := &QBittorrentAdapter{
 		baseURL:      strings.TrimRight(baseURL, "/"),
 		downloadPath: downloadPath,
 		username:     username,
@@ -44,6 +51,13 @@ func NewQBittorrentAdapter(baseURL, downloadPath, username, password string) *QB
 		client:       httpclient.New(),
 		magnets:      make(map[string]string),
 	}
+	if dataDir != "" {
+		q.magnetsPath = dataDir + "/qbittorrent_magnets.json"
+		if err := q.loadMagnets(); err != nil {
+			fmt.Printf("qbittorrent: failed to load magnets: %v (starting fresh)\n", err)
+		}
+	}
+	return q
 }
 
 // qBittorrent API response types
@@ -55,6 +69,7 @@ type qbitTorrentInfo struct {
 	ContentPath   string  `json:"content_path"`
 	Progress      float64 `json:"progress"`
 	Size          int64   `json:"size"`
+	Completed     int64   `json:"completed"`
 	PieceSize     int64   `json:"piece_size"`
 	NumComplete   int     `json:"num_complete"`
 	NumIncomplete int     `json:"num_incomplete"`
@@ -179,7 +194,8 @@ func (q *QBittorrentAdapter) PreloadTorrent(ctx context.Context, magnetURI strin
 	}
 
 	q.mu.Lock()
-	q.magnets[infoHash] = magnetURI
+	q.rememberMagnetLocked(infoHash, magnetURI)
+	q.scheduleMagnetSaveLocked()
 	q.mu.Unlock()
 
 	return &TorrentInfo{InfoHash: infoHash}, nil
@@ -252,8 +268,10 @@ func (q *QBittorrentAdapter) StreamFile(ctx context.Context, infoHash string, fi
 	// PreloadTorrent only cached the magnet URI without adding anything,
 	// so this is the first time qBittorrent sees this torrent.
 	q.mu.Lock()
-	magnetURI := q.magnets[hash]
-	delete(q.magnets, hash) // consumed
+	magnetURI := q.takeMagnetLocked(hash) // consumed
+	if magnetURI != "" {
+		q.scheduleMagnetSaveLocked()
+	}
 	q.mu.Unlock()
 
 	if magnetURI != "" {
@@ -857,6 +875,7 @@ func torrentInfoFromQBittorrent(t *qbitTorrentInfo, files []qbitFileInfo) *Torre
 		Files:     torrentFiles,
 		EngineID:  strings.ToLower(t.Hash),
 		TotalSize: totalSize,
+		Completed: t.Completed,
 	}
 
 	if t.NumSeeds > 0 || t.NumLeechs > 0 || t.DlSpeed > 0 || t.NumComplete > 0 {
@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+const (
+	// readerChunkSize is how much FileReader fetches per Range request.
+	readerChunkSize = 1 << 20
+	// readerCachedChunks is how many fetched chunks FileReader keeps.
+	readerCachedChunks = 8
+)
+
+// FileReader reads a file inside a torrent through StreamFile Range requests,
+// for parsers that need random access (container headers, indexes). It
+// fetches whole chunks and keeps the most recent ones, so reading small
+// elements scattered across a region costs one request per chunk. It
+// implements io.ReaderAt and is safe for concurrent use.
+type FileReader struct {
+	ctx       context.Context
+	engine    Engine
+	infoHash  string
+	fileIndex int
+	size      int64
+
+	mu     sync.Mutex
+	chunks map[int64][]byte // chunk number -> data
+	order  []int64          // chunk numbers, oldest first
+}
+
+// NewFileReader creates a reader for a file of the given size. All requests
+// are made with ctx, so cancelling it aborts pending reads.
+func NewFileReader(ctx context.Context, eng Engine, infoHash string, fileIndex int, size int64) *FileReader {
+	return &FileReader{
+		ctx:       ctx,
+		engine:    eng,
+		infoHash:  infoHash,
+		fileIndex: fileIndex,
+		size:      size,
+		chunks:    make(map[int64][]byte),
+	}
+}
+
+// Size returns the file size.
+func (r *FileReader) Size() int64 {
+	return r.size
+}
+
+// ReadAt reads len(p) bytes at off. It returns io.EOF if the file ends first.
+func (r *FileReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.size {
+			return n, io.EOF
+		}
+		chunk, err := r.chunk(pos / readerChunkSize)
+		if err != nil {
+			return n, err
+		}
+		start := int(pos % readerChunkSize)
+		if start >= len(chunk) {
+			return n, io.ErrUnexpectedEOF
+		}
+		n += copy(p[n:], chunk[start:])
+	}
+	return n, nil
+}
+
+// chunk returns one chunk of the file, from the cache or the engine.
+func (r *FileReader) chunk(num int64) ([]byte, error) {
+	r.mu.Lock()
+	if data, ok := r.chunks[num]; ok {
+		r.mu.Unlock()
+		return data, nil
+	}
+	r.mu.Unlock()
+
+	start := num * readerChunkSize
+	end := start + readerChunkSize
+	if end > r.size {
+		end = r.size
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, fmt.Sprintf("http://localhost/stream/%s/%d", r.infoHash, r.fileIndex), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+
+	resp, err := r.engine.StreamFile(r.ctx, r.infoHash, r.fileIndex, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// An engine that ignores Range answers 200 with the whole file, which is
+	// only usable for the first chunk.
+	if resp.StatusCode != http.StatusPartialContent && !(resp.StatusCode == http.StatusOK && start == 0) {
+		return nil, fmt.Errorf("range read at %d: unexpected status %d", start, resp.StatusCode)
+	}
+
+	data := make([]byte, end-start)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return nil, fmt.Errorf("range read at %d: %w", start, err)
+	}
+
+	r.mu.Lock()
+	if _, ok := r.chunks[num]; !ok {
+		r.chunks[num] = data
+		r.order = append(r.order, num)
+		if len(r.order) > readerCachedChunks {
+			delete(r.chunks, r.order[0])
+			r.order = r.order[1:]
+		}
+	}
+	r.mu.Unlock()
+	return data, nil
+}
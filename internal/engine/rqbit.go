@@ -321,7 +321,9 @@ func (r *RqbitAdapter) GetTorrent(ctx context.Context, infoHash string) (*Torren
 }
 
 func (r *RqbitAdapter) ListTorrents(ctx context.Context) ([]TorrentInfo, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.baseURL+"/torrents", nil)
+	// with_stats adds download progress to each entry; older rqbit versions
+	// ignore the parameter.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.baseURL+"/torrents?with_stats=true", nil)
 	if err != nil {
 		return nil, fmt.Errorf("rqbit list torrents: create request: %w", err)
 	}
@@ -471,6 +473,9 @@ func (r *RqbitAdapter) getTorrentByID(ctx context.Context, id int, knownHash str
 	for _, f := range files {
 		totalSize += f.Size
 	}
+	if totalSize == 0 {
+		totalSize = rqbitTotalBytes(detail.Stats)
+	}
 
 	return &TorrentInfo{
 		InfoHash:  hash,
@@ -478,6 +483,7 @@ func (r *RqbitAdapter) getTorrentByID(ctx context.Context, id int, knownHash str
 		Files:     files,
 		EngineID:  strconv.Itoa(id),
 		TotalSize: totalSize,
+		Completed: rqbitProgressBytes(detail.Stats),
 	}, nil
 }
 
@@ -506,10 +512,14 @@ func (r *RqbitAdapter) torrentDetailsToInfoSlice(details []rqbitTorrentDetail) [
 			engineID = strconv.Itoa(id)
 		}
 
+		// List entries carry no files; the stats know the size.
 		var totalSize int64
 		for _, f := range files {
 			totalSize += f.Size
 		}
+		if totalSize == 0 {
+			totalSize = rqbitTotalBytes(d.Stats)
+		}
 
 		result = append(result, TorrentInfo{
 			InfoHash:  hash,
@@ -517,10 +527,41 @@ func (r *RqbitAdapter) torrentDetailsToInfoSlice(details []rqbitTorrentDetail) [
 			Files:     files,
 			EngineID:  engineID,
 			TotalSize: totalSize,
+			Completed: rqbitProgressBytes(d.Stats),
 		})
 	}
 	return result
 }
 
+// rqbitProgressBytes reads the downloaded byte count from a torrent's stats
+// object. Returns 0 when rqbit didn't include stats.
+func rqbitProgressBytes(stats json.RawMessage) int64 {
+	if len(stats) == 0 {
+		return 0
+	}
+	var s struct {
+		ProgressBytes int64 `json:"progress_bytes"`
+	}
+	if err := json.Unmarshal(stats, &s); err != nil {
+		return 0
+	}
+	return s.ProgressBytes
+}
+
+// rqbitTotalBytes reads the torrent size from a torrent's stats object.
+// Returns 0 when rqbit didn't include stats.
+func rqbitTotalBytes(stats json.RawMessage) int64 {
+	if len(stats) == 0 {
+		return 0
+	}
+	var s struct {
+		TotalBytes int64 `json:"total_bytes"`
+	}
+	if err := json.Unmarshal(stats, &s); err != nil {
+		return 0
+	}
+	return s.TotalBytes
+}
+
 // Compile-time interface check
 var _ Engine = (*RqbitAdapter)(nil)
@@ -46,6 +46,7 @@ type torrServerTorrent struct {
 	Name             string               `json:"name"`
 	FileStat         []torrServerFileStat  `json:"file_stat"`
 	TorrentSize      int64                `json:"torrent_size"`
+	LoadedSize       int64                `json:"loaded_size"` // bytes completed
 	DownloadSpeed    float64              `json:"download_speed"`
 	UploadSpeed      float64              `json:"upload_speed"`
 	ActivePeers      int                  `json:"active_peers"`
@@ -282,6 +283,7 @@ func torrentInfoFromTorrServer(ts *torrServerTorrent) *TorrentInfo {
 		Files:     files,
 		EngineID:  strings.ToLower(ts.Hash),
 		TotalSize: totalSize,
+		Completed: ts.LoadedSize,
 	}
 
 	// Attach live stats if any are non-zero (indicates an active torrent).
@@ -0,0 +1,178 @@
+// Package matroska reads Matroska (MKV) and WebM files through an
+// io.ReaderAt: the segment header, the track list and the cue index, and
+// extracts text subtitle tracks without reading any more of the file than
+// needed. It is a minimal pure-Go EBML reader, not a general demuxer.
+package matroska
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// maxElementRead bounds how much of one element is read into memory
+// (Tracks, Cues, block groups), so a corrupt size can't exhaust memory.
+const maxElementRead = 32 << 20
+
+// unknownSize marks an element whose size field has all value bits set.
+const unknownSize = -1
+
+var (
+	// ErrNotMatroska is returned for files that don't start with an EBML
+	// header of a Matroska or WebM document.
+	ErrNotMatroska = errors.New("not a Matroska file")
+
+	errInvalidVint = errors.New("invalid EBML variable-length integer")
+)
+
+// element is an EBML element header located in the file.
+type element struct {
+	id         uint32
+	offset     int64 // start of the element header
+	dataOffset int64 // start of the element data
+	size       int64 // data size, or unknownSize
+}
+
+// end returns the offset just past the element, or -1 if its size is
+// unknown.
+func (e element) end() int64 {
+	if e.size == unknownSize {
+		return -1
+	}
+	return e.dataOffset + e.size
+}
+
+// readElement reads the element header at off.
+func readElement(r io.ReaderAt, off int64) (element, error) {
+	var buf [12]byte // 4-byte ID + 8-byte size at most
+	n, err := r.ReadAt(buf[:], off)
+	if n == 0 {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return element{}, err
+	}
+
+	id, idLen, err := parseVint(buf[:n], true)
+	if err != nil {
+		return element{}, err
+	}
+	if idLen > 4 {
+		return element{}, errInvalidVint
+	}
+	size, sizeLen, err := parseVint(buf[idLen:n], false)
+	if err != nil {
+		return element{}, err
+	}
+
+	e := element{
+		id:         uint32(id),
+		offset:     off,
+		dataOffset: off + int64(idLen+sizeLen),
+		size:       int64(size),
+	}
+	if size == allOnes(sizeLen) {
+		e.size = unknownSize
+	}
+	return e, nil
+}
+
+// readData reads the whole data of an element.
+func readData(r io.ReaderAt, e element) ([]byte, error) {
+	if e.size == unknownSize || e.size > maxElementRead {
+		return nil, fmt.Errorf("element 0x%X too large to read (%d bytes)", e.id, e.size)
+	}
+	data := make([]byte, e.size)
+	if _, err := r.ReadAt(data, e.dataOffset); err != nil {
+		return nil, fmt.Errorf("read element 0x%X: %w", e.id, err)
+	}
+	return data, nil
+}
+
+// parseVint decodes an EBML variable-length integer from the start of b.
+// IDs keep their length marker bit (keepMarker); sizes and values don't.
+func parseVint(b []byte, keepMarker bool) (uint64, int, error) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, errInvalidVint
+	}
+	length := 1
+	for mask := byte(0x80); b[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 || len(b) < length {
+		return 0, 0, errInvalidVint
+	}
+
+	v := uint64(b[0])
+	if !keepMarker {
+		v &= uint64(0xFF >> length)
+	}
+	for _, c := range b[1:length] {
+		v = v<<8 | uint64(c)
+	}
+	return v, length, nil
+}
+
+// allOnes returns the value of a size field of the given length with all
+// value bits set, which EBML reserves for "unknown size".
+func allOnes(length int) uint64 {
+	return 1<<(7*uint(length)) - 1
+}
+
+// eachChild calls fn for every child element in an element's data, in
+// order. It stops at the first error fn returns.
+func eachChild(data []byte, fn func(id uint32, payload []byte) error) error {
+	for len(data) > 0 {
+		id, idLen, err := parseVint(data, true)
+		if err != nil {
+			return err
+		}
+		size, sizeLen, err := parseVint(data[idLen:], false)
+		if err != nil {
+			return err
+		}
+		start := idLen + sizeLen
+		if size == allOnes(sizeLen) || uint64(len(data)-start) < size {
+			// Unknown or overlong sizes only occur for elements we
+			// don't buffer; treat the rest of the data as the payload.
+			size = uint64(len(data) - start)
+		}
+		if err := fn(uint32(id), data[start:start+int(size)]); err != nil {
+			return err
+		}
+		data = data[start+int(size):]
+	}
+	return nil
+}
+
+// readUint decodes an EBML unsigned integer element.
+func readUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// readFloat decodes an EBML float element (4 or 8 bytes).
+func readFloat(b []byte) float64 {
+	switch len(b) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// readString decodes an EBML string element, which may be zero-padded.
+func readString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
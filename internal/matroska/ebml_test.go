@@ -0,0 +1,157 @@
+package matroska
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// el encodes an EBML element with a 1- or 2-byte size.
+func el(id uint32, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	var b []byte
+	switch {
+	case id > 0xFFFFFF:
+		b = binary.BigEndian.AppendUint32(b, id)
+	case id > 0xFFFF:
+		b = append(b, byte(id>>16), byte(id>>8), byte(id))
+	case id > 0xFF:
+		b = binary.BigEndian.AppendUint16(b, uint16(id))
+	default:
+		b = append(b, byte(id))
+	}
+	if len(data) < 0x7F {
+		b = append(b, 0x80|byte(len(data)))
+	} else {
+		b = binary.BigEndian.AppendUint16(b, 0x4000|uint16(len(data)))
+	}
+	return append(b, data...)
+}
+
+func TestParseVint(t *testing.T) {
+	tests := []struct {
+		name       string
+		in         []byte
+		keepMarker bool
+		want       uint64
+		wantLen    int
+		wantErr    bool
+	}{
+		{"one byte size", []byte{0x81}, false, 1, 1, false},
+		{"one byte id", []byte{0xA3}, true, 0xA3, 1, false},
+		{"two byte size", []byte{0x40, 0x02}, false, 2, 2, false},
+		{"four byte id", []byte{0x1A, 0x45, 0xDF, 0xA3, 0x00}, true, idEBML, 4, false},
+		{"unknown size", []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, false, allOnes(8), 8, false},
+		{"zero first byte", []byte{0x00, 0x81}, false, 0, 0, true},
+		{"truncated", []byte{0x40}, false, 0, 0, true},
+		{"empty", nil, false, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, n, err := parseVint(tt.in, tt.keepMarker)
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidVint) {
+					t.Fatalf("got %d, %d, %v; want errInvalidVint", got, n, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want || n != tt.wantLen {
+				t.Fatalf("got %d, %d, %v; want %d, %d", got, n, err, tt.want, tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestEachChild(t *testing.T) {
+	type child struct {
+		id      uint32
+		payload string
+	}
+	tests := []struct {
+		name    string
+		in      []byte
+		want    []child
+		wantErr bool
+	}{
+		{
+			name: "siblings",
+			in:   append(el(idCodecID, []byte("S_TEXT/UTF8")), el(idLanguage, []byte("eng"))...),
+			want: []child{{idCodecID, "S_TEXT/UTF8"}, {idLanguage, "eng"}},
+		},
+		{
+			name: "overlong size keeps the rest",
+			in:   []byte{0x86, 0x85, 'a', 'b'},
+			want: []child{{idCodecID, "ab"}},
+		},
+		{
+			name: "unknown size keeps the rest",
+			in:   []byte{0x86, 0xFF, 'a', 'b', 'c'},
+			want: []child{{idCodecID, "abc"}},
+		},
+		{
+			name: "empty",
+			in:   nil,
+		},
+		{
+			name:    "invalid id",
+			in:      []byte{0x00, 0x81, 'a'},
+			wantErr: true,
+		},
+		{
+			name:    "missing size",
+			in:      []byte{0x86},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []child
+			err := eachChild(tt.in, func(id uint32, payload []byte) error {
+				got = append(got, child{id, string(payload)})
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %t", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("child %d: got %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEachChildStopsOnError(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+	in := append(el(idCodecID, []byte("a")), el(idLanguage, []byte("b"))...)
+	err := eachChild(in, func(uint32, []byte) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("got %v after %d calls, want stop after 1", err, calls)
+	}
+}
+
+func FuzzEachChild(f *testing.F) {
+	f.Add(el(idTrackEntry, el(idTrackNumber, []byte{3}), el(idCodecID, []byte("S_TEXT/ASS"))))
+	f.Add([]byte{0x86, 0xFF, 'a'})
+	f.Add([]byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		total := 0
+		eachChild(data, func(id uint32, payload []byte) error {
+			total += len(payload)
+			// Recurse like the track and cue parsers do.
+			return eachChild(payload, func(uint32, []byte) error { return nil })
+		})
+		if total > len(data) {
+			t.Fatalf("children hold %d bytes of %d", total, len(data))
+		}
+	})
+}
@@ -0,0 +1,381 @@
+package matroska
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/subtitles"
+)
+
+const (
+	// maxSubtitleFrame bounds one subtitle frame, compressed or not.
+	maxSubtitleFrame = 1 << 20
+	// defaultCueDuration applies to frames without a duration that aren't
+	// followed by another frame.
+	defaultCueDuration = 5 * time.Second
+	// maxClusterScan bounds how far into the segment a track without cue
+	// entries is scanned. Reading a cluster means downloading it, so past
+	// this the whole video would be fetched for one subtitle track.
+	maxClusterScan = 64 << 20
+)
+
+var errLaced = errors.New("laced block")
+
+// ErrScanLimit is returned by ExtractSubtitles for a track the cue index
+// doesn't cover in a file too large to scan.
+var ErrScanLimit = errors.New("subtitle track not indexed and file too large to scan")
+
+// frame is one block of the extracted track.
+type frame struct {
+	start    int64  // in timestamp ticks
+	duration uint64 // in timestamp ticks, 0 if unknown
+	data     []byte
+}
+
+// ExtractSubtitles reads every frame of a text subtitle track and returns
+// the cues in start order. Frames are located through the cue index when the
+// muxer indexed the track (mkvmerge does for subtitles by default); otherwise
+// every cluster is scanned, which is refused with ErrScanLimit once the
+// clusters go past maxClusterScan.
+func (f *File) ExtractSubtitles(trackNumber uint64) ([]subtitles.Cue, error) {
+	t := f.track(trackNumber)
+	if t == nil || !t.IsTextSubtitle() {
+		return nil, fmt.Errorf("track %d is not a text subtitle track", trackNumber)
+	}
+
+	f.loadCues()
+
+	var points []cuePoint
+	direct := true
+	for _, p := range f.cues {
+		if p.track == trackNumber {
+			points = append(points, p)
+			direct = direct && p.relativePos >= 0
+		}
+	}
+
+	var frames []frame
+	var err error
+	switch {
+	case len(points) > 0 && direct:
+		frames, err = f.framesFromCues(t, points)
+	case len(points) > 0:
+		frames, err = f.framesFromIndexedClusters(t, points)
+	default:
+		frames, err = f.scanClusters(t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f.toCues(t, frames), nil
+}
+
+// framesFromCues reads the frames the cue index points at directly.
+func (f *File) framesFromCues(t *Track, points []cuePoint) ([]frame, error) {
+	clusterTimes := make(map[int64]uint64)
+	seen := make(map[[2]int64]bool)
+	var frames []frame
+	for _, p := range points {
+		key := [2]int64{p.clusterPos, p.relativePos}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		cluster, err := readElement(f.r, f.segmentData+p.clusterPos)
+		if err != nil || cluster.id != idCluster {
+			return nil, fmt.Errorf("cue points at %d, not a cluster", p.clusterPos)
+		}
+		ts, ok := clusterTimes[p.clusterPos]
+		if !ok {
+			if ts, err = f.clusterTimestamp(cluster); err != nil {
+				return nil, err
+			}
+			clusterTimes[p.clusterPos] = ts
+		}
+
+		block, err := readElement(f.r, cluster.dataOffset+p.relativePos)
+		if err != nil {
+			return nil, fmt.Errorf("read cued block: %w", err)
+		}
+		fr, ok, err := f.readFrame(block, t, ts)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if fr.duration == 0 {
+			fr.duration = p.duration
+		}
+		frames = append(frames, fr)
+	}
+	return frames, nil
+}
+
+// framesFromIndexedClusters scans only the clusters the cue index lists for
+// the track, for indexes without block positions.
+func (f *File) framesFromIndexedClusters(t *Track, points []cuePoint) ([]frame, error) {
+	seen := make(map[int64]bool)
+	var frames []frame
+	for _, p := range points {
+		if seen[p.clusterPos] {
+			continue
+		}
+		seen[p.clusterPos] = true
+		found, _, err := f.scanCluster(f.segmentData+p.clusterPos, t)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, found...)
+	}
+	return frames, nil
+}
+
+// scanClusters walks every cluster of the segment, up to maxClusterScan.
+func (f *File) scanClusters(t *Track) ([]frame, error) {
+	var frames []frame
+	for pos := f.firstCluster; pos >= 0 && pos < f.segmentEnd; {
+		if pos-f.segmentData > maxClusterScan {
+			return nil, ErrScanLimit
+		}
+		e, err := readElement(f.r, pos)
+		if err != nil {
+			return nil, fmt.Errorf("read element at %d: %w", pos, err)
+		}
+		if e.id != idCluster {
+			// Cues, tags or attachments between or after the clusters.
+			if e.size == unknownSize {
+				break
+			}
+			pos = e.end()
+			continue
+		}
+		found, next, err := f.scanCluster(pos, t)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, found...)
+		pos = next
+	}
+	return frames, nil
+}
+
+// scanCluster returns the frames of track t in the cluster at off and the
+// offset just past the cluster. Blocks of other tracks are skipped after
+// reading their first bytes.
+func (f *File) scanCluster(off int64, t *Track) ([]frame, int64, error) {
+	cluster, err := readElement(f.r, off)
+	if err != nil || cluster.id != idCluster {
+		return nil, 0, fmt.Errorf("no cluster at %d", off)
+	}
+	end := cluster.end()
+	if end < 0 {
+		end = f.segmentEnd
+	}
+
+	var ts uint64
+	var frames []frame
+	pos := cluster.dataOffset
+	for pos < end {
+		e, err := readElement(f.r, pos)
+		if err != nil {
+			return nil, 0, fmt.Errorf("read cluster element at %d: %w", pos, err)
+		}
+		switch e.id {
+		case idTimestamp:
+			data, err := readData(f.r, e)
+			if err != nil {
+				return nil, 0, err
+			}
+			ts = readUint(data)
+		case idSimpleBlock, idBlockGroup:
+			fr, ok, err := f.readFrame(e, t, ts)
+			if err != nil && !errors.Is(err, errLaced) {
+				return nil, 0, err
+			}
+			if ok {
+				frames = append(frames, fr)
+			}
+		case idCluster, idCues, idSeekHead, idInfo, idTracks:
+			// A cluster of unknown size ends where the next top-level
+			// element starts.
+			if cluster.size == unknownSize {
+				return frames, pos, nil
+			}
+		}
+		if e.size == unknownSize {
+			return nil, 0, fmt.Errorf("element 0x%X of unknown size inside cluster", e.id)
+		}
+		pos = e.end()
+	}
+	return frames, end, nil
+}
+
+// clusterTimestamp reads the Timestamp element, which leads the cluster.
+func (f *File) clusterTimestamp(cluster element) (uint64, error) {
+	pos := cluster.dataOffset
+	for i := 0; i < 8; i++ {
+		e, err := readElement(f.r, pos)
+		if err != nil {
+			return 0, err
+		}
+		if e.id == idTimestamp {
+			data, err := readData(f.r, e)
+			if err != nil {
+				return 0, err
+			}
+			return readUint(data), nil
+		}
+		if e.size == unknownSize {
+			break
+		}
+		pos = e.end()
+	}
+	return 0, fmt.Errorf("cluster at %d has no timestamp", cluster.offset)
+}
+
+// readFrame reads a SimpleBlock or BlockGroup element if it belongs to track
+// t. Blocks of other tracks are recognised from their first bytes without
+// reading the rest.
+func (f *File) readFrame(e element, t *Track, clusterTime uint64) (frame, bool, error) {
+	// Locate the block header: the element itself for a SimpleBlock, the
+	// Block child (written first) for a BlockGroup.
+	block := e
+	if e.id == idBlockGroup {
+		child, err := readElement(f.r, e.dataOffset)
+		if err != nil {
+			return frame{}, false, err
+		}
+		block = child
+	} else if e.id != idSimpleBlock {
+		return frame{}, false, nil
+	}
+	if block.id == idBlock || block.id == idSimpleBlock {
+		var head [8]byte
+		n, _ := f.r.ReadAt(head[:], block.dataOffset)
+		track, _, err := parseVint(head[:n], false)
+		if err != nil || track != t.Number {
+			return frame{}, false, nil
+		}
+	}
+	if e.size == unknownSize || e.size > maxSubtitleFrame {
+		return frame{}, false, nil
+	}
+
+	data, err := readData(f.r, e)
+	if err != nil {
+		return frame{}, false, err
+	}
+
+	var fr frame
+	var blockData []byte
+	if e.id == idSimpleBlock {
+		blockData = data
+	} else {
+		eachChild(data, func(id uint32, payload []byte) error {
+			switch id {
+			case idBlock:
+				blockData = payload
+			case idBlockDuration:
+				fr.duration = readUint(payload)
+			}
+			return nil
+		})
+	}
+	if blockData == nil {
+		return frame{}, false, nil
+	}
+
+	track, n, err := parseVint(blockData, false)
+	if err != nil || track != t.Number || len(blockData) < n+3 {
+		return frame{}, false, nil
+	}
+	if blockData[n+2]&0x06 != 0 {
+		return frame{}, false, errLaced
+	}
+	rel := int16(binary.BigEndian.Uint16(blockData[n:]))
+	fr.start = int64(clusterTime) + int64(rel)
+
+	fr.data, err = t.decode(blockData[n+3:])
+	if err != nil {
+		return frame{}, false, err
+	}
+	return fr, true, nil
+}
+
+// decode undoes the track's content compression on a frame.
+func (t *Track) decode(payload []byte) ([]byte, error) {
+	switch t.compression {
+	case -1:
+		return payload, nil
+	case compHeaderStripped:
+		return append(append([]byte{}, t.stripped...), payload...), nil
+	case compZlib:
+		zr, err := zlib.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("decompress frame: %w", err)
+		}
+		defer zr.Close()
+		out, err := io.ReadAll(io.LimitReader(zr, maxSubtitleFrame))
+		if err != nil {
+			return nil, fmt.Errorf("decompress frame: %w", err)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported content compression %d", t.compression)
+}
+
+// toCues converts frames to cues ordered by start time. Frames without a
+// duration last until the next frame, at most defaultCueDuration.
+func (f *File) toCues(t *Track, frames []frame) []subtitles.Cue {
+	sort.SliceStable(frames, func(i, j int) bool { return frames[i].start < frames[j].start })
+
+	scale := time.Duration(f.timestampScale)
+	cues := make([]subtitles.Cue, 0, len(frames))
+	for i, fr := range frames {
+		text, ok := frameText(t.CodecID, fr.data)
+		if !ok {
+			continue
+		}
+		start := time.Duration(fr.start) * scale
+		end := start + time.Duration(fr.duration)*scale
+		if fr.duration == 0 {
+			end = start + defaultCueDuration
+			if i+1 < len(frames) {
+				if next := time.Duration(frames[i+1].start) * scale; next > start && next < end {
+					end = next
+				}
+			}
+		}
+		cues = append(cues, subtitles.Cue{Start: start, End: end, Text: text})
+	}
+	return cues
+}
+
+// frameText extracts the plain text of a subtitle frame. ASS/SSA frames hold
+// a dialogue line without its timing: ReadOrder, Layer, Style, Name,
+// MarginL, MarginR, MarginV, Effect, Text.
+func frameText(codecID string, data []byte) (string, bool) {
+	switch strings.ToUpper(codecID) {
+	case "S_TEXT/ASS", "S_TEXT/SSA", "S_ASS", "S_SSA":
+		fields := strings.SplitN(string(data), ",", 9)
+		if len(fields) != 9 {
+			return "", false
+		}
+		return subtitles.CleanASSText(fields[8])
+	case "S_TEXT/WEBVTT":
+		text := strings.TrimSpace(string(data))
+		return text, text != ""
+	default:
+		text := strings.TrimSpace(subtitles.CleanSRTText(string(data)))
+		return text, text != ""
+	}
+}
@@ -0,0 +1,113 @@
+package matroska
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// simpleBlock encodes a SimpleBlock of track 1..126 with a 16-bit relative
+// timestamp and the given flags.
+func simpleBlock(track byte, rel int16, flags byte, payload string) []byte {
+	data := append([]byte{0x80 | track, byte(uint16(rel) >> 8), byte(rel), flags}, payload...)
+	return el(idSimpleBlock, data)
+}
+
+func TestReadFrame(t *testing.T) {
+	sub := &Track{Number: 3, CodecID: "S_TEXT/UTF8", compression: -1}
+	stripped := &Track{Number: 3, CodecID: "S_TEXT/UTF8", compression: compHeaderStripped, stripped: []byte("He")}
+
+	tests := []struct {
+		name         string
+		track        *Track
+		in           []byte
+		wantOK       bool
+		wantErr      error
+		wantStart    int64
+		wantDuration uint64
+		wantData     string
+	}{
+		{
+			name:      "simple block",
+			track:     sub,
+			in:        simpleBlock(3, 250, 0x80, "Hello"),
+			wantOK:    true,
+			wantStart: 1250,
+			wantData:  "Hello",
+		},
+		{
+			name:      "negative relative time",
+			track:     sub,
+			in:        simpleBlock(3, -100, 0x80, "Hi"),
+			wantOK:    true,
+			wantStart: 900,
+			wantData:  "Hi",
+		},
+		{
+			name:  "other track",
+			track: sub,
+			in:    simpleBlock(1, 0, 0x80, "video"),
+		},
+		{
+			name:  "block group with duration",
+			track: sub,
+			in: el(idBlockGroup,
+				el(idBlock, []byte{0x83, 0x00, 0x0A, 0x00}, []byte("Bye")),
+				el(idBlockDuration, []byte{0x07, 0xD0})),
+			wantOK:       true,
+			wantStart:    1010,
+			wantDuration: 2000,
+			wantData:     "Bye",
+		},
+		{
+			name:      "header stripping",
+			track:     stripped,
+			in:        simpleBlock(3, 0, 0x80, "llo"),
+			wantOK:    true,
+			wantStart: 1000,
+			wantData:  "Hello",
+		},
+		{
+			name:    "laced",
+			track:   sub,
+			in:      simpleBlock(3, 0, 0x82, "x"),
+			wantErr: errLaced,
+		},
+		{
+			name:  "too short",
+			track: sub,
+			in:    el(idSimpleBlock, []byte{0x83, 0x00}),
+		},
+		{
+			name:  "not a block",
+			track: sub,
+			in:    el(idTimestamp, []byte{0x01}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &File{r: bytes.NewReader(tt.in)}
+			e, err := readElement(f.r, 0)
+			if err != nil {
+				t.Fatalf("read element: %v", err)
+			}
+			fr, ok, err := f.readFrame(e, tt.track, 1000)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || ok != tt.wantOK {
+				t.Fatalf("got ok %t, err %v; want ok %t", ok, err, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if fr.start != tt.wantStart || fr.duration != tt.wantDuration || string(fr.data) != tt.wantData {
+				t.Errorf("got start %d, duration %d, data %q; want %d, %d, %q",
+					fr.start, fr.duration, fr.data, tt.wantStart, tt.wantDuration, tt.wantData)
+			}
+		})
+	}
+}
@@ -0,0 +1,465 @@
+package matroska
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Element IDs used by the reader (Matroska specification, RFC 9559).
+const (
+	idEBML    = 0x1A45DFA3
+	idDocType = 0x4282
+	idSegment = 0x18538067
+
+	idSeekHead     = 0x114D9B74
+	idSeek         = 0x4DBB
+	idSeekID       = 0x53AB
+	idSeekPosition = 0x53AC
+
+	idInfo           = 0x1549A966
+	idTimestampScale = 0x2AD7B1
+	idDuration       = 0x4489
+
+	idTracks          = 0x1654AE6B
+	idTrackEntry      = 0xAE
+	idTrackNumber     = 0xD7
+	idTrackType       = 0x83
+	idFlagDefault     = 0x88
+	idFlagForced      = 0x55AA
+	idCodecID         = 0x86
+	idLanguage        = 0x22B59C
+	idLanguageBCP47   = 0x22B59D
+	idName            = 0x536E
+	idContentEncs     = 0x6D80
+	idContentEnc      = 0x6240
+	idContentComp     = 0x5034
+	idContentCompAlgo = 0x4254
+	idContentCompSet  = 0x4255
+	idContentEncrypt  = 0x5035
+	idVideo           = 0xE0
+	idPixelWidth      = 0xB0
+	idPixelHeight     = 0xBA
+	idAudio           = 0xE1
+	idSamplingFreq    = 0xB5
+	idChannels        = 0x9F
+
+	idCues               = 0x1C53BB6B
+	idCuePoint           = 0xBB
+	idCueTime            = 0xB3
+	idCueTrackPositions  = 0xB7
+	idCueTrack           = 0xF7
+	idCueClusterPosition = 0xF1
+	idCueRelativePos     = 0xF0
+	idCueDuration        = 0xB2
+
+	idCluster       = 0x1F43B675
+	idTimestamp     = 0xE7
+	idSimpleBlock   = 0xA3
+	idBlockGroup    = 0xA0
+	idBlock         = 0xA1
+	idBlockDuration = 0x9B
+)
+
+// Track types.
+const (
+	TrackTypeVideo    = 1
+	TrackTypeAudio    = 2
+	TrackTypeSubtitle = 0x11
+)
+
+// Content compression algorithms.
+const (
+	compZlib           = 0
+	compHeaderStripped = 3
+)
+
+// Track is one entry of the file's track list.
+type Track struct {
+	Number   uint64 `json:"number"`
+	Type     uint64 `json:"type"`
+	CodecID  string `json:"codecId"`
+	Language string `json:"language"` // ISO 639-2 or BCP 47 tag
+	Name     string `json:"name,omitempty"`
+	Default  bool   `json:"default"`
+	Forced   bool   `json:"forced"`
+
+	// Video tracks.
+	Width  uint64 `json:"width,omitempty"`
+	Height uint64 `json:"height,omitempty"`
+
+	// Audio tracks.
+	SampleRate float64 `json:"sampleRate,omitempty"`
+	Channels   uint64  `json:"channels,omitempty"`
+
+	compression int    // -1 when frames aren't compressed
+	stripped    []byte // header removed by header stripping
+	encrypted   bool
+}
+
+// cuePoint is one track position of the cue index.
+type cuePoint struct {
+	time        uint64 // in timestamp ticks
+	track       uint64
+	clusterPos  int64 // relative to the segment data
+	relativePos int64 // block offset within the cluster data, or -1
+	duration    uint64
+}
+
+// File is an opened Matroska file: its header elements are parsed, the
+// clusters are read on demand.
+type File struct {
+	r    io.ReaderAt
+	size int64
+
+	segmentData    int64 // offset of the segment data; positions are relative to it
+	segmentEnd     int64
+	firstCluster   int64 // offset of the first cluster, or -1
+	timestampScale uint64
+	duration       float64 // in timestamp ticks, 0 if unknown
+
+	tracks  []*Track
+	cues    []cuePoint
+	cuesPos int64 // offset of the cue index if not read yet, or -1
+}
+
+// Open parses the header of a Matroska file of the given size: the segment
+// info and the track list. Elements stored after the clusters are located
+// through the SeekHead. The cue index, usually at the end of the file, is
+// only read once subtitles are extracted.
+func Open(r io.ReaderAt, size int64) (*File, error) {
+	header, err := readElement(r, 0)
+	if err != nil || header.id != idEBML {
+		return nil, ErrNotMatroska
+	}
+	headerData, err := readData(r, header)
+	if err != nil {
+		return nil, err
+	}
+	var docType string
+	eachChild(headerData, func(id uint32, payload []byte) error {
+		if id == idDocType {
+			docType = readString(payload)
+		}
+		return nil
+	})
+	if docType != "matroska" && docType != "webm" {
+		return nil, ErrNotMatroska
+	}
+
+	segment, err := readElement(r, header.end())
+	if err != nil {
+		return nil, fmt.Errorf("read segment: %w", err)
+	}
+	if segment.id != idSegment {
+		return nil, fmt.Errorf("expected segment, found element 0x%X", segment.id)
+	}
+
+	f := &File{
+		r:              r,
+		size:           size,
+		segmentData:    segment.dataOffset,
+		segmentEnd:     segment.end(),
+		firstCluster:   -1,
+		timestampScale: 1000000,
+		cuesPos:        -1,
+	}
+	if f.segmentEnd < 0 || f.segmentEnd > size {
+		f.segmentEnd = size
+	}
+
+	// Walk the top-level elements up to the first cluster; SeekHead
+	// entries cover what comes later (typically the cues).
+	seeks := make(map[uint32]int64)
+	parsed := make(map[uint32]bool)
+	for pos := f.segmentData; pos < f.segmentEnd; {
+		e, err := readElement(r, pos)
+		if err != nil {
+			return nil, fmt.Errorf("read element at %d: %w", pos, err)
+		}
+		if e.id == idCluster {
+			f.firstCluster = pos
+			break
+		}
+		if err := f.parseTopLevel(e, seeks); err != nil {
+			return nil, err
+		}
+		parsed[e.id] = true
+		if e.size == unknownSize {
+			break
+		}
+		pos = e.end()
+	}
+
+	for _, id := range []uint32{idInfo, idTracks} {
+		rel, ok := seeks[id]
+		if !ok || parsed[id] {
+			continue
+		}
+		e, err := readElement(r, f.segmentData+rel)
+		if err != nil || e.id != id {
+			continue // stale SeekHead entry
+		}
+		if err := f.parseTopLevel(e, seeks); err != nil {
+			return nil, err
+		}
+		parsed[id] = true
+	}
+
+	if !parsed[idTracks] {
+		return nil, fmt.Errorf("no track list found")
+	}
+	if rel, ok := seeks[idCues]; ok && !parsed[idCues] {
+		f.cuesPos = f.segmentData + rel
+	}
+	return f, nil
+}
+
+// loadCues reads the cue index the SeekHead points at, if Open didn't come
+// across it. The index is optional: on failure clusters get scanned instead.
+func (f *File) loadCues() {
+	if f.cuesPos < 0 {
+		return
+	}
+	pos := f.cuesPos
+	f.cuesPos = -1
+	e, err := readElement(f.r, pos)
+	if err != nil || e.id != idCues {
+		return // stale SeekHead entry
+	}
+	f.parseTopLevel(e, nil)
+}
+
+// parseTopLevel parses one of the header elements the reader uses; others
+// are ignored.
+func (f *File) parseTopLevel(e element, seeks map[uint32]int64) error {
+	switch e.id {
+	case idSeekHead, idInfo, idTracks, idCues:
+	default:
+		return nil
+	}
+
+	data, err := readData(f.r, e)
+	if err != nil {
+		if e.id == idCues {
+			return nil // the index is optional; clusters get scanned instead
+		}
+		return err
+	}
+
+	switch e.id {
+	case idSeekHead:
+		return eachChild(data, func(id uint32, payload []byte) error {
+			if id != idSeek {
+				return nil
+			}
+			var seekID uint32
+			pos := int64(-1)
+			eachChild(payload, func(id uint32, payload []byte) error {
+				switch id {
+				case idSeekID:
+					seekID = uint32(readUint(payload))
+				case idSeekPosition:
+					pos = int64(readUint(payload))
+				}
+				return nil
+			})
+			if _, seen := seeks[seekID]; seekID != 0 && pos >= 0 && !seen {
+				seeks[seekID] = pos
+			}
+			return nil
+		})
+
+	case idInfo:
+		return eachChild(data, func(id uint32, payload []byte) error {
+			switch id {
+			case idTimestampScale:
+				if v := readUint(payload); v > 0 {
+					f.timestampScale = v
+				}
+			case idDuration:
+				f.duration = readFloat(payload)
+			}
+			return nil
+		})
+
+	case idTracks:
+		return eachChild(data, func(id uint32, payload []byte) error {
+			if id == idTrackEntry {
+				if t := parseTrackEntry(payload); t.Number > 0 {
+					f.tracks = append(f.tracks, t)
+				}
+			}
+			return nil
+		})
+
+	case idCues:
+		return eachChild(data, func(id uint32, payload []byte) error {
+			if id == idCuePoint {
+				f.cues = append(f.cues, parseCuePoint(payload)...)
+			}
+			return nil
+		})
+	}
+	return nil
+}
+
+func parseTrackEntry(data []byte) *Track {
+	t := &Track{Language: "eng", Default: true, compression: -1}
+	var bcp47 string
+	eachChild(data, func(id uint32, payload []byte) error {
+		switch id {
+		case idTrackNumber:
+			t.Number = readUint(payload)
+		case idTrackType:
+			t.Type = readUint(payload)
+		case idFlagDefault:
+			t.Default = readUint(payload) != 0
+		case idFlagForced:
+			t.Forced = readUint(payload) != 0
+		case idCodecID:
+			t.CodecID = readString(payload)
+		case idLanguage:
+			t.Language = readString(payload)
+		case idLanguageBCP47:
+			bcp47 = readString(payload)
+		case idName:
+			t.Name = readString(payload)
+		case idContentEncs:
+			parseContentEncodings(t, payload)
+		case idVideo:
+			eachChild(payload, func(id uint32, payload []byte) error {
+				switch id {
+				case idPixelWidth:
+					t.Width = readUint(payload)
+				case idPixelHeight:
+					t.Height = readUint(payload)
+				}
+				return nil
+			})
+		case idAudio:
+			t.Channels = 1
+			eachChild(payload, func(id uint32, payload []byte) error {
+				switch id {
+				case idSamplingFreq:
+					t.SampleRate = readFloat(payload)
+				case idChannels:
+					t.Channels = readUint(payload)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	// LanguageBCP47 takes precedence over Language when present.
+	if bcp47 != "" {
+		t.Language = bcp47
+	}
+	return t
+}
+
+func parseContentEncodings(t *Track, data []byte) {
+	eachChild(data, func(id uint32, payload []byte) error {
+		if id != idContentEnc {
+			return nil
+		}
+		eachChild(payload, func(id uint32, payload []byte) error {
+			switch id {
+			case idContentComp:
+				t.compression = compZlib
+				eachChild(payload, func(id uint32, payload []byte) error {
+					switch id {
+					case idContentCompAlgo:
+						t.compression = int(readUint(payload))
+					case idContentCompSet:
+						t.stripped = payload
+					}
+					return nil
+				})
+			case idContentEncrypt:
+				t.encrypted = true
+			}
+			return nil
+		})
+		return nil
+	})
+}
+
+func parseCuePoint(data []byte) []cuePoint {
+	var cueTime uint64
+	var points []cuePoint
+	eachChild(data, func(id uint32, payload []byte) error {
+		switch id {
+		case idCueTime:
+			cueTime = readUint(payload)
+		case idCueTrackPositions:
+			p := cuePoint{relativePos: -1, clusterPos: -1}
+			eachChild(payload, func(id uint32, payload []byte) error {
+				switch id {
+				case idCueTrack:
+					p.track = readUint(payload)
+				case idCueClusterPosition:
+					p.clusterPos = int64(readUint(payload))
+				case idCueRelativePos:
+					p.relativePos = int64(readUint(payload))
+				case idCueDuration:
+					p.duration = readUint(payload)
+				}
+				return nil
+			})
+			if p.clusterPos >= 0 {
+				points = append(points, p)
+			}
+		}
+		return nil
+	})
+	for i := range points {
+		points[i].time = cueTime
+	}
+	return points
+}
+
+// Tracks returns the file's track list.
+func (f *File) Tracks() []*Track {
+	return f.tracks
+}
+
+// Duration returns the segment duration, or 0 if the file doesn't say.
+func (f *File) Duration() time.Duration {
+	return time.Duration(f.duration * float64(f.timestampScale))
+}
+
+// IsTextSubtitle reports whether the track is a text subtitle track the
+// package can extract.
+func (t *Track) IsTextSubtitle() bool {
+	if t.Type != TrackTypeSubtitle || t.encrypted {
+		return false
+	}
+	switch strings.ToUpper(t.CodecID) {
+	case "S_TEXT/UTF8", "S_TEXT/ASCII", "S_TEXT/ASS", "S_TEXT/SSA", "S_TEXT/WEBVTT", "S_ASS", "S_SSA":
+		return true
+	}
+	return false
+}
+
+// SubtitleTracks returns the text subtitle tracks of the file.
+func (f *File) SubtitleTracks() []*Track {
+	var out []*Track
+	for _, t := range f.tracks {
+		if t.IsTextSubtitle() {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// track returns the track with the given number, or nil.
+func (f *File) track(number uint64) *Track {
+	for _, t := range f.tracks {
+		if t.Number == number {
+			return t
+		}
+	}
+	return nil
+}
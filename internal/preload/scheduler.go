@@ -0,0 +1,419 @@
+package preload
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/config"
+	"github.com/krizcold/stremio-torrent-bridge/internal/engine"
+)
+
+const (
+	// preloadTimeout bounds a single metadata preload so a dead swarm can't
+	// hold a worker slot forever.
+	preloadTimeout = 60 * time.Second
+	// preloadedSaveDelay batches the preloads of one stream response into
+	// one write.
+	preloadedSaveDelay = 2 * time.Second
+)
+
+// job is a queued preload request.
+type job struct {
+	infoHash  string
+	magnetURI string
+	rank      int   // position in the addon's stream list (0 = best)
+	seq       int64 // enqueue order, newer lookups win ties
+	index     int   // heap index
+}
+
+// jobQueue is a min-heap ordered by rank, then by most recent enqueue.
+type jobQueue []*job
+
+func (q jobQueue) Len() int { return len(q) }
+
+func (q jobQueue) Less(i, j int) bool {
+	if q[i].rank != q[j].rank {
+		return q[i].rank < q[j].rank
+	}
+	return q[i].seq > q[j].seq
+}
+
+func (q jobQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *jobQueue) Push(x interface{}) {
+	item := x.(*job)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *jobQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*q = old[:n-1]
+	return item
+}
+
+// Scheduler preloads torrent metadata in the background with a bounded number
+// of concurrent engine calls. Streams ranked higher by the addon are preloaded
+// first, duplicate hashes are ignored, pending work is cancelled as soon as
+// the user starts playing something, and torrents that were preloaded but
+// never played are removed from the engine after a TTL. The preloaded
+// torrents are persisted to DATA_DIR/preloaded.json so the TTL still applies
+// across restarts.
+type Scheduler struct {
+	engine      engine.Engine
+	concurrency int
+	ttl         time.Duration
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	queue     jobQueue
+	queued    map[string]*job               // infoHash -> queued job
+	inFlight  map[string]context.CancelFunc // infoHash -> cancel for running preload
+	preloaded map[string]time.Time          // infoHash -> when it was preloaded (not yet played)
+	played    map[string]bool               // in-flight hashes that started playing meanwhile
+	seq       int64
+	stopped   bool
+
+	filePath    string      // persisted preloaded map
+	pendingSave *time.Timer // scheduled save of preloaded, if any; guarded by mu
+	saveMu      sync.Mutex  // serializes saves
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates a preload scheduler using the concurrency and TTL
+// limits from cfg.
+func NewScheduler(eng engine.Engine, cfg *config.Config) *Scheduler {
+	concurrency := cfg.PreloadConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	s := &Scheduler{
+		engine:      eng,
+		concurrency: concurrency,
+		ttl:         time.Duration(cfg.PreloadTTLMinutes) * time.Minute,
+		queued:      make(map[string]*job),
+		inFlight:    make(map[string]context.CancelFunc),
+		preloaded:   make(map[string]time.Time),
+		played:      make(map[string]bool),
+		filePath:    cfg.DataDir + "/preloaded.json",
+		stopCh:      make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	if err := s.load(); err != nil {
+		fmt.Printf("Preload: failed to load preloaded torrents: %v (starting fresh)\n", err)
+	}
+	return s
+}
+
+// Start launches the worker goroutines and the janitor that removes stale
+// preloaded torrents.
+func (s *Scheduler) Start() {
+	for i := 0; i < s.concurrency; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+	if s.ttl > 0 {
+		s.wg.Add(1)
+		go s.janitor()
+	}
+}
+
+// Stop cancels all pending and in-flight preloads and waits for the workers
+// to exit.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.clearQueueLocked()
+	for _, cancel := range s.inFlight {
+		cancel()
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	close(s.stopCh)
+	s.wg.Wait()
+}
+
+// Enqueue schedules a metadata preload for the given magnet URI. rank is the
+// stream's position in the addon response; lower ranks are preloaded first.
+// Hashes that are already queued, preloading, or preloaded are ignored,
+// except that a better rank bumps a queued job forward.
+func (s *Scheduler) Enqueue(magnetURI string, rank int) {
+	infoHash := engine.ParseInfoHashFromMagnet(magnetURI)
+	if infoHash == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return
+	}
+	if _, running := s.inFlight[infoHash]; running {
+		return
+	}
+	if _, done := s.preloaded[infoHash]; done {
+		return
+	}
+
+	s.seq++
+	if existing, ok := s.queued[infoHash]; ok {
+		if rank < existing.rank {
+			existing.rank = rank
+			existing.seq = s.seq
+			heap.Fix(&s.queue, existing.index)
+		}
+		return
+	}
+
+	j := &job{infoHash: infoHash, magnetURI: magnetURI, rank: rank, seq: s.seq}
+	heap.Push(&s.queue, j)
+	s.queued[infoHash] = j
+	s.cond.Signal()
+}
+
+// NotifyPlayback tells the scheduler the user started playing infoHash. All
+// queued and in-flight preloads for other torrents are cancelled so the
+// engine's bandwidth goes to playback, and infoHash is exempted from TTL
+// removal.
+func (s *Scheduler) NotifyPlayback(infoHash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.preloaded[infoHash]; ok {
+		delete(s.preloaded, infoHash)
+		s.scheduleSaveLocked()
+	}
+	if _, running := s.inFlight[infoHash]; running {
+		s.played[infoHash] = true
+	}
+
+	if len(s.queue) == 0 && len(s.inFlight) == 0 {
+		return
+	}
+
+	cancelled := len(s.queue)
+	s.clearQueueLocked()
+	for hash, cancel := range s.inFlight {
+		if hash == infoHash {
+			continue
+		}
+		cancel()
+		cancelled++
+	}
+
+	if cancelled > 0 {
+		fmt.Printf("Preload: playback of %s started, cancelled %d pending preloads\n", infoHash, cancelled)
+	}
+}
+
+// worker pops the highest-priority job and preloads it, until Stop is called.
+func (s *Scheduler) worker() {
+	defer s.wg.Done()
+
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.stopped {
+			s.cond.Wait()
+		}
+		if s.stopped {
+			s.mu.Unlock()
+			return
+		}
+
+		j := heap.Pop(&s.queue).(*job)
+		delete(s.queued, j.infoHash)
+
+		ctx, cancel := context.WithTimeout(context.Background(), preloadTimeout)
+		s.inFlight[j.infoHash] = cancel
+		s.mu.Unlock()
+
+		added := s.preload(ctx, j)
+		cancel()
+
+		s.mu.Lock()
+		delete(s.inFlight, j.infoHash)
+		if added && !s.played[j.infoHash] {
+			s.preloaded[j.infoHash] = time.Now()
+			s.scheduleSaveLocked()
+		}
+		delete(s.played, j.infoHash)
+		s.mu.Unlock()
+	}
+}
+
+// preload adds the torrent to the engine for metadata resolution. It returns
+// true if the torrent may now be in the engine because of us, so the janitor
+// knows to clean it up. Torrents the engine already had are left alone, and
+// so are those it only remembered without adding (qBittorrent adds them on
+// first play).
+func (s *Scheduler) preload(ctx context.Context, j *job) bool {
+	existing, err := s.engine.GetTorrent(ctx, j.infoHash)
+	if err == nil && existing != nil {
+		return false
+	}
+
+	if _, err := s.engine.PreloadTorrent(ctx, j.magnetURI); err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled) {
+			// The engine may have accepted the magnet before we cancelled.
+			return true
+		}
+		fmt.Printf("Preload: %s: %v\n", j.infoHash, err)
+		return false
+	}
+
+	added, err := s.engine.GetTorrent(ctx, j.infoHash)
+	if err != nil {
+		// Unknown; clean up later just in case.
+		return true
+	}
+	return added != nil
+}
+
+// janitor periodically removes torrents that were preloaded but never played
+// within the TTL.
+func (s *Scheduler) janitor() {
+	defer s.wg.Done()
+
+	interval := s.ttl / 4
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.removeExpired()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// removeExpired removes every preloaded-but-unplayed torrent older than the TTL.
+func (s *Scheduler) removeExpired() {
+	cutoff := time.Now().Add(-s.ttl)
+
+	s.mu.Lock()
+	var expired []string
+	for hash, at := range s.preloaded {
+		if at.Before(cutoff) {
+			expired = append(expired, hash)
+			delete(s.preloaded, hash)
+		}
+	}
+	if len(expired) > 0 {
+		s.scheduleSaveLocked()
+	}
+	s.mu.Unlock()
+
+	removed := 0
+	for _, hash := range expired {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := s.engine.RemoveTorrent(ctx, hash, true)
+		cancel()
+		if err != nil {
+			fmt.Printf("Preload: failed to remove unplayed %s: %v\n", hash, err)
+			continue
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		fmt.Printf("Preload: removed %d unplayed torrents older than %s\n", removed, s.ttl)
+	}
+}
+
+// scheduleSaveLocked saves the preloaded torrents after preloadedSaveDelay
+// unless a save is already scheduled. Caller must hold s.mu.
+func (s *Scheduler) scheduleSaveLocked() {
+	if s.pendingSave != nil {
+		return
+	}
+	s.pendingSave = time.AfterFunc(preloadedSaveDelay, func() {
+		s.mu.Lock()
+		s.pendingSave = nil
+		s.mu.Unlock()
+
+		if err := s.save(); err != nil {
+			fmt.Printf("Preload: failed to save preloaded torrents: %v\n", err)
+		}
+	})
+}
+
+// load reads the persisted preloaded torrents. Returns nil if the file does
+// not exist (a fresh start is fine).
+func (s *Scheduler) load() error {
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read %s: %w", s.filePath, err)
+	}
+
+	var preloaded map[string]time.Time
+	if err := json.Unmarshal(data, &preloaded); err != nil {
+		return fmt.Errorf("parse %s: %w", s.filePath, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, at := range preloaded {
+		if hash != "" {
+			s.preloaded[hash] = at
+		}
+	}
+
+	return nil
+}
+
+// save writes the preloaded torrents to disk, replacing the file atomically.
+func (s *Scheduler) save() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	data, err := json.Marshal(s.preloaded)
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	tmp := s.filePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, s.filePath); err != nil {
+		return fmt.Errorf("replace %s: %w", s.filePath, err)
+	}
+
+	return nil
+}
+
+// clearQueueLocked drops all queued jobs. Caller must hold s.mu.
+func (s *Scheduler) clearQueueLocked() {
+	s.queue = s.queue[:0]
+	s.queued = make(map[string]*job)
+}
@@ -0,0 +1,105 @@
+package probe
+
+import (
+	"io"
+	"strings"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/matroska"
+	"github.com/krizcold/stremio-torrent-bridge/internal/subtitles"
+)
+
+// matroskaCodecs maps Matroska codec IDs to the names Info uses. Codec IDs
+// with a profile suffix ("A_AAC/MPEG4/LC") match on their prefix.
+var matroskaCodecs = map[string]string{
+	"V_MPEG4/ISO/AVC":  "h264",
+	"V_MPEGH/ISO/HEVC": "hevc",
+	"V_AV1":            "av1",
+	"V_VP8":            "vp8",
+	"V_VP9":            "vp9",
+	"V_MPEG4/ISO/ASP":  "mpeg4",
+	"V_MPEG4/ISO/SP":   "mpeg4",
+	"V_MPEG2":          "mpeg2",
+	"V_MS/VFW/FOURCC":  "vfw",
+
+	"A_AAC":         "aac",
+	"A_AC3":         "ac3",
+	"A_EAC3":        "eac3",
+	"A_DTS":         "dts",
+	"A_TRUEHD":      "truehd",
+	"A_OPUS":        "opus",
+	"A_VORBIS":      "vorbis",
+	"A_FLAC":        "flac",
+	"A_MPEG/L3":     "mp3",
+	"A_MPEG/L2":     "mp2",
+	"A_PCM/INT/LIT": "pcm",
+
+	"S_TEXT/UTF8":   "srt",
+	"S_TEXT/ASCII":  "srt",
+	"S_TEXT/ASS":    "ass",
+	"S_TEXT/SSA":    "ssa",
+	"S_ASS":         "ass",
+	"S_SSA":         "ssa",
+	"S_TEXT/WEBVTT": "webvtt",
+	"S_HDMV/PGS":    "pgs",
+	"S_VOBSUB":      "vobsub",
+	"S_DVBSUB":      "dvbsub",
+}
+
+// readMatroska describes a Matroska or WebM file from its track list.
+func readMatroska(r io.ReaderAt, size int64) (*Info, error) {
+	f, err := matroska.Open(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		Container: "matroska",
+		Duration:  f.Duration().Seconds(),
+		Audio:     make([]AudioTrack, 0),
+		Subtitles: make([]SubtitleTrack, 0),
+	}
+	for _, t := range f.Tracks() {
+		codec := matroskaCodec(t.CodecID)
+		switch t.Type {
+		case matroska.TrackTypeVideo:
+			// The first video track is the movie; later ones are usually
+			// cover art or alternate angles.
+			if info.Video == nil {
+				info.Video = &VideoTrack{Codec: codec, Width: int(t.Width), Height: int(t.Height)}
+			}
+		case matroska.TrackTypeAudio:
+			info.Audio = append(info.Audio, AudioTrack{
+				Codec:      codec,
+				Language:   subtitles.LanguageCode(t.Language),
+				Name:       t.Name,
+				Channels:   int(t.Channels),
+				SampleRate: int(t.SampleRate),
+				Default:    t.Default,
+			})
+		case matroska.TrackTypeSubtitle:
+			info.Subtitles = append(info.Subtitles, SubtitleTrack{
+				Codec:    codec,
+				Language: subtitles.LanguageCode(t.Language),
+				Name:     t.Name,
+				Default:  t.Default,
+				Forced:   t.Forced,
+			})
+		}
+	}
+	return info, nil
+}
+
+// matroskaCodec names a Matroska codec ID, falling back to the ID itself.
+func matroskaCodec(codecID string) string {
+	id := strings.ToUpper(codecID)
+	for {
+		if name, ok := matroskaCodecs[id]; ok {
+			return name
+		}
+		i := strings.LastIndexByte(id, '/')
+		if i < 0 {
+			return strings.ToLower(codecID)
+		}
+		id = id[:i]
+	}
+}
@@ -0,0 +1,360 @@
+package probe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/subtitles"
+)
+
+// maxMoovSize bounds the movie box read into memory. Its sample tables grow
+// with the duration; a feature film's is a few megabytes.
+const maxMoovSize = 64 << 20
+
+// mp4Codecs maps MP4 sample entry types to the names Info uses.
+var mp4Codecs = map[string]string{
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "hevc",
+	"hev1": "hevc",
+	"dvh1": "hevc",
+	"dvhe": "hevc",
+	"av01": "av1",
+	"vp08": "vp8",
+	"vp09": "vp9",
+	"mp4v": "mpeg4",
+
+	"mp4a": "aac",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"dtsc": "dts",
+	"dtsh": "dts",
+	"dtsl": "dts",
+	"mlpa": "truehd",
+	"Opus": "opus",
+	"fLaC": "flac",
+	".mp3": "mp3",
+
+	"tx3g": "tx3g",
+	"wvtt": "webvtt",
+	"stpp": "ttml",
+	"c608": "cea608",
+}
+
+// mp4Box is a box header located in the file.
+type mp4Box struct {
+	typ        string
+	dataOffset int64
+	end        int64
+}
+
+// readMP4 describes an MP4 (ISO BMFF) file from its movie box. The
+// top-level boxes are walked by their headers only, so a movie box stored
+// after the media data costs one read near the end of the file.
+func readMP4(r io.ReaderAt, size int64) (*Info, error) {
+	for pos := int64(0); pos+8 <= size; {
+		b, err := readMP4Box(r, pos, size)
+		if err != nil {
+			return nil, err
+		}
+		if b.typ == "moov" {
+			if b.end-b.dataOffset > maxMoovSize {
+				return nil, fmt.Errorf("movie box too large (%d bytes)", b.end-b.dataOffset)
+			}
+			data := make([]byte, b.end-b.dataOffset)
+			if _, err := r.ReadAt(data, b.dataOffset); err != nil {
+				return nil, fmt.Errorf("read movie box: %w", err)
+			}
+			return parseMoov(data), nil
+		}
+		pos = b.end
+	}
+	return nil, fmt.Errorf("no movie box found")
+}
+
+// readMP4Box reads the box header at off. A size of 0 extends the box to
+// the end of the file.
+func readMP4Box(r io.ReaderAt, off, fileSize int64) (mp4Box, error) {
+	var head [16]byte
+	n, err := r.ReadAt(head[:], off)
+	if n < 8 {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return mp4Box{}, fmt.Errorf("read box at %d: %w", off, err)
+	}
+
+	b := mp4Box{typ: string(head[4:8]), dataOffset: off + 8}
+	switch size := int64(binary.BigEndian.Uint32(head[:4])); size {
+	case 0:
+		b.end = fileSize
+	case 1:
+		if n < 16 {
+			return mp4Box{}, fmt.Errorf("read box at %d: %w", off, io.ErrUnexpectedEOF)
+		}
+		b.dataOffset = off + 16
+		b.end = off + int64(binary.BigEndian.Uint64(head[8:16]))
+	default:
+		b.end = off + size
+	}
+	if b.end < b.dataOffset {
+		return mp4Box{}, fmt.Errorf("invalid size of box %q at %d", b.typ, off)
+	}
+	return b, nil
+}
+
+// eachBox calls fn for every box in data, in order. A truncated last box is
+// passed with what remains.
+func eachBox(data []byte, fn func(typ string, payload []byte)) {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		typ := string(data[4:8])
+		start := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			start = 16
+		}
+		if size < start {
+			return
+		}
+		if size > uint64(len(data)) {
+			size = uint64(len(data))
+		}
+		fn(typ, data[start:size])
+		data = data[size:]
+	}
+}
+
+// findBox returns the payload of the box at the given path below data, or
+// nil.
+func findBox(data []byte, path ...string) []byte {
+	for _, want := range path {
+		var found []byte
+		eachBox(data, func(typ string, payload []byte) {
+			if found == nil && typ == want {
+				found = payload
+			}
+		})
+		if found == nil {
+			return nil
+		}
+		data = found
+	}
+	return data
+}
+
+// mp4Track is what parseTrak reads from one track box.
+type mp4Track struct {
+	id         uint32
+	handler    string
+	codec      string
+	language   string
+	name       string
+	enabled    bool
+	width      int
+	height     int
+	channels   int
+	sampleRate int
+	chapters   []uint32 // track IDs this track uses as chapter lists
+}
+
+// parseMoov describes the file from the movie box payload.
+func parseMoov(moov []byte) *Info {
+	info := &Info{
+		Container: "mp4",
+		Audio:     make([]AudioTrack, 0),
+		Subtitles: make([]SubtitleTrack, 0),
+	}
+
+	if mvhd := findBox(moov, "mvhd"); len(mvhd) >= 32 {
+		var timescale, duration uint64
+		if mvhd[0] == 1 {
+			timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+			duration = binary.BigEndian.Uint64(mvhd[24:32])
+		} else {
+			timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+			duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+		}
+		if timescale > 0 && duration != 0xFFFFFFFF && duration != 1<<64-1 {
+			info.Duration = float64(duration) / float64(timescale)
+		}
+	}
+
+	var tracks []mp4Track
+	chapterTracks := make(map[uint32]bool)
+	eachBox(moov, func(typ string, payload []byte) {
+		if typ != "trak" {
+			return
+		}
+		t := parseTrak(payload)
+		for _, id := range t.chapters {
+			chapterTracks[id] = true
+		}
+		tracks = append(tracks, t)
+	})
+
+	for _, t := range tracks {
+		switch t.handler {
+		case "vide":
+			if info.Video == nil {
+				info.Video = &VideoTrack{Codec: t.codec, Width: t.width, Height: t.height}
+			}
+		case "soun":
+			info.Audio = append(info.Audio, AudioTrack{
+				Codec:      t.codec,
+				Language:   t.language,
+				Name:       t.name,
+				Channels:   t.channels,
+				SampleRate: t.sampleRate,
+				Default:    t.enabled,
+			})
+		case "sbtl", "subt", "text":
+			// QuickTime chapter lists are text tracks too.
+			if chapterTracks[t.id] {
+				continue
+			}
+			info.Subtitles = append(info.Subtitles, SubtitleTrack{
+				Codec:    t.codec,
+				Language: t.language,
+				Name:     t.name,
+				Default:  t.enabled,
+			})
+		}
+	}
+	return info
+}
+
+// parseTrak reads the header, handler, language and first sample
+// description of a track box.
+func parseTrak(trak []byte) mp4Track {
+	t := mp4Track{language: "und"}
+
+	if tkhd := findBox(trak, "tkhd"); len(tkhd) >= 24 {
+		t.enabled = tkhd[3]&0x01 != 0
+		if tkhd[0] == 1 {
+			t.id = binary.BigEndian.Uint32(tkhd[20:24])
+		} else {
+			t.id = binary.BigEndian.Uint32(tkhd[12:16])
+		}
+	}
+
+	if chap := findBox(trak, "tref", "chap"); chap != nil {
+		for i := 0; i+4 <= len(chap); i += 4 {
+			t.chapters = append(t.chapters, binary.BigEndian.Uint32(chap[i:]))
+		}
+	}
+
+	if mdhd := findBox(trak, "mdia", "mdhd"); len(mdhd) >= 24 {
+		off := 20 // version 0: 32-bit times and duration
+		if mdhd[0] == 1 {
+			off = 32
+		}
+		if len(mdhd) >= off+2 {
+			t.language = mp4Language(binary.BigEndian.Uint16(mdhd[off:]))
+		}
+	}
+
+	if hdlr := findBox(trak, "mdia", "hdlr"); len(hdlr) >= 12 {
+		t.handler = string(hdlr[8:12])
+		if len(hdlr) > 24 {
+			t.name = handlerName(hdlr[24:])
+		}
+	}
+
+	// stsd: version and flags, entry count, then the sample entries.
+	stsd := findBox(trak, "mdia", "minf", "stbl", "stsd")
+	if len(stsd) < 8 {
+		return t
+	}
+	eachBox(stsd[8:], func(typ string, entry []byte) {
+		if t.codec != "" {
+			return
+		}
+		t.codec = mp4Codec(typ, entry)
+		switch t.handler {
+		case "vide":
+			// 8 bytes of sample entry header, 16 reserved, then the size.
+			if len(entry) >= 28 {
+				t.width = int(binary.BigEndian.Uint16(entry[24:26]))
+				t.height = int(binary.BigEndian.Uint16(entry[26:28]))
+			}
+		case "soun":
+			// 8 bytes of sample entry header, 8 reserved, channel count,
+			// sample size, 4 reserved, then the 16.16 sample rate.
+			if len(entry) >= 28 {
+				t.channels = int(binary.BigEndian.Uint16(entry[16:18]))
+				t.sampleRate = int(binary.BigEndian.Uint32(entry[24:28]) >> 16)
+			}
+		}
+	})
+	return t
+}
+
+// mp4Codec names a sample entry. Encrypted entries ("encv", "enca") keep
+// the original type in their protection scheme box.
+func mp4Codec(typ string, entry []byte) string {
+	if typ == "encv" || typ == "enca" {
+		if frma := findEncryptedFormat(entry); frma != "" {
+			typ = frma
+		}
+	}
+	if name, ok := mp4Codecs[typ]; ok {
+		return name
+	}
+	return typ
+}
+
+// findEncryptedFormat looks for the original format box ("sinf/frma")
+// among the boxes following a sample entry's fixed fields.
+func findEncryptedFormat(entry []byte) string {
+	// The fixed fields are 78 bytes for video entries and 28 for audio
+	// ones; try both.
+	for _, skip := range []int{78, 28} {
+		if len(entry) <= skip {
+			continue
+		}
+		if frma := findBox(entry[skip:], "sinf", "frma"); len(frma) >= 4 {
+			return string(frma[:4])
+		}
+	}
+	return ""
+}
+
+// mp4Language decodes the packed ISO 639-2/T code of a media header.
+func mp4Language(packed uint16) string {
+	if packed == 0 || packed == 0x7FFF {
+		return "und"
+	}
+	code := []byte{
+		byte(packed>>10&0x1F) + 0x60,
+		byte(packed>>5&0x1F) + 0x60,
+		byte(packed&0x1F) + 0x60,
+	}
+	return subtitles.LanguageCode(string(code))
+}
+
+// handlerName returns the name of a handler box when it names the track.
+// Most muxers write their own name there instead ("SoundHandler", "Core
+// Media Audio"), which is dropped. QuickTime files store a Pascal string.
+func handlerName(b []byte) string {
+	if len(b) > 0 && int(b[0]) == len(b)-1 {
+		b = b[1:]
+	}
+	name := string(b)
+	if i := strings.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.TrimSpace(name)
+	if strings.Contains(name, "Handler") || strings.HasPrefix(name, "Core Media") {
+		return ""
+	}
+	return name
+}
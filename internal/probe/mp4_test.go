@@ -0,0 +1,160 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// box encodes an MP4 box with a 32-bit size.
+func box(typ string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(data)))
+	return append(append(b, typ...), data...)
+}
+
+// fields returns n zero bytes with the given values written at their
+// offsets.
+func fields(n int, set map[int][]byte) []byte {
+	b := make([]byte, n)
+	for off, v := range set {
+		copy(b[off:], v)
+	}
+	return b
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+// packLanguage packs an ISO 639-2/T code the way mdhd stores it.
+func packLanguage(code string) []byte {
+	return u16(uint16(code[0]-0x60)<<10 | uint16(code[1]-0x60)<<5 | uint16(code[2]-0x60))
+}
+
+// trak builds a track box with the given ID, handler, language and sample
+// entry.
+func trak(id uint32, handler, lang string, entry []byte, extra ...[]byte) []byte {
+	tkhd := fields(84, map[int][]byte{3: {0x01}, 12: u32(id)})
+	mdhd := fields(24, map[int][]byte{20: packLanguage(lang)})
+	hdlr := fields(24, map[int][]byte{8: []byte(handler)})
+	stsd := append(fields(8, map[int][]byte{4: u32(1)}), entry...)
+	return box("trak", append([][]byte{
+		box("tkhd", tkhd),
+		box("mdia",
+			box("mdhd", mdhd),
+			box("hdlr", hdlr),
+			box("minf", box("stbl", box("stsd", stsd)))),
+	}, extra...)...)
+}
+
+func TestReadMP4Box(t *testing.T) {
+	large := append(u32(1), "mdat"...)
+	large = append(large, binary.BigEndian.AppendUint64(nil, 1<<33)...)
+
+	tests := []struct {
+		name     string
+		in       []byte
+		off      int64
+		fileSize int64
+		want     mp4Box
+		wantErr  bool
+	}{
+		{"plain", box("ftyp", []byte("isom")), 0, 100, mp4Box{typ: "ftyp", dataOffset: 8, end: 12}, false},
+		{"at offset", append(make([]byte, 4), box("moov")...), 4, 100, mp4Box{typ: "moov", dataOffset: 12, end: 12}, false},
+		{"to end of file", append(u32(0), "mdat"...), 0, 5000, mp4Box{typ: "mdat", dataOffset: 8, end: 5000}, false},
+		{"64-bit size", large, 0, 1 << 34, mp4Box{typ: "mdat", dataOffset: 16, end: 1 << 33}, false},
+		{"truncated 64-bit size", append(u32(1), "mdat"...), 0, 100, mp4Box{}, true},
+		{"size below header", append(u32(4), "free"...), 0, 100, mp4Box{}, true},
+		{"truncated header", []byte{0, 0, 0}, 0, 100, mp4Box{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readMP4Box(bytes.NewReader(tt.in), tt.off, tt.fileSize)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEachBox(t *testing.T) {
+	type entry struct {
+		typ     string
+		payload string
+	}
+	tests := []struct {
+		name string
+		in   []byte
+		want []entry
+	}{
+		{"siblings", append(box("free", []byte("ab")), box("skip")...), []entry{{"free", "ab"}, {"skip", ""}}},
+		{"truncated last box", append(u32(20), "free..."...), []entry{{"free", "..."}}},
+		{"size 0 runs to the end", append(u32(0), "mdat12"...), []entry{{"mdat", "12"}}},
+		{"size below header stops", append(u32(3), "free"...), nil},
+		{"short header", []byte{0, 0, 0, 8, 'f'}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []entry
+			eachBox(tt.in, func(typ string, payload []byte) {
+				got = append(got, entry{typ, string(payload)})
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMoov(t *testing.T) {
+	mvhd := fields(100, map[int][]byte{12: u32(1000), 16: u32(5400000)})
+	video := box("avc1", fields(70, map[int][]byte{24: u16(1920), 26: u16(1080)}))
+	audio := box("mp4a", fields(28, map[int][]byte{16: u16(6), 24: u32(48000 << 16)}))
+	text := box("tx3g", fields(30, nil))
+	moov := bytes.Join([][]byte{
+		box("mvhd", mvhd),
+		trak(1, "vide", "und", video, box("tref", box("chap", u32(4)))),
+		trak(2, "soun", "fra", audio),
+		trak(3, "sbtl", "eng", text),
+		trak(4, "text", "eng", text), // chapter list
+	}, nil)
+
+	want := &Info{
+		Container: "mp4",
+		Duration:  5400,
+		Video:     &VideoTrack{Codec: "h264", Width: 1920, Height: 1080},
+		Audio:     []AudioTrack{{Codec: "aac", Language: "fre", Channels: 6, SampleRate: 48000, Default: true}},
+		Subtitles: []SubtitleTrack{{Codec: "tx3g", Language: "eng", Default: true}},
+	}
+	if got := parseMoov(moov); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseMoovEmpty(t *testing.T) {
+	got := parseMoov(nil)
+	if got.Video != nil || len(got.Audio) != 0 || len(got.Subtitles) != 0 || got.Duration != 0 {
+		t.Errorf("got %+v, want an empty description", got)
+	}
+}
+
+func FuzzEachBox(f *testing.F) {
+	f.Add(box("moov", box("trak", box("tkhd", make([]byte, 84)))))
+	f.Add(append(u32(1), "mdat"...))
+	f.Add(append(u32(0), "mdat"...))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		total := 0
+		eachBox(data, func(_ string, payload []byte) {
+			total += len(payload)
+		})
+		if total > len(data) {
+			t.Fatalf("boxes hold %d bytes of %d", total, len(data))
+		}
+		// The whole moov parser must not panic on any input.
+		parseMoov(data)
+	})
+}
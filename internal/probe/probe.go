@@ -0,0 +1,176 @@
+// Package probe describes the tracks of a video file inside a torrent by
+// reading its container headers through the engine: the Matroska/WebM track
+// list and the MP4 movie box. Only headers are read, so probing a file the
+// engine hasn't downloaded fetches its first pieces (and, for MP4 files with
+// the movie box at the end, its last ones).
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/engine"
+)
+
+// ErrUnsupported is returned for files that are neither Matroska nor MP4.
+var ErrUnsupported = errors.New("unsupported container")
+
+// Info describes the tracks of a video file.
+type Info struct {
+	Container string          `json:"container"`          // "matroska" or "mp4"
+	Duration  float64         `json:"duration,omitempty"` // in seconds, 0 if unknown
+	Video     *VideoTrack     `json:"video,omitempty"`    // the main video track
+	Audio     []AudioTrack    `json:"audio"`
+	Subtitles []SubtitleTrack `json:"subtitles"`
+}
+
+// VideoTrack describes a video track.
+type VideoTrack struct {
+	Codec  string `json:"codec"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// AudioTrack describes an audio track.
+type AudioTrack struct {
+	Codec      string `json:"codec"`
+	Language   string `json:"language"` // ISO 639-2/B, "und" if unknown
+	Name       string `json:"name,omitempty"`
+	Channels   int    `json:"channels,omitempty"`
+	SampleRate int    `json:"sampleRate,omitempty"`
+	Default    bool   `json:"default,omitempty"`
+}
+
+// SubtitleTrack describes a subtitle track.
+type SubtitleTrack struct {
+	Codec    string `json:"codec"`
+	Language string `json:"language"` // ISO 639-2/B, "und" if unknown
+	Name     string `json:"name,omitempty"`
+	Default  bool   `json:"default,omitempty"`
+	Forced   bool   `json:"forced,omitempty"`
+}
+
+// Probe reads the container headers of a file in a torrent through the
+// engine.
+func Probe(ctx context.Context, eng engine.Engine, infoHash string, fileIdx int) (*Info, error) {
+	file, err := engine.FindFile(ctx, eng, infoHash, fileIdx)
+	if err != nil {
+		return nil, err
+	}
+	if file.Size <= 0 {
+		return nil, fmt.Errorf("file size unknown")
+	}
+	return Read(engine.NewFileReader(ctx, eng, infoHash, fileIdx, file.Size), file.Size)
+}
+
+// Read describes a file of the given size, detecting its container from the
+// first bytes.
+func Read(r io.ReaderAt, size int64) (*Info, error) {
+	var magic [12]byte
+	n, err := r.ReadAt(magic[:], 0)
+	if n < len(magic) {
+		if err == nil || err == io.EOF {
+			return nil, ErrUnsupported
+		}
+		return nil, err
+	}
+
+	switch {
+	case magic[0] == 0x1A && magic[1] == 0x45 && magic[2] == 0xDF && magic[3] == 0xA3:
+		return readMatroska(r, size)
+	case string(magic[4:8]) == "ftyp":
+		return readMP4(r, size)
+	}
+	return nil, ErrUnsupported
+}
+
+// Summary describes the file in one line for stream titles, such as
+// "🎞 1080p HEVC · 🔊 ENG AC3 5.1, JPN AAC 2.0 · 💬 ENG, SPA +3". Parts
+// with nothing to say are left out; it returns "" if all are.
+func (i *Info) Summary() string {
+	var parts []string
+
+	if v := i.Video; v != nil {
+		desc := strings.ToUpper(v.Codec)
+		if res := resolutionLabel(v.Width, v.Height); res != "" {
+			desc = res + " " + desc
+		}
+		parts = append(parts, "🎞 "+desc)
+	}
+
+	if len(i.Audio) > 0 {
+		tracks := make([]string, 0, len(i.Audio))
+		for _, a := range i.Audio {
+			desc := strings.ToUpper(a.Codec)
+			if a.Language != "und" {
+				desc = strings.ToUpper(a.Language) + " " + desc
+			}
+			if layout := channelLayout(a.Channels); layout != "" {
+				desc += " " + layout
+			}
+			tracks = append(tracks, desc)
+		}
+		parts = append(parts, "🔊 "+strings.Join(limitList(tracks, 3), ", "))
+	}
+
+	if len(i.Subtitles) > 0 {
+		var langs []string
+		seen := make(map[string]bool)
+		for _, s := range i.Subtitles {
+			lang := strings.ToUpper(s.Language)
+			if !seen[lang] {
+				seen[lang] = true
+				langs = append(langs, lang)
+			}
+		}
+		parts = append(parts, "💬 "+strings.Join(limitList(langs, 3), ", "))
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+// limitList keeps the first max items, noting how many were left out.
+func limitList(items []string, max int) []string {
+	if len(items) <= max {
+		return items
+	}
+	return append(items[:max:max], fmt.Sprintf("+%d", len(items)-max))
+}
+
+// resolutionLabel names a frame size the way release names do. Widths catch
+// cropped frames (1920x800 is still 1080p).
+func resolutionLabel(width, height int) string {
+	switch {
+	case width >= 3800 || height >= 2100:
+		return "4K"
+	case width >= 2500 || height >= 1400:
+		return "1440p"
+	case width >= 1900 || height >= 1000:
+		return "1080p"
+	case width >= 1260 || height >= 700:
+		return "720p"
+	case height > 0:
+		return fmt.Sprintf("%dp", height)
+	}
+	return ""
+}
+
+// channelLayout names common channel counts.
+func channelLayout(channels int) string {
+	switch channels {
+	case 0:
+		return ""
+	case 1:
+		return "1.0"
+	case 2:
+		return "2.0"
+	case 6:
+		return "5.1"
+	case 8:
+		return "7.1"
+	}
+	return fmt.Sprintf("%dch", channels)
+}
@@ -0,0 +1,164 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/engine"
+	"github.com/krizcold/stremio-torrent-bridge/pkg/fifocache"
+)
+
+const (
+	// maxEntries bounds the in-memory cache of probe results; the oldest
+	// results are dropped first.
+	maxEntries = 2000
+	// probeTimeout bounds probing in the background. The header pieces may
+	// still have to come from the swarm.
+	probeTimeout = 2 * time.Minute
+	// failureBackoff is how long a file that couldn't be probed is left
+	// alone before trying again.
+	failureBackoff = 10 * time.Minute
+	// maxConcurrent bounds simultaneous probes.
+	maxConcurrent = 2
+)
+
+// Prober probes files through the engine and caches the results per
+// infoHash and file index, in memory: probing again after a restart only
+// costs a few Range reads. It is safe for concurrent use.
+type Prober struct {
+	engine  engine.Engine
+	sem     chan struct{}
+	entries *fifocache.Cache[*Info] // "infoHash/fileIdx" -> result
+
+	mu       sync.Mutex
+	inFlight map[string]*probeCall // keys being probed
+	failed   map[string]time.Time  // keys -> skip until
+}
+
+// probeCall is a running probe that callers can wait on.
+type probeCall struct {
+	done chan struct{} // closed when the probe ends
+	info *Info
+	err  error
+}
+
+// NewProber creates a Prober reading files through eng.
+func NewProber(eng engine.Engine) *Prober {
+	return &Prober{
+		engine:   eng,
+		sem:      make(chan struct{}, maxConcurrent),
+		entries:  fifocache.New[*Info](maxEntries),
+		inFlight: make(map[string]*probeCall),
+		failed:   make(map[string]time.Time),
+	}
+}
+
+func key(infoHash string, fileIdx int) string {
+	return strings.ToLower(infoHash) + "/" + strconv.Itoa(fileIdx)
+}
+
+// Get returns the cached result for a file, if it has been probed.
+func (p *Prober) Get(infoHash string, fileIdx int) (*Info, bool) {
+	return p.entries.Get(key(infoHash, fileIdx))
+}
+
+// Probe returns the cached result for a file, probing it now if there is
+// none. A probe already running for the file is shared, and a new one waits
+// for a slot like background probes do. If ctx ends first the probe goes on
+// in the background and its result is cached.
+func (p *Prober) Probe(ctx context.Context, infoHash string, fileIdx int) (*Info, error) {
+	if info, ok := p.Get(infoHash, fileIdx); ok {
+		return info, nil
+	}
+
+	call := p.start(strings.ToLower(infoHash), fileIdx)
+	select {
+	case <-call.done:
+		return call.info, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Request schedules a file to be probed in the background, unless it is
+// cached, already being probed, or recently failed. Call it only for files
+// whose first pieces are available or being fetched anyway, since reading
+// them otherwise makes the engine download them.
+func (p *Prober) Request(infoHash string, fileIdx int) {
+	infoHash = strings.ToLower(infoHash)
+	k := key(infoHash, fileIdx)
+
+	if _, done := p.entries.Get(k); done {
+		return
+	}
+	p.mu.Lock()
+	until, failed := p.failed[k]
+	p.mu.Unlock()
+	if failed && time.Now().Before(until) {
+		return
+	}
+	p.start(infoHash, fileIdx)
+}
+
+// start returns the probe running for a file, starting one if there is none.
+func (p *Prober) start(infoHash string, fileIdx int) *probeCall {
+	k := key(infoHash, fileIdx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if call, ok := p.inFlight[k]; ok {
+		return call
+	}
+	call := &probeCall{done: make(chan struct{})}
+	p.inFlight[k] = call
+	go p.run(k, infoHash, fileIdx, call)
+	return call
+}
+
+// run probes a file once a slot is free, caches the result and completes
+// call.
+func (p *Prober) run(k, infoHash string, fileIdx int, call *probeCall) {
+	p.sem <- struct{}{}
+	defer func() { <-p.sem }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	call.info, call.err = Probe(ctx, p.engine, infoHash, fileIdx)
+	if call.err == nil {
+		p.store(k, call.info)
+	}
+
+	p.mu.Lock()
+	delete(p.inFlight, k)
+	if call.err != nil {
+		p.failed[k] = time.Now().Add(failureBackoff)
+	}
+	p.mu.Unlock()
+	close(call.done)
+
+	if call.err != nil {
+		fmt.Printf("Probe: %s file %d: %v\n", infoHash, fileIdx, call.err)
+	}
+}
+
+// store caches a result, dropping the oldest above maxEntries.
+func (p *Prober) store(k string, info *Info) {
+	p.entries.Put(k, info)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.failed, k)
+
+	now := time.Now()
+	for fk, until := range p.failed {
+		if now.After(until) {
+			delete(p.failed, fk)
+		}
+	}
+}
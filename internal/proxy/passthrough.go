@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber"
+
+	"github.com/krizcold/stremio-torrent-bridge/pkg/httpclient"
+)
+
+// passthroughTarget is the payload encoded into a passthrough token: the
+// remote URL plus the behaviorHints.proxyHeaders the addon asked for.
+type passthroughTarget struct {
+	URL             string            `json:"u"`
+	RequestHeaders  map[string]string `json:"rq,omitempty"`
+	ResponseHeaders map[string]string `json:"rs,omitempty"`
+}
+
+// HTTPPassthrough streams plain HTTP(S) url streams (debrid links, direct
+// files) through the bridge so Stremio Web gets proper CORS headers and the
+// addon's proxyHeaders are applied server-side for every player.
+//
+// Targets are encoded into signed, self-contained tokens so links survive
+// restarts and the endpoint can't be used as an open proxy. Targets only
+// come from addon responses, which may be untrusted (auto-wrapped addons),
+// so private and loopback addresses are refused unless allowlisted.
+type HTTPPassthrough struct {
+	key    []byte
+	client *http.Client
+}
+
+// NewHTTPPassthrough creates a passthrough proxy whose signing key is stored
+// in dataDir (generated on first use). Hosts matching privateHosts (exact or
+// subdomain) may resolve to non-public addresses.
+func NewHTTPPassthrough(dataDir string, privateHosts []string) (*HTTPPassthrough, error) {
+	key, err := loadOrCreateKey(dataDir + "/passthrough.key")
+	if err != nil {
+		return nil, err
+	}
+	allowPrivate := func(host string) bool {
+		return httpclient.MatchHost(host, privateHosts)
+	}
+	return &HTTPPassthrough{
+		key:    key,
+		client: httpclient.NewStreamingPublicOnly(allowPrivate),
+	}, nil
+}
+
+// Token encodes and signs a passthrough target. Only http and https URLs are
+// accepted.
+func (p *HTTPPassthrough) Token(rawURL string, requestHeaders, responseHeaders map[string]string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("passthrough: unsupported URL %q", rawURL)
+	}
+
+	payload, err := json.Marshal(passthroughTarget{
+		URL:             rawURL,
+		RequestHeaders:  requestHeaders,
+		ResponseHeaders: responseHeaders,
+	})
+	if err != nil {
+		return "", fmt.Errorf("passthrough: encode target: %w", err)
+	}
+
+	enc := base64.RawURLEncoding.EncodeToString(payload)
+	return enc + "." + p.sign(enc), nil
+}
+
+// HandleStream is the Fiber v1 handler for GET and HEAD /stream/http/:token.
+// It fetches the remote URL with the addon's requested headers, forwards
+// Range-related headers from the client, and streams the body back with zero
+// buffering. HEAD requests are forwarded as HEAD, for players that probe the
+// file first.
+func (p *HTTPPassthrough) HandleStream(c *fiber.Ctx) {
+	target, err := p.decode(param(c, "token"))
+	if err != nil {
+		c.Status(http.StatusForbidden)
+		c.Set("Content-Type", "application/json")
+		c.SendString(`{"error":"invalid passthrough token"}`)
+		return
+	}
+
+	method := http.MethodGet
+	if c.Method() == http.MethodHead {
+		method = http.MethodHead
+	}
+	req, err := http.NewRequestWithContext(context.Background(), method, target.URL, nil)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		c.Set("Content-Type", "application/json")
+		c.SendString(`{"error":"failed to construct upstream request"}`)
+		return
+	}
+
+	for k, v := range target.RequestHeaders {
+		req.Header.Set(k, v)
+	}
+	forwardHeaders := []string{"Range", "If-Range", "If-None-Match", "Accept"}
+	for _, h := range forwardHeaders {
+		if v := c.Get(h); v != "" {
+			req.Header.Set(h, v)
+		}
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		c.Status(http.StatusBadGateway)
+		c.Set("Content-Type", "application/json")
+		errJSON, _ := json.Marshal(map[string]string{
+			"error": fmt.Sprintf("passthrough fetch failed: %v", err),
+		})
+		c.SendString(string(errJSON))
+		return
+	}
+
+	c.Status(resp.StatusCode)
+
+	for key, values := range resp.Header {
+		if _, skip := hopByHopHeaders[http.CanonicalHeaderKey(key)]; skip {
+			continue
+		}
+		// Keep our own CORS headers (set by the middleware) instead of
+		// whatever the remote host sent.
+		if strings.HasPrefix(http.CanonicalHeaderKey(key), "Access-Control-") {
+			continue
+		}
+		for _, v := range values {
+			c.Set(key, v)
+		}
+	}
+	for k, v := range target.ResponseHeaders {
+		c.Set(k, v)
+	}
+
+	if method == http.MethodHead {
+		resp.Body.Close()
+		if resp.ContentLength >= 0 {
+			c.Fasthttp.Response.Header.SetContentLength(int(resp.ContentLength))
+		}
+		return
+	}
+
+	contentLength := int(resp.ContentLength)
+	if resp.ContentLength < 0 {
+		contentLength = -1
+	}
+	c.Fasthttp.Response.SetBodyStream(resp.Body, contentLength)
+}
+
+// decode verifies a token's signature and returns the target it encodes.
+func (p *HTTPPassthrough) decode(token string) (*passthroughTarget, error) {
+	// Allow an optional trailing "/filename" for players that sniff extensions.
+	if idx := strings.Index(token, "/"); idx != -1 {
+		token = token[:idx]
+	}
+
+	enc, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(p.sign(enc))) {
+		return nil, fmt.Errorf("bad signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, fmt.Errorf("decode token: %w", err)
+	}
+
+	var target passthroughTarget
+	if err := json.Unmarshal(payload, &target); err != nil {
+		return nil, fmt.Errorf("parse token: %w", err)
+	}
+	return &target, nil
+}
+
+// sign returns the truncated HMAC-SHA256 of the encoded payload.
+func (p *HTTPPassthrough) sign(enc string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(enc))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// loadOrCreateKey reads a hex-encoded signing key from path, generating and
+// saving a new random one if the file doesn't exist.
+func loadOrCreateKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) == 0 {
+			return nil, fmt.Errorf("invalid key in %s", path)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)), 0600); err != nil {
+		return nil, fmt.Errorf("write %s: %w", path, err)
+	}
+	return key, nil
+}
@@ -6,11 +6,14 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber"
 
 	"github.com/krizcold/stremio-torrent-bridge/internal/cache"
 	"github.com/krizcold/stremio-torrent-bridge/internal/engine"
+	"github.com/krizcold/stremio-torrent-bridge/internal/preload"
+	"github.com/krizcold/stremio-torrent-bridge/internal/videohash"
 )
 
 // param reads a named value from Fiber context, checking Locals first (set by
@@ -39,12 +42,17 @@ var hopByHopHeaders = map[string]struct{}{
 type StreamProxy struct {
 	engine       engine.Engine
 	cacheManager *cache.CacheManager // may be nil
+	preloader    *preload.Scheduler  // may be nil
+	hasher       *videohash.Hasher   // may be nil
 }
 
 // NewStreamProxy creates a new StreamProxy backed by the given engine.
-// The optional cacheManager records access times for LRU eviction.
-func NewStreamProxy(eng engine.Engine, cm *cache.CacheManager) *StreamProxy {
-	return &StreamProxy{engine: eng, cacheManager: cm}
+// The optional cacheManager records access times for LRU eviction, and the
+// optional preloader is told about playback so it can cancel pending preloads.
+// The optional hasher computes the played file's video hash for subtitle
+// matching.
+func NewStreamProxy(eng engine.Engine, cm *cache.CacheManager, preloader *preload.Scheduler, hasher *videohash.Hasher) *StreamProxy {
+	return &StreamProxy{engine: eng, cacheManager: cm, preloader: preloader, hasher: hasher}
 }
 
 // HandleStream is the Fiber v1 handler for GET /stream/:infoHash/:fileIndex.
@@ -71,6 +79,11 @@ func (sp *StreamProxy) HandleStream(c *fiber.Ctx) {
 		fileIndex = parsed
 	}
 
+	// Playback takes priority over background metadata preloads.
+	if sp.preloader != nil {
+		sp.preloader.NotifyPlayback(strings.ToLower(infoHash))
+	}
+
 	// Build a standard *http.Request so the engine adapter can read Range
 	// and other relevant headers for partial content support.
 	reqURL := fmt.Sprintf("http://localhost/stream/%s/%d", infoHash, fileIndex)
@@ -117,6 +130,13 @@ func (sp *StreamProxy) HandleStream(c *fiber.Ctx) {
 		}()
 	}
 
+	// Playback fetches the pieces the video hash is computed from (players
+	// read the head and usually the tail for the container index), so hash
+	// the file now for the next stream listing.
+	if sp.hasher != nil {
+		sp.hasher.Request(infoHash, fileIndex, 0)
+	}
+
 	// Set the response status code. This correctly handles both 200 OK and
 	// 206 Partial Content from Range requests.
 	c.Status(resp.StatusCode)
@@ -0,0 +1,106 @@
+package scrape
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// maxBencodeDepth bounds how deeply lists and dictionaries may nest, so a
+// hostile tracker can't exhaust the stack.
+const maxBencodeDepth = 32
+
+// errBencode is returned for malformed bencoded data.
+var errBencode = errors.New("malformed bencode")
+
+// decodeBencode decodes a single bencoded value. Integers become int64,
+// strings become string (raw bytes, not necessarily UTF-8), lists become
+// []interface{} and dictionaries become map[string]interface{}.
+func decodeBencode(data []byte) (interface{}, error) {
+	v, rest, err := decodeValue(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", errBencode, len(rest))
+	}
+	return v, nil
+}
+
+func decodeValue(data []byte, depth int) (interface{}, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: unexpected end of data", errBencode)
+	}
+	if depth > maxBencodeDepth {
+		return nil, nil, fmt.Errorf("%w: nested too deeply", errBencode)
+	}
+
+	switch c := data[0]; {
+	case c == 'i':
+		end := bytes.IndexByte(data, 'e')
+		if end < 0 {
+			return nil, nil, fmt.Errorf("%w: unterminated integer", errBencode)
+		}
+		n, err := strconv.ParseInt(string(data[1:end]), 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: bad integer", errBencode)
+		}
+		return n, data[end+1:], nil
+
+	case c == 'l':
+		var list []interface{}
+		rest := data[1:]
+		for len(rest) > 0 && rest[0] != 'e' {
+			v, r, err := decodeValue(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			list = append(list, v)
+			rest = r
+		}
+		if len(rest) == 0 {
+			return nil, nil, fmt.Errorf("%w: unterminated list", errBencode)
+		}
+		return list, rest[1:], nil
+
+	case c == 'd':
+		dict := make(map[string]interface{})
+		rest := data[1:]
+		for len(rest) > 0 && rest[0] != 'e' {
+			k, r, err := decodeValue(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("%w: non-string dictionary key", errBencode)
+			}
+			v, r, err := decodeValue(r, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			dict[key] = v
+			rest = r
+		}
+		if len(rest) == 0 {
+			return nil, nil, fmt.Errorf("%w: unterminated dictionary", errBencode)
+		}
+		return dict, rest[1:], nil
+
+	case c >= '0' && c <= '9':
+		colon := bytes.IndexByte(data, ':')
+		if colon < 0 {
+			return nil, nil, fmt.Errorf("%w: bad string length", errBencode)
+		}
+		n, err := strconv.Atoi(string(data[:colon]))
+		// Compare without adding to n, which may be near MaxInt.
+		if err != nil || n < 0 || n > len(data)-colon-1 {
+			return nil, nil, fmt.Errorf("%w: bad string length", errBencode)
+		}
+		start := colon + 1
+		return string(data[start : start+n]), data[start+n:], nil
+	}
+
+	return nil, nil, fmt.Errorf("%w: unexpected byte %q", errBencode, data[0])
+}
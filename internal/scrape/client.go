@@ -0,0 +1,220 @@
+// Package scrape asks BitTorrent trackers for live swarm sizes, using HTTP
+// scrape (BEP 48) and the UDP tracker protocol (BEP 15).
+package scrape
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krizcold/stremio-torrent-bridge/pkg/httpclient"
+)
+
+const (
+	// resultTTL is how long a scrape result is reused.
+	resultTTL = 10 * time.Minute
+	// trackerBackoff is how long a tracker that failed is skipped.
+	trackerBackoff = 5 * time.Minute
+	// maxTrackers bounds how many trackers one Scrape call contacts.
+	maxTrackers = 8
+)
+
+// Result is the swarm size of one torrent. When several trackers answer,
+// the largest counts are kept.
+type Result struct {
+	Seeders   int       `json:"seeders"`
+	Leechers  int       `json:"leechers"`
+	Completed int       `json:"completed"` // downloads reported by the tracker
+	ScrapedAt time.Time `json:"scrapedAt"`
+}
+
+// merge keeps the larger counts of two results for the same torrent.
+func (r Result) merge(o Result) Result {
+	if o.Seeders > r.Seeders {
+		r.Seeders = o.Seeders
+	}
+	if o.Leechers > r.Leechers {
+		r.Leechers = o.Leechers
+	}
+	if o.Completed > r.Completed {
+		r.Completed = o.Completed
+	}
+	if o.ScrapedAt.After(r.ScrapedAt) {
+		r.ScrapedAt = o.ScrapedAt
+	}
+	return r
+}
+
+// Client scrapes trackers and caches the results per infoHash. It is safe
+// for concurrent use.
+type Client struct {
+	httpClient *http.Client
+	udp        *udpScraper
+
+	mu      sync.Mutex
+	results map[string]Result    // infoHash -> last merged result
+	failed  map[string]time.Time // tracker URL -> skip until
+}
+
+// NewClient creates a scrape client.
+func NewClient() *Client {
+	return &Client{
+		httpClient: httpclient.New(),
+		udp:        newUDPScraper(),
+		results:    make(map[string]Result),
+		failed:     make(map[string]time.Time),
+	}
+}
+
+// Scrape returns the swarm size of each torrent, scraping the trackers each
+// one lists. trackers maps a lowercase hex infoHash to its tracker URLs.
+// Cached results are reused; everything else is scraped concurrently until
+// ctx expires. Torrents no tracker answered for are missing from the result.
+func (c *Client) Scrape(ctx context.Context, trackers map[string][]string) map[string]Result {
+	now := time.Now()
+	out := make(map[string]Result, len(trackers))
+	pending := make(map[string][]string) // tracker URL -> infoHashes
+
+	c.mu.Lock()
+	for hash, urls := range trackers {
+		if r, ok := c.results[hash]; ok && now.Sub(r.ScrapedAt) < resultTTL {
+			out[hash] = r
+			continue
+		}
+		for _, u := range urls {
+			if until, ok := c.failed[u]; ok && now.Before(until) {
+				continue
+			}
+			pending[u] = append(pending[u], hash)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(pending) == 0 {
+		return out
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, tracker := range busiestTrackers(pending, maxTrackers) {
+		wg.Add(1)
+		go func(tracker string, hashes []string) {
+			defer wg.Done()
+			results, err := c.scrapeTracker(ctx, tracker, hashes)
+			if err != nil {
+				// Running out of budget isn't the tracker's fault.
+				if ctx.Err() == nil {
+					c.mu.Lock()
+					c.failed[tracker] = time.Now().Add(trackerBackoff)
+					c.mu.Unlock()
+				}
+				return
+			}
+			mu.Lock()
+			for hash, r := range results {
+				if prev, ok := out[hash]; ok {
+					r = prev.merge(r)
+				}
+				out[hash] = r
+			}
+			mu.Unlock()
+		}(tracker, pending[tracker])
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	for hash, r := range out {
+		c.results[hash] = r
+	}
+	c.pruneLocked(now)
+	c.mu.Unlock()
+
+	return out
+}
+
+// pruneLocked drops expired results and tracker backoffs. Caller must hold
+// c.mu.
+func (c *Client) pruneLocked(now time.Time) {
+	for hash, r := range c.results {
+		if now.Sub(r.ScrapedAt) >= resultTTL {
+			delete(c.results, hash)
+		}
+	}
+	for tracker, until := range c.failed {
+		if now.After(until) {
+			delete(c.failed, tracker)
+		}
+	}
+}
+
+// scrapeTracker scrapes a batch of infoHashes from one tracker.
+func (c *Client) scrapeTracker(ctx context.Context, tracker string, hashes []string) (map[string]Result, error) {
+	u, err := url.Parse(tracker)
+	if err != nil {
+		return nil, fmt.Errorf("parse tracker URL: %w", err)
+	}
+
+	raw := make([][20]byte, 0, len(hashes))
+	for _, h := range hashes {
+		b, err := hex.DecodeString(h)
+		if err != nil || len(b) != 20 {
+			continue
+		}
+		var ih [20]byte
+		copy(ih[:], b)
+		raw = append(raw, ih)
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return c.scrapeHTTP(ctx, u, raw)
+	case "udp":
+		return c.udp.scrape(ctx, u.Host, raw)
+	}
+	return nil, fmt.Errorf("unsupported tracker scheme %q", u.Scheme)
+}
+
+// TrackerURL extracts a tracker URL from a Stremio stream "sources" entry.
+// Entries are either plain URLs or prefixed with "tracker:"; DHT entries and
+// anything that isn't an http(s) or udp URL return "".
+func TrackerURL(source string) string {
+	source = strings.TrimPrefix(source, "tracker:")
+	lower := strings.ToLower(source)
+	if strings.HasPrefix(lower, "udp://") || strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		return source
+	}
+	return ""
+}
+
+// busiestTrackers returns up to n tracker URLs, preferring those listed by
+// the most torrents so a small budget covers as many streams as possible.
+func busiestTrackers(pending map[string][]string, n int) []string {
+	trackers := make([]string, 0, len(pending))
+	for t := range pending {
+		trackers = append(trackers, t)
+	}
+	sort.Slice(trackers, func(i, j int) bool {
+		if len(pending[trackers[i]]) != len(pending[trackers[j]]) {
+			return len(pending[trackers[i]]) > len(pending[trackers[j]])
+		}
+		return trackers[i] < trackers[j]
+	})
+	if len(trackers) > n {
+		trackers = trackers[:n]
+	}
+	return trackers
+}
+
+// errNotScrapeable is returned for HTTP trackers whose announce URL doesn't
+// follow the convention that makes a scrape URL derivable (BEP 48).
+var errNotScrapeable = errors.New("tracker does not support scrape")
@@ -0,0 +1,178 @@
+package scrape
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/scrape/scrapetest"
+)
+
+const (
+	hashA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	hashB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+func newTracker(t *testing.T) *scrapetest.Tracker {
+	t.Helper()
+	tr, err := scrapetest.NewTracker(map[string]scrapetest.Swarm{
+		hashA: {Seeders: 12, Leechers: 3, Completed: 40},
+		hashB: {Seeders: 0, Leechers: 1, Completed: 2},
+	})
+	if err != nil {
+		t.Fatalf("start tracker: %v", err)
+	}
+	t.Cleanup(tr.Close)
+	return tr
+}
+
+func scrape(c *Client, trackers map[string][]string) map[string]Result {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return c.Scrape(ctx, trackers)
+}
+
+func TestScrapeHTTPAndUDP(t *testing.T) {
+	for _, proto := range []string{"http", "udp"} {
+		t.Run(proto, func(t *testing.T) {
+			tr := newTracker(t)
+			announce := tr.HTTPAnnounceURL
+			if proto == "udp" {
+				announce = tr.UDPAnnounceURL
+			}
+
+			c := NewClient()
+			got := scrape(c, map[string][]string{
+				hashA: {announce},
+				hashB: {announce},
+			})
+
+			if r := got[hashA]; r.Seeders != 12 || r.Leechers != 3 || r.Completed != 40 {
+				t.Errorf("%s: got %+v for A, want 12 seeders, 3 leechers, 40 completed", hashA, r)
+			}
+			if r, ok := got[hashB]; !ok || r.Seeders != 0 || r.Leechers != 1 {
+				t.Errorf("%s: got %+v (found %t) for B, want 0 seeders, 1 leecher", hashB, r, ok)
+			}
+			if n := tr.Requests(); n != 1 {
+				t.Errorf("tracker answered %d scrapes, want 1 batched scrape", n)
+			}
+
+			// Cached results are reused without asking again.
+			scrape(c, map[string][]string{hashA: {announce}})
+			if n := tr.Requests(); n != 1 {
+				t.Errorf("tracker answered %d scrapes after a cached lookup, want 1", n)
+			}
+		})
+	}
+}
+
+func TestScrapeURL(t *testing.T) {
+	tests := []struct {
+		announce string
+		want     string
+	}{
+		{"http://tracker.example/announce", "http://tracker.example/scrape"},
+		{"http://tracker.example/x/announce.php", "http://tracker.example/x/scrape.php"},
+		{"http://tracker.example/announce?passkey=abc", "http://tracker.example/scrape?passkey=abc"},
+		{"http://tracker.example/a/announce/", ""},
+		{"http://tracker.example/x/annonce", ""},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.announce)
+		got, err := scrapeURL(u)
+		if tt.want == "" {
+			if !errors.Is(err, errNotScrapeable) {
+				t.Errorf("scrapeURL(%q) = %v, %v; want errNotScrapeable", tt.announce, got, err)
+			}
+			continue
+		}
+		if err != nil || got.String() != tt.want {
+			t.Errorf("scrapeURL(%q) = %v, %v; want %s", tt.announce, got, err, tt.want)
+		}
+	}
+}
+
+func TestScrapeHTTPPasskeyAnnounce(t *testing.T) {
+	tr := newTracker(t)
+	got := scrape(NewClient(), map[string][]string{hashA: {tr.HTTPAnnounceURL + "?passkey=secret"}})
+	if got[hashA].Seeders != 12 {
+		t.Errorf("got %+v, want the swarm scraped through the rewritten URL", got[hashA])
+	}
+}
+
+func TestScrapeTrackerFailureBacksOff(t *testing.T) {
+	tr := newTracker(t)
+	tr.SetFailure("unregistered torrent")
+
+	c := NewClient()
+	trackers := map[string][]string{hashA: {tr.HTTPAnnounceURL}}
+	if got := scrape(c, trackers); len(got) != 0 {
+		t.Fatalf("got %v from a failing tracker, want nothing", got)
+	}
+	if n := tr.Requests(); n != 1 {
+		t.Fatalf("tracker answered %d scrapes, want 1", n)
+	}
+
+	// The tracker is skipped while backing off, even once it recovers.
+	tr.SetFailure("")
+	if got := scrape(c, trackers); len(got) != 0 {
+		t.Errorf("got %v while backing off, want nothing", got)
+	}
+	if n := tr.Requests(); n != 1 {
+		t.Errorf("tracker answered %d scrapes while backing off, want 1", n)
+	}
+}
+
+func TestScrapeMalformedResponse(t *testing.T) {
+	bodies := []string{
+		"d5:filesd9223372036854775807:xee", // length overflowing the bounds check
+		"d5:filesd20:",                     // truncated
+		"i42e",                             // not a dictionary
+		"garbage",
+	}
+	for _, body := range bodies {
+		tr := newTracker(t)
+		tr.SetRawResponse(body)
+		if got := scrape(NewClient(), map[string][]string{hashA: {tr.HTTPAnnounceURL}}); len(got) != 0 {
+			t.Errorf("body %q: got %v, want nothing", body, got)
+		}
+	}
+}
+
+func TestDecodeBencode(t *testing.T) {
+	v, err := decodeBencode([]byte("d4:listli1ei-2ee3:str3:abce"))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	dict := v.(map[string]interface{})
+	if list := dict["list"].([]interface{}); len(list) != 2 || list[1] != int64(-2) {
+		t.Errorf("list = %v, want [1 -2]", list)
+	}
+	if dict["str"] != "abc" {
+		t.Errorf("str = %v, want abc", dict["str"])
+	}
+
+	deep := make([]byte, 0, 2*(maxBencodeDepth+2))
+	for i := 0; i < maxBencodeDepth+2; i++ {
+		deep = append(deep, 'l')
+	}
+	for i := 0; i < maxBencodeDepth+2; i++ {
+		deep = append(deep, 'e')
+	}
+	for _, bad := range []string{
+		"9223372036854775807:x",
+		"18446744073709551615:x",
+		"3:ab",
+		"-1:",
+		"i12",
+		"d1:ae",
+		"di1ei2ee",
+		string(deep),
+	} {
+		if _, err := decodeBencode([]byte(bad)); !errors.Is(err, errBencode) {
+			t.Errorf("decodeBencode(%q) = %v, want errBencode", bad, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package scrape
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// httpBatchSize bounds the info_hash parameters per HTTP scrape request so
+// the URL stays well under common length limits.
+const httpBatchSize = 50
+
+// scrapeURL derives the scrape URL from an announce URL: the last path
+// segment must start with "announce", which is replaced by "scrape".
+func scrapeURL(announce *url.URL) (*url.URL, error) {
+	i := strings.LastIndex(announce.Path, "/")
+	if i < 0 || !strings.HasPrefix(announce.Path[i+1:], "announce") {
+		return nil, errNotScrapeable
+	}
+	u := *announce
+	u.Path = announce.Path[:i+1] + "scrape" + strings.TrimPrefix(announce.Path[i+1:], "announce")
+	return &u, nil
+}
+
+// scrapeHTTP scrapes an HTTP tracker (BEP 48), batching infoHashes.
+func (c *Client) scrapeHTTP(ctx context.Context, announce *url.URL, hashes [][20]byte) (map[string]Result, error) {
+	u, err := scrapeURL(announce)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]Result, len(hashes))
+	for start := 0; start < len(hashes); start += httpBatchSize {
+		end := start + httpBatchSize
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		if err := c.scrapeHTTPBatch(ctx, u, hashes[start:end], out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (c *Client) scrapeHTTPBatch(ctx context.Context, u *url.URL, hashes [][20]byte, out map[string]Result) error {
+	// info_hash is repeated once per torrent and carries the raw 20 bytes.
+	// Appending by hand keeps any existing parameters (passkeys) untouched.
+	query := u.RawQuery
+	for _, h := range hashes {
+		if query != "" {
+			query += "&"
+		}
+		query += "info_hash=" + url.QueryEscape(string(h[:]))
+	}
+	reqURL := *u
+	reqURL.RawQuery = query
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http scrape: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http scrape: unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("http scrape: read response: %w", err)
+	}
+
+	decoded, err := decodeBencode(body)
+	if err != nil {
+		return fmt.Errorf("http scrape: %w", err)
+	}
+	dict, ok := decoded.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("http scrape: %w: response is not a dictionary", errBencode)
+	}
+	if reason, ok := dict["failure reason"].(string); ok {
+		return fmt.Errorf("http scrape: tracker failure: %s", reason)
+	}
+	files, ok := dict["files"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("http scrape: %w: missing files dictionary", errBencode)
+	}
+
+	now := time.Now()
+	for rawHash, v := range files {
+		stats, ok := v.(map[string]interface{})
+		if !ok || len(rawHash) != 20 {
+			continue
+		}
+		out[hex.EncodeToString([]byte(rawHash))] = Result{
+			Seeders:   intField(stats, "complete"),
+			Leechers:  intField(stats, "incomplete"),
+			Completed: intField(stats, "downloaded"),
+			ScrapedAt: now,
+		}
+	}
+	return nil
+}
+
+// intField reads a bencoded integer from a dictionary, 0 if missing.
+func intField(dict map[string]interface{}, key string) int {
+	n, _ := dict[key].(int64)
+	return int(n)
+}
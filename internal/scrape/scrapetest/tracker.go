@@ -0,0 +1,208 @@
+// Package scrapetest provides a fake BitTorrent tracker that answers HTTP
+// (BEP 48) and UDP (BEP 15) scrapes from a fixed table, for exercising the
+// scrape client without the network.
+package scrapetest
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Swarm is the answer the fake tracker gives for one torrent.
+type Swarm struct {
+	Seeders   int
+	Leechers  int
+	Completed int
+}
+
+// Tracker is a running fake tracker. Unknown torrents are reported with an
+// empty swarm, like real trackers do.
+type Tracker struct {
+	// HTTPAnnounceURL is the HTTP announce URL; its scrape URL is derived
+	// from it by the usual convention.
+	HTTPAnnounceURL string
+	// UDPAnnounceURL is the udp:// announce URL.
+	UDPAnnounceURL string
+
+	httpServer *httptest.Server
+	udpConn    net.PacketConn
+
+	mu       sync.Mutex
+	swarms   map[[20]byte]Swarm
+	requests int
+	failure  string // failure reason HTTP scrapes are answered with
+	raw      string // HTTP scrape body overriding the table
+}
+
+// NewTracker starts a fake tracker on localhost serving swarms, keyed by hex
+// infoHash.
+func NewTracker(swarms map[string]Swarm) (*Tracker, error) {
+	t := &Tracker{swarms: make(map[[20]byte]Swarm, len(swarms))}
+	for h, s := range swarms {
+		raw, err := hex.DecodeString(h)
+		if err != nil || len(raw) != 20 {
+			return nil, fmt.Errorf("invalid infoHash %q", h)
+		}
+		var key [20]byte
+		copy(key[:], raw)
+		t.swarms[key] = s
+	}
+
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	t.udpConn = udpConn
+	t.UDPAnnounceURL = "udp://" + udpConn.LocalAddr().String() + "/announce"
+	go t.serveUDP()
+
+	t.httpServer = httptest.NewServer(http.HandlerFunc(t.handleHTTPScrape))
+	t.HTTPAnnounceURL = t.httpServer.URL + "/announce"
+
+	return t, nil
+}
+
+// Close stops both listeners.
+func (t *Tracker) Close() {
+	t.httpServer.Close()
+	t.udpConn.Close()
+}
+
+// Requests returns how many scrape requests (HTTP and UDP) were answered.
+func (t *Tracker) Requests() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.requests
+}
+
+// SetFailure makes HTTP scrapes answer with a tracker failure reason, or
+// from the table again if reason is "".
+func (t *Tracker) SetFailure(reason string) {
+	t.mu.Lock()
+	t.failure = reason
+	t.mu.Unlock()
+}
+
+// SetRawResponse makes HTTP scrapes answer with body verbatim, for
+// malformed responses, or from the table again if body is "".
+func (t *Tracker) SetRawResponse(body string) {
+	t.mu.Lock()
+	t.raw = body
+	t.mu.Unlock()
+}
+
+func (t *Tracker) lookup(h [20]byte) Swarm {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.swarms[h]
+}
+
+func (t *Tracker) countRequest() {
+	t.mu.Lock()
+	t.requests++
+	t.mu.Unlock()
+}
+
+// handleHTTPScrape answers GET /scrape?info_hash=...&info_hash=... with a
+// bencoded files dictionary.
+func (t *Tracker) handleHTTPScrape(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/scrape" {
+		http.NotFound(w, r)
+		return
+	}
+	t.countRequest()
+
+	t.mu.Lock()
+	failure, raw := t.failure, t.raw
+	t.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain")
+	if failure != "" {
+		fmt.Fprintf(w, "d14:failure reason%d:%se", len(failure), failure)
+		return
+	}
+	if raw != "" {
+		w.Write([]byte(raw))
+		return
+	}
+
+	var hashes [][20]byte
+	for _, v := range r.URL.Query()["info_hash"] {
+		if len(v) != 20 {
+			continue
+		}
+		var h [20]byte
+		copy(h[:], v)
+		hashes = append(hashes, h)
+	}
+	// Bencoded dictionaries must have sorted keys.
+	sort.Slice(hashes, func(i, j int) bool {
+		return string(hashes[i][:]) < string(hashes[j][:])
+	})
+
+	var b strings.Builder
+	b.WriteString("d5:filesd")
+	for _, h := range hashes {
+		s := t.lookup(h)
+		fmt.Fprintf(&b, "20:%sd8:completei%de10:downloadedi%de10:incompletei%dee",
+			h[:], s.Seeders, s.Completed, s.Leechers)
+	}
+	b.WriteString("ee")
+
+	w.Write([]byte(b.String()))
+}
+
+// serveUDP answers connect and scrape packets until the listener closes.
+func (t *Tracker) serveUDP() {
+	const connectionID = 0x1122334455667788
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := t.udpConn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if n < 16 {
+			continue
+		}
+		action := binary.BigEndian.Uint32(buf[8:12])
+		tid := buf[12:16]
+
+		switch action {
+		case 0: // connect
+			resp := make([]byte, 16)
+			copy(resp[4:8], tid)
+			binary.BigEndian.PutUint64(resp[8:], connectionID)
+			t.udpConn.WriteTo(resp, addr)
+
+		case 2: // scrape
+			if binary.BigEndian.Uint64(buf[0:8]) != connectionID {
+				resp := make([]byte, 8, 32)
+				binary.BigEndian.PutUint32(resp[0:], 3)
+				copy(resp[4:8], tid)
+				t.udpConn.WriteTo(append(resp, "bad connection id"...), addr)
+				continue
+			}
+			t.countRequest()
+			count := (n - 16) / 20
+			resp := make([]byte, 8+12*count)
+			binary.BigEndian.PutUint32(resp[0:], 2)
+			copy(resp[4:8], tid)
+			for i := 0; i < count; i++ {
+				var h [20]byte
+				copy(h[:], buf[16+20*i:])
+				s := t.lookup(h)
+				off := 8 + 12*i
+				binary.BigEndian.PutUint32(resp[off:], uint32(s.Seeders))
+				binary.BigEndian.PutUint32(resp[off+4:], uint32(s.Completed))
+				binary.BigEndian.PutUint32(resp[off+8:], uint32(s.Leechers))
+			}
+			t.udpConn.WriteTo(resp, addr)
+		}
+	}
+}
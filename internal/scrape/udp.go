@@ -0,0 +1,179 @@
+package scrape
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// UDP tracker protocol constants (BEP 15).
+const (
+	udpProtocolID    = 0x41727101980
+	udpActionConnect = 0
+	udpActionScrape  = 2
+	udpActionError   = 3
+
+	// udpBatchSize is the most infoHashes one scrape packet may carry.
+	udpBatchSize = 74
+	// udpConnectionTTL is how long a connection ID may be reused; trackers
+	// accept it for two minutes, clients should use it for one.
+	udpConnectionTTL = time.Minute
+	// udpDefaultTimeout applies when the context has no deadline.
+	udpDefaultTimeout = 5 * time.Second
+)
+
+// udpConnection is a connection ID handed out by a tracker.
+type udpConnection struct {
+	id      uint64
+	expires time.Time
+}
+
+// udpScraper implements BEP 15 scrapes, caching connection IDs per tracker.
+type udpScraper struct {
+	mu    sync.Mutex
+	conns map[string]udpConnection // host:port -> connection ID
+}
+
+func newUDPScraper() *udpScraper {
+	return &udpScraper{conns: make(map[string]udpConnection)}
+}
+
+// scrape scrapes a UDP tracker at host (host:port), batching infoHashes.
+func (s *udpScraper) scrape(ctx context.Context, host string, hashes [][20]byte) (map[string]Result, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", host)
+	if err != nil {
+		return nil, fmt.Errorf("udp scrape: %w", err)
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(udpDefaultTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("udp scrape: %w", err)
+	}
+
+	connID, err := s.connectionID(conn, host)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]Result, len(hashes))
+	for start := 0; start < len(hashes); start += udpBatchSize {
+		end := start + udpBatchSize
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		if err := scrapeUDPBatch(conn, connID, hashes[start:end], out); err != nil {
+			// A rejected connection ID must not be reused.
+			s.mu.Lock()
+			delete(s.conns, host)
+			s.mu.Unlock()
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// connectionID returns a cached connection ID for the tracker or performs
+// the connect handshake.
+func (s *udpScraper) connectionID(conn net.Conn, host string) (uint64, error) {
+	s.mu.Lock()
+	c, ok := s.conns[host]
+	s.mu.Unlock()
+	if ok && time.Now().Before(c.expires) {
+		return c.id, nil
+	}
+
+	tid := transactionID()
+	req := make([]byte, 16)
+	binary.BigEndian.PutUint64(req[0:], udpProtocolID)
+	binary.BigEndian.PutUint32(req[8:], udpActionConnect)
+	binary.BigEndian.PutUint32(req[12:], tid)
+
+	resp, err := roundTrip(conn, req, udpActionConnect, tid, 16)
+	if err != nil {
+		return 0, fmt.Errorf("udp connect: %w", err)
+	}
+	id := binary.BigEndian.Uint64(resp[8:16])
+
+	s.mu.Lock()
+	s.conns[host] = udpConnection{id: id, expires: time.Now().Add(udpConnectionTTL)}
+	s.mu.Unlock()
+	return id, nil
+}
+
+// scrapeUDPBatch sends one scrape packet and stores the answers in out.
+func scrapeUDPBatch(conn net.Conn, connID uint64, hashes [][20]byte, out map[string]Result) error {
+	tid := transactionID()
+	req := make([]byte, 16+20*len(hashes))
+	binary.BigEndian.PutUint64(req[0:], connID)
+	binary.BigEndian.PutUint32(req[8:], udpActionScrape)
+	binary.BigEndian.PutUint32(req[12:], tid)
+	for i, h := range hashes {
+		copy(req[16+20*i:], h[:])
+	}
+
+	resp, err := roundTrip(conn, req, udpActionScrape, tid, 8+12*len(hashes))
+	if err != nil {
+		return fmt.Errorf("udp scrape: %w", err)
+	}
+
+	now := time.Now()
+	for i, h := range hashes {
+		off := 8 + 12*i
+		out[hex.EncodeToString(h[:])] = Result{
+			Seeders:   int(binary.BigEndian.Uint32(resp[off:])),
+			Completed: int(binary.BigEndian.Uint32(resp[off+4:])),
+			Leechers:  int(binary.BigEndian.Uint32(resp[off+8:])),
+			ScrapedAt: now,
+		}
+	}
+	return nil
+}
+
+// roundTrip sends a request and waits for the response with the matching
+// transaction ID, returning it once it is at least minLen bytes. Tracker
+// error responses are returned as errors.
+func roundTrip(conn net.Conn, req []byte, action, tid uint32, minLen int) ([]byte, error) {
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 2048)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if n < 8 || binary.BigEndian.Uint32(buf[4:8]) != tid {
+			continue // stray or late packet
+		}
+		switch binary.BigEndian.Uint32(buf[0:4]) {
+		case action:
+			if n < minLen {
+				return nil, fmt.Errorf("short response (%d bytes)", n)
+			}
+			return buf[:n], nil
+		case udpActionError:
+			return nil, fmt.Errorf("tracker error: %s", buf[8:n])
+		default:
+			return nil, errors.New("unexpected action in response")
+		}
+	}
+}
+
+// transactionID returns a random 32-bit transaction ID.
+func transactionID() uint32 {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return binary.BigEndian.Uint32(b[:])
+}
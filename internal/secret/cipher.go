@@ -0,0 +1,72 @@
+// Package secret encrypts settings that hold credentials, such as addon and
+// proxy URLs, before they are written to DATA_DIR.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Prefix marks a value that is encrypted at rest.
+const Prefix = "enc:v1:"
+
+// IsEncrypted reports whether value was produced by Cipher.Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Cipher encrypts values at rest with AES-256-GCM.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// New derives an AES-256 key from secret (ADDON_SECRET_KEY). Returns nil if
+// secret is empty (encryption at rest disabled).
+func New(secret string) (*Cipher, error) {
+	if secret == "" {
+		return nil, nil
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create GCM: %w", err)
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt returns plaintext sealed and encoded with Prefix.
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return Prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt.
+func (c *Cipher) Decrypt(value string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, Prefix))
+	if err != nil {
+		return "", fmt.Errorf("decode: %w", err)
+	}
+	n := c.aead.NonceSize()
+	if len(data) < n {
+		return "", errors.New("ciphertext too short")
+	}
+	plaintext, err := c.aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return "", errors.New("decryption failed (wrong ADDON_SECRET_KEY?)")
+	}
+	return string(plaintext), nil
+}
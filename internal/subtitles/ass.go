@@ -0,0 +1,99 @@
+package subtitles
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// assOverride matches an ASS override block such as {\i1} or {\pos(10,20)}.
+var assOverride = regexp.MustCompile(`\{[^}]*\}`)
+
+// assDrawing matches the override that switches a line to vector drawing
+// mode; such lines are shapes, not text.
+var assDrawing = regexp.MustCompile(`\\p[1-9]`)
+
+// defaultASSFormat is the [Events] field order of ASS v4+ files, used when
+// the file has no Format line.
+var defaultASSFormat = []string{"layer", "start", "end", "style", "name", "marginl", "marginr", "marginv", "effect", "text"}
+
+// ParseASS parses the [Events] section of an ASS or SSA script. Styling is
+// dropped; cues are returned in start time order.
+func ParseASS(text string) []Cue {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var cues []Cue
+	inEvents := false
+	format := defaultASSFormat
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inEvents = strings.EqualFold(line, "[Events]")
+			continue
+		}
+		if !inEvents {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "format":
+			fields := strings.Split(value, ",")
+			format = make([]string, len(fields))
+			for i, f := range fields {
+				format[i] = strings.ToLower(strings.TrimSpace(f))
+			}
+		case "dialogue":
+			if cue, ok := parseDialogue(value, format); ok {
+				cues = append(cues, cue)
+			}
+		}
+	}
+
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].Start < cues[j].Start })
+	return cues
+}
+
+// parseDialogue parses the value of a Dialogue line. The text field is last
+// and may itself contain commas.
+func parseDialogue(value string, format []string) (Cue, bool) {
+	fields := strings.SplitN(value, ",", len(format))
+	if len(fields) != len(format) {
+		return Cue{}, false
+	}
+
+	var cue Cue
+	var startOK, endOK, textOK bool
+	for i, name := range format {
+		field := strings.TrimSpace(fields[i])
+		switch name {
+		case "start":
+			d, err := parseTimestamp(field)
+			cue.Start, startOK = d, err == nil
+		case "end":
+			d, err := parseTimestamp(field)
+			cue.End, endOK = d, err == nil
+		case "text":
+			cue.Text, textOK = CleanASSText(fields[i])
+		}
+	}
+	return cue, startOK && endOK && textOK
+}
+
+// CleanASSText turns the text field of an ASS event into plain text: override
+// blocks are removed and ASS line breaks and hard spaces converted. It
+// returns false for drawings and events without visible text.
+func CleanASSText(text string) (string, bool) {
+	for _, block := range assOverride.FindAllString(text, -1) {
+		if assDrawing.MatchString(block) {
+			return "", false
+		}
+	}
+	text = assOverride.ReplaceAllString(text, "")
+	text = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(text)
+	text = strings.TrimSpace(text)
+	return text, text != ""
+}
@@ -0,0 +1,54 @@
+package subtitles
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseASS(t *testing.T) {
+	const header = "[Script Info]\nTitle: Test\n\n[V4+ Styles]\nFormat: Name, Fontname\nStyle: Default,Arial\n\n[Events]\n"
+
+	tests := []struct {
+		name string
+		in   string
+		want []Cue
+	}{
+		{
+			name: "default format, sorted by start",
+			in: header +
+				"Dialogue: 0,0:00:05.00,0:00:06.00,Default,,0,0,0,,Second\n" +
+				"Dialogue: 0,0:00:01.50,0:00:02.00,Default,,0,0,0,,{\\i1}First{\\i0}, with comma\n",
+			want: []Cue{
+				{Start: ts(0, 0, 1, 500), End: ts(0, 0, 2, 0), Text: "First, with comma"},
+				{Start: ts(0, 0, 5, 0), End: ts(0, 0, 6, 0), Text: "Second"},
+			},
+		},
+		{
+			name: "custom format and line breaks",
+			in: "[Events]\r\nFormat: Start, End, Text\r\n" +
+				"Dialogue: 1:00:00.00,1:00:01.00,Line one\\Nline\\htwo\r\n",
+			want: []Cue{{Start: ts(1, 0, 0, 0), End: ts(1, 0, 1, 0), Text: "Line one\nline two"}},
+		},
+		{
+			name: "drawings and empty text are dropped",
+			in: header +
+				"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\\p1}m 0 0 l 10 10{\\p0}\n" +
+				"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\\b1}\n",
+		},
+		{
+			name: "dialogue outside events",
+			in:   "[Script Info]\nDialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Nope\n",
+		},
+		{
+			name: "bad timestamp",
+			in:   header + "Dialogue: 0,soon,0:00:02.00,Default,,0,0,0,,Nope\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseASS(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
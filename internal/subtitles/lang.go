@@ -0,0 +1,169 @@
+package subtitles
+
+import (
+	"path"
+	"strings"
+	"unicode"
+)
+
+// Unknown is the language code reported when a file name names no language.
+const Unknown = "und"
+
+// languages maps ISO 639-2/B codes (what Stremio and OpenSubtitles use) to
+// the tokens that identify them in file names: ISO 639-1 and 639-2/T codes
+// and the English and native names.
+var languages = map[string][]string{
+	"eng": {"en", "english"},
+	"spa": {"es", "spanish", "espanol", "español", "castellano", "latino"},
+	"por": {"pt", "portuguese", "portugues", "português"},
+	"pob": {"ptbr", "brazilian", "brasil"},
+	"fre": {"fr", "fra", "french", "francais", "français"},
+	"ger": {"de", "deu", "german", "deutsch"},
+	"ita": {"it", "italian", "italiano"},
+	"dut": {"nl", "nld", "dutch", "nederlands"},
+	"rus": {"ru", "russian", "русский"},
+	"ukr": {"uk", "ukrainian"},
+	"pol": {"pl", "polish", "polski"},
+	"cze": {"cs", "ces", "czech", "cesky"},
+	"slo": {"sk", "slk", "slovak"},
+	"hun": {"hu", "hungarian", "magyar"},
+	"rum": {"ro", "ron", "romanian"},
+	"bul": {"bg", "bulgarian"},
+	"hrv": {"hr", "croatian", "hrvatski"},
+	"srp": {"sr", "serbian"},
+	"slv": {"sl", "slovenian"},
+	"gre": {"el", "ell", "greek"},
+	"tur": {"tr", "turkish", "turkce"},
+	"swe": {"sv", "swedish", "svenska"},
+	"nor": {"no", "nb", "nob", "norwegian", "norsk"},
+	"dan": {"da", "danish", "dansk"},
+	"fin": {"fi", "finnish", "suomi"},
+	"est": {"et", "estonian"},
+	"lav": {"lv", "latvian"},
+	"lit": {"lt", "lithuanian"},
+	"heb": {"he", "iw", "hebrew"},
+	"ara": {"ar", "arabic"},
+	"per": {"fa", "fas", "persian", "farsi"},
+	"hin": {"hi", "hindi"},
+	"tha": {"th", "thai"},
+	"vie": {"vi", "vietnamese"},
+	"ind": {"id", "indonesian"},
+	"may": {"ms", "msa", "malay"},
+	"chi": {"zh", "zho", "chinese", "chs", "cht", "mandarin"},
+	"jpn": {"ja", "japanese"},
+	"kor": {"ko", "korean"},
+}
+
+// wordCodes are codes that are also common words in titles ("Things We Do
+// for Love May Fail", "Per Aspera"). They are only recognized as container
+// language tags, not in file names.
+var wordCodes = map[string]bool{"may": true, "per": true}
+
+// languageTokens is the reverse of languages, without wordCodes.
+var languageTokens = func() map[string]string {
+	m := make(map[string]string)
+	for code, tokens := range languages {
+		if !wordCodes[code] {
+			m[code] = code
+		}
+		for _, t := range tokens {
+			m[t] = code
+		}
+	}
+	return m
+}()
+
+// DetectLanguage guesses the language of a subtitle file from its path, e.g.
+// "Movie.2020.en.srt", "Movie.2020.Spanish.srt" or "Subs/3_English.srt". It
+// returns an ISO 639-2/B code, or Unknown.
+//
+// videoStem is the name of the video the subtitle belongs to, without its
+// extension ("" if unknown). When the file name starts with it only the rest
+// is looked at, so titles such as "It.2017" or "Dr.No.1962" aren't taken
+// for a language. Codes of two or three letters only count as the last word
+// of the file name, where release tools put them; elsewhere they are too
+// easily part of a title. Language names count anywhere in the name or its
+// directories.
+func DetectLanguage(filePath, videoStem string) string {
+	filePath = strings.ReplaceAll(filePath, "\\", "/")
+	base := strings.ToLower(strings.TrimSuffix(path.Base(filePath), path.Ext(filePath)))
+	if videoStem = strings.ToLower(videoStem); videoStem != "" && strings.HasPrefix(base, videoStem) {
+		base = base[len(videoStem):]
+	}
+
+	words := splitWords(base)
+	// Skip trailing markers that follow the language ("Movie.en.forced").
+	// "hi" means hearing impaired after a language or another marker
+	// ("Movie.en.hi", "Movie.en.sdh.hi") but Hindi on its own ("Movie.hi").
+	for n := len(words); n > 1; n = len(words) {
+		last, prev := words[n-1], words[n-2]
+		_, afterLanguage := languageTokens[prev]
+		if !isMarker(last) && !(last == "hi" && (afterLanguage || isMarker(prev))) {
+			break
+		}
+		words = words[:n-1]
+	}
+	if n := len(words); n > 0 {
+		if n > 1 && words[n-2] == "pt" && words[n-1] == "br" {
+			return "pob"
+		}
+		if code, ok := languageTokens[words[n-1]]; ok {
+			return code
+		}
+	}
+
+	// Language names, in the file name first and then its directories.
+	dirs := strings.Split(path.Dir(filePath), "/")
+	candidates := words
+	for i := len(dirs) - 1; i >= 0; i-- {
+		candidates = append(candidates, splitWords(dirs[i])...)
+	}
+	for _, w := range candidates {
+		if len(w) <= 3 {
+			continue
+		}
+		if code, ok := languageTokens[w]; ok {
+			return code
+		}
+	}
+	return Unknown
+}
+
+// LanguageCode normalizes a language tag from container metadata, an ISO
+// 639-2 code ("ger", "deu") or a BCP 47 tag ("de", "pt-BR"), to the ISO
+// 639-2/B code DetectLanguage returns. Unrecognized tags become Unknown.
+func LanguageCode(tag string) string {
+	parts := strings.FieldsFunc(strings.ToLower(tag), func(r rune) bool {
+		return r == '-' || r == '_'
+	})
+	if len(parts) == 0 {
+		return Unknown
+	}
+	if parts[0] == "pt" && len(parts) > 1 && parts[1] == "br" {
+		return "pob"
+	}
+	if _, ok := languages[parts[0]]; ok {
+		return parts[0]
+	}
+	if code, ok := languageTokens[parts[0]]; ok {
+		return code
+	}
+	return Unknown
+}
+
+// splitWords lowercases s and splits it on anything that isn't a letter.
+func splitWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+}
+
+// isMarker reports whether w is a subtitle variant marker rather than part
+// of the name.
+func isMarker(w string) bool {
+	switch w {
+	case "forced", "sdh", "cc", "full", "default", "srt", "ass":
+		return true
+	}
+	return false
+}
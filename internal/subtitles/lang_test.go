@@ -0,0 +1,54 @@
+package subtitles
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		path, stem, want string
+	}{
+		{"Movie.2020.en.srt", "", "eng"},
+		{"Movie.2020.Spanish.srt", "", "spa"},
+		{"Subs/3_English.srt", "", "eng"},
+		{"Subs/French/1.srt", "", "fre"},
+		{"Movie.2020.pt-BR.srt", "", "pob"},
+		{"Movie.2020.en.forced.srt", "", "eng"},
+		{"Movie.2020.en.sdh.hi.srt", "", "eng"},
+		{"Movie.2020.hi.srt", "", "hin"},
+		{"Movie.2020.srt", "", Unknown},
+
+		// Titles that end in a language code.
+		{"It.2017.1080p.srt", "it.2017.1080p", Unknown},
+		{"It.2017.1080p.ita.srt", "it.2017.1080p", "ita"},
+		{"Dr.No.1962.srt", "dr.no.1962", Unknown},
+		{"Subs/Dr.No.1962/2_Norwegian.srt", "dr.no.1962", "nor"},
+		{"Show.S01E02.srt", "show.s01e02", Unknown},
+
+		// Codes that are also common words.
+		{"Things.May.srt", "", Unknown},
+		{"Per.srt", "", Unknown},
+		{"Movie.malay.srt", "", "may"},
+	}
+	for _, tt := range tests {
+		if got := DetectLanguage(tt.path, tt.stem); got != tt.want {
+			t.Errorf("DetectLanguage(%q, %q) = %q, want %q", tt.path, tt.stem, got, tt.want)
+		}
+	}
+}
+
+func TestLanguageCode(t *testing.T) {
+	tests := map[string]string{
+		"ger":   "ger",
+		"deu":   "ger",
+		"de":    "ger",
+		"pt-BR": "pob",
+		"per":   "per",
+		"may":   "may",
+		"":      Unknown,
+		"xx":    Unknown,
+	}
+	for tag, want := range tests {
+		if got := LanguageCode(tag); got != want {
+			t.Errorf("LanguageCode(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package subtitles
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// srtTiming matches an SRT timing line; trailing position coordinates are
+// ignored.
+var srtTiming = regexp.MustCompile(`^\s*(\d+:\d+:\d+[,.]\d+)\s*-->\s*(\d+:\d+:\d+[,.]\d+)`)
+
+// srtUnsupportedTags matches markup WebVTT doesn't know: <font> tags and
+// ASS-style override blocks like {\an8} that some SRT files carry.
+var srtUnsupportedTags = regexp.MustCompile(`(?i)</?font[^>]*>|\{\\[^}]*\}`)
+
+// ParseSRT parses SubRip text. Malformed blocks are skipped.
+func ParseSRT(text string) []Cue {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	var cues []Cue
+	var cur *Cue
+	var lines []string
+	flush := func() {
+		if cur != nil {
+			cur.Text = CleanSRTText(strings.Join(lines, "\n"))
+			cues = append(cues, *cur)
+		}
+		cur, lines = nil, nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if m := srtTiming.FindStringSubmatch(line); m != nil {
+			// A timing line starts a new cue even without the blank line
+			// some broken files omit. The index line before it, if any,
+			// was collected as text of the previous cue; drop it.
+			if cur != nil && len(lines) > 0 && isIndexLine(lines[len(lines)-1]) {
+				lines = lines[:len(lines)-1]
+			}
+			flush()
+			start, err1 := parseTimestamp(m[1])
+			end, err2 := parseTimestamp(m[2])
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			cur = &Cue{Start: start, End: end}
+			continue
+		}
+		if cur == nil {
+			continue // index line or junk before the first timing
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	return cues
+}
+
+// CleanSRTText removes the markup of SubRip text that WebVTT doesn't
+// support, keeping <i>, <b> and <u>.
+func CleanSRTText(text string) string {
+	return srtUnsupportedTags.ReplaceAllString(text, "")
+}
+
+func isIndexLine(line string) bool {
+	_, err := strconv.Atoi(strings.TrimSpace(line))
+	return err == nil
+}
+
+// parseTimestamp parses "H:MM:SS,mmm" (or with a '.') into a duration. The
+// fraction may have any number of digits.
+func parseTimestamp(s string) (time.Duration, error) {
+	s = strings.Replace(strings.TrimSpace(s), ",", ".", 1)
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, strconv.ErrSyntax
+	}
+	h, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, err
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, err
+	}
+	sec, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec*float64(time.Second)+0.5), nil
+}
@@ -0,0 +1,59 @@
+package subtitles
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// ts builds a duration from hours, minutes, seconds and milliseconds.
+func ts(h, m, s, ms int) time.Duration {
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(s)*time.Second + time.Duration(ms)*time.Millisecond
+}
+
+func TestParseSRT(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []Cue
+	}{
+		{
+			name: "two cues",
+			in:   "1\n00:00:01,000 --> 00:00:02,500\nHello\n\n2\n00:00:03,000 --> 00:00:04,000\nTwo\nlines\n",
+			want: []Cue{
+				{Start: ts(0, 0, 1, 0), End: ts(0, 0, 2, 500), Text: "Hello"},
+				{Start: ts(0, 0, 3, 0), End: ts(0, 0, 4, 0), Text: "Two\nlines"},
+			},
+		},
+		{
+			name: "CRLF, dot separator and position",
+			in:   "1\r\n01:02:03.4 --> 01:02:05.04 X1:10 X2:20\r\n<font color=\"red\">{\\an8}<i>Hi</i></font>\r\n",
+			want: []Cue{{Start: ts(1, 2, 3, 400), End: ts(1, 2, 5, 40), Text: "<i>Hi</i>"}},
+		},
+		{
+			name: "missing blank line between cues",
+			in:   "1\n00:00:01,000 --> 00:00:02,000\nOne\n2\n00:00:03,000 --> 00:00:04,000\nTwo\n",
+			want: []Cue{
+				{Start: ts(0, 0, 1, 0), End: ts(0, 0, 2, 0), Text: "One"},
+				{Start: ts(0, 0, 3, 0), End: ts(0, 0, 4, 0), Text: "Two"},
+			},
+		},
+		{
+			name: "junk before the first cue",
+			in:   "garbage\n\n1\n00:00:01,000 --> 00:00:02,000\nOk\n",
+			want: []Cue{{Start: ts(0, 0, 1, 0), End: ts(0, 0, 2, 0), Text: "Ok"}},
+		},
+		{
+			name: "no cues",
+			in:   "not a subtitle file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseSRT(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
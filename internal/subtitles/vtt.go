@@ -0,0 +1,130 @@
+// Package subtitles converts text subtitles (SRT, ASS/SSA, WebVTT) to WebVTT,
+// the only format Stremio Web can display, and guesses their language from
+// file names.
+package subtitles
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// Cue is one subtitle event.
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string // plain text, lines separated by "\n"
+}
+
+// Extensions are the subtitle file extensions the bridge can convert.
+var Extensions = []string{".srt", ".ass", ".ssa", ".vtt"}
+
+// IsSubtitleFile reports whether name has a convertible subtitle extension.
+func IsSubtitleFile(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, e := range Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// ToVTT converts a subtitle file to WebVTT, choosing the parser by the
+// extension of name. WebVTT input is passed through with its text decoded to
+// UTF-8.
+func ToVTT(name string, data []byte) ([]byte, error) {
+	text := decodeText(data)
+
+	var cues []Cue
+	switch strings.ToLower(path.Ext(name)) {
+	case ".srt":
+		cues = ParseSRT(text)
+	case ".ass", ".ssa":
+		cues = ParseASS(text)
+	case ".vtt":
+		if !strings.HasPrefix(text, "WEBVTT") {
+			return nil, fmt.Errorf("missing WEBVTT header")
+		}
+		return []byte(text), nil
+	default:
+		return nil, fmt.Errorf("unsupported subtitle format %q", path.Ext(name))
+	}
+
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("no cues found")
+	}
+	return WriteVTT(cues), nil
+}
+
+// WriteVTT renders cues as a WebVTT document.
+func WriteVTT(cues []Cue) []byte {
+	var b bytes.Buffer
+	b.WriteString("WEBVTT\n\n")
+	for _, c := range cues {
+		text := strings.TrimSpace(c.Text)
+		if text == "" {
+			continue
+		}
+		// A blank line would end the cue early, and "-->" would start a
+		// new one.
+		text = escapeCueText(strings.ReplaceAll(text, "-->", "->"))
+		for strings.Contains(text, "\n\n") {
+			text = strings.ReplaceAll(text, "\n\n", "\n")
+		}
+		fmt.Fprintf(&b, "%s --> %s\n%s\n\n", formatTimestamp(c.Start), formatTimestamp(c.End), text)
+	}
+	return b.Bytes()
+}
+
+// cueTags are the WebVTT tags cue text from ParseSRT, ParseASS and Matroska
+// tracks may carry. Any other "<" and every "&" is escaped.
+var cueTags = []string{"<i>", "</i>", "<b>", "</b>", "<u>", "</u>"}
+
+// escapeCueText escapes "&", "<" and ">" in cue text so they show literally,
+// keeping the formatting tags in cueTags.
+func escapeCueText(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		if text[i] == '<' {
+			if tag := matchCueTag(text[i:]); tag != "" {
+				b.WriteString(tag)
+				i += len(tag)
+				continue
+			}
+		}
+		switch text[i] {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		default:
+			b.WriteByte(text[i])
+		}
+		i++
+	}
+	return b.String()
+}
+
+// matchCueTag returns the tag of cueTags s starts with, lowercased, or "".
+func matchCueTag(s string) string {
+	for _, tag := range cueTags {
+		if len(s) >= len(tag) && strings.EqualFold(s[:len(tag)], tag) {
+			return tag
+		}
+	}
+	return ""
+}
+
+// formatTimestamp formats d as a WebVTT timestamp (HH:MM:SS.mmm).
+func formatTimestamp(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,17 @@
+package subtitles
+
+import "testing"
+
+func TestWriteVTT(t *testing.T) {
+	cues := []Cue{
+		{Start: ts(0, 0, 1, 0), End: ts(0, 0, 2, 500), Text: "<i>Tom & Jerry</i> <3"},
+		{Start: ts(1, 2, 3, 4), End: ts(1, 2, 4, 0), Text: "a --> b\n\n\nc"},
+		{Start: ts(0, 0, 5, 0), End: ts(0, 0, 6, 0), Text: "   "},
+	}
+	want := "WEBVTT\n\n" +
+		"00:00:01.000 --> 00:00:02.500\n<i>Tom &amp; Jerry</i> &lt;3\n\n" +
+		"01:02:03.004 --> 01:02:04.000\na -&gt; b\nc\n\n"
+	if got := string(WriteVTT(cues)); got != want {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
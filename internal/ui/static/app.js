@@ -295,6 +295,41 @@ async function loadConfig() {
     }
 }
 
+// Restore a backup archive selected in the file input
+async function restoreBackup(input) {
+    const statusEl = document.getElementById('backup-status');
+    const file = input.files && input.files[0];
+    input.value = '';
+    if (!file) return;
+
+    if (!confirm('Restoring replaces all addons and settings. Continue?')) {
+        return;
+    }
+
+    try {
+        const response = await fetch('/api/restore', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: await file.text(),
+        });
+
+        const result = await response.json().catch(() => ({}));
+        if (!response.ok) {
+            throw new Error(result.error || `HTTP ${response.status}`);
+        }
+
+        showStatus(statusEl, `Restored ${result.addons} addons`, false);
+        lastHealthData = null;
+        loadConfig();
+        loadAddons();
+    } catch (error) {
+        console.error('Failed to restore backup:', error);
+        showStatus(statusEl, `Restore failed: ${error.message}`, true);
+    }
+}
+
 // Save configuration
 async function saveConfig() {
     const saveBtn = document.getElementById('save-config-btn');
@@ -427,7 +462,7 @@ async function loadAddons() {
         }
 
         // Render addon list
-        listEl.innerHTML = addons.map(addon => {
+        listEl.innerHTML = addons.map((addon, index) => {
             const displayName = addon.name || extractAddonLabel(addon.originalUrl);
             const originalUrl = addon.originalUrl || '';
             const truncatedURL = originalUrl.length > 60
@@ -444,6 +479,13 @@ async function loadAddons() {
             const statusLabel = addon.fetchStatus === 'ok' ? 'OK'
                 : addon.fetchStatus === 'blocked' ? 'Blocked'
                 : '?';
+            let statusTitle = 'Fetch status: ' + statusLabel;
+            if (addon.fetchStatus === 'ok' && addon.lastSuccessMethod) {
+                statusTitle += ' via ' + (fetchMethodLabels[addon.lastSuccessMethod] || addon.lastSuccessMethod);
+            }
+            if (addon.fetchStatusAt) {
+                statusTitle += ' (since ' + timeAgo(addon.fetchStatusAt) + ')';
+            }
 
             // Build fetch method options
             const currentMethod = addon.fetchMethod || 'global';
@@ -453,16 +495,21 @@ async function loadAddons() {
             }).join('');
 
             return `
-                <div class="addon-item">
+                <div class="addon-item${addon.enabled === false ? ' disabled' : ''}">
                     <div class="addon-header">
                         <div class="addon-header-left">
-                            <span class="fetch-status ${statusClass}" title="Fetch status: ${statusLabel}">${statusLabel}</span>
+                            <span class="fetch-status ${statusClass}" title="${escapeHtml(statusTitle)}">${statusLabel}</span>
                             <div>
-                                <div class="addon-name">${escapeHtml(displayName)}</div>
-                                <div class="addon-url" title="${escapeHtml(originalUrl)}">${escapeHtml(truncatedURL)}</div>
+                                <div class="addon-name">${escapeHtml(displayName)}${addon.autoWrapped ? ' <span class="addon-auto" title="Registered automatically by an /auto/ URL">auto</span>' : ''}</div>
+                                <div class="addon-url" title="${escapeHtml(originalUrl)}${addon.secretsMasked ? ' (API keys hidden)' : ''}">${escapeHtml(truncatedURL)}</div>
                             </div>
                         </div>
                         <div class="addon-actions">
+                            <button class="small" title="Move up" onclick="moveAddon('${escapeHtml(addon.id)}', -1)" ${index === 0 ? 'disabled' : ''}>&uarr;</button>
+                            <button class="small" title="Move down" onclick="moveAddon('${escapeHtml(addon.id)}', 1)" ${index === addons.length - 1 ? 'disabled' : ''}>&darr;</button>
+                            <label class="addon-enabled" title="Disabled addons stay installed in Stremio but return no results">
+                                <input type="checkbox" ${addon.enabled === false ? '' : 'checked'} onchange="setAddonEnabled('${escapeHtml(addon.id)}', this.checked)"> Enabled
+                            </label>
                             <select class="addon-fetch-select" onchange="updateAddonFetchMethod('${escapeHtml(addon.id)}', this.value)">
                                 ${methodOptions}
                             </select>
@@ -536,11 +583,20 @@ async function addAddon() {
 
         if (!response.ok) {
             const errorData = await response.json().catch(() => ({}));
-            throw new Error(errorData.error || `HTTP ${response.status}`);
+            let message = errorData.error || `HTTP ${response.status}`;
+            if (errorData.problems && errorData.problems.length > 0) {
+                message += ': ' + errorData.problems.join('; ');
+            }
+            throw new Error(message);
         }
 
+        const added = await response.json().catch(() => ({}));
+
         // Success - clear input and reload
         urlInput.value = '';
+        if (added.warnings && added.warnings.length > 0) {
+            showError(errorEl, `Added ${added.name || 'addon'} with warnings: ${added.warnings.join('; ')}`);
+        }
         lastHealthData = null; // New addon needs fresh health check
         loadAddons();
     } catch (error) {
@@ -576,6 +632,58 @@ async function removeAddon(id) {
     }
 }
 
+// Enable or disable an addon
+async function setAddonEnabled(id, enabled) {
+    try {
+        const response = await fetch(`/api/addons/${id}`, {
+            method: 'PATCH',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ enabled }),
+        });
+
+        if (!response.ok) {
+            const errorData = await response.json().catch(() => ({}));
+            throw new Error(errorData.error || `HTTP ${response.status}`);
+        }
+    } catch (error) {
+        console.error('Failed to update addon:', error);
+        alert(`Failed to update: ${error.message}`);
+    }
+    loadAddons();
+}
+
+// Move an addon up (-1) or down (+1) in the list order
+async function moveAddon(id, delta) {
+    if (!currentAddonsList) return;
+    const ids = currentAddonsList.map(a => a.id);
+    const from = ids.indexOf(id);
+    const to = from + delta;
+    if (from < 0 || to < 0 || to >= ids.length) return;
+    ids.splice(from, 1);
+    ids.splice(to, 0, id);
+
+    try {
+        const response = await fetch('/api/addons/order', {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ ids }),
+        });
+
+        if (!response.ok) {
+            const errorData = await response.json().catch(() => ({}));
+            throw new Error(errorData.error || `HTTP ${response.status}`);
+        }
+    } catch (error) {
+        console.error('Failed to reorder addons:', error);
+        alert(`Failed to reorder: ${error.message}`);
+    }
+    loadAddons();
+}
+
 // Update per-addon fetch method
 async function updateAddonFetchMethod(id, method) {
     try {
@@ -760,6 +868,10 @@ function buildValidationHTML(method, health, config) {
             break;
     }
 
+    if (health && health.manifestCachedAt) {
+        items.push({ type: 'info', text: 'Cached manifest: fetched ' + timeAgo(health.manifestCachedAt) });
+    }
+
     if (items.length === 0) return '';
 
     return '<div class="validation-items">' +
@@ -0,0 +1,37 @@
+// Package videohash computes OpenSubtitles "moviehash" values for files
+// inside torrents, so subtitle addons can match bridged streams by content
+// rather than by name.
+package videohash
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ChunkSize is how much of each end of the file the hash covers.
+const ChunkSize = 64 * 1024
+
+// ErrTooSmall is returned for files smaller than one chunk, which the
+// OpenSubtitles algorithm doesn't define a hash for.
+var ErrTooSmall = errors.New("file smaller than hash chunk")
+
+// Sum returns the OpenSubtitles hash of a file as 16 lowercase hex digits:
+// the file size plus the little-endian uint64 words of its first and last
+// ChunkSize bytes, summed with overflow.
+func Sum(size int64, head, tail []byte) (string, error) {
+	if size < ChunkSize {
+		return "", ErrTooSmall
+	}
+	if len(head) != ChunkSize || len(tail) != ChunkSize {
+		return "", fmt.Errorf("need %d bytes from each end, got %d and %d", ChunkSize, len(head), len(tail))
+	}
+
+	sum := uint64(size)
+	for _, chunk := range [][]byte{head, tail} {
+		for i := 0; i < ChunkSize; i += 8 {
+			sum += binary.LittleEndian.Uint64(chunk[i:])
+		}
+	}
+	return fmt.Sprintf("%016x", sum), nil
+}
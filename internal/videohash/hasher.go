@@ -0,0 +1,302 @@
+package videohash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krizcold/stremio-torrent-bridge/internal/engine"
+)
+
+const (
+	// maxEntries bounds the persisted hash cache; the oldest hashes are
+	// dropped first.
+	maxEntries = 5000
+	// computeTimeout bounds reading both ends of a file. The pieces may still
+	// have to come from the swarm, so it is generous.
+	computeTimeout = 3 * time.Minute
+	// failureBackoff is how long a file whose hash couldn't be computed is
+	// left alone before trying again.
+	failureBackoff = 10 * time.Minute
+	// maxConcurrent bounds simultaneous hash computations so they never
+	// compete with playback for more than a couple of engine connections.
+	maxConcurrent = 2
+)
+
+// Entry is the cached hash of one file in a torrent.
+type Entry struct {
+	InfoHash   string    `json:"infoHash"`
+	FileIdx    int       `json:"fileIdx"`
+	Size       int64     `json:"size"`
+	Hash       string    `json:"hash"`
+	ComputedAt time.Time `json:"computedAt"`
+}
+
+// Hasher computes video hashes in the background by reading the first and
+// last chunk of a file through the engine, and caches them per infoHash and
+// file index. The cache is persisted to DATA_DIR/video_hashes.json. It is
+// safe for concurrent use.
+type Hasher struct {
+	engine   engine.Engine
+	filePath string
+	sem      chan struct{}
+
+	mu       sync.RWMutex
+	entries  map[string]*Entry    // "infoHash/fileIdx" -> hash
+	inFlight map[string]bool      // keys being computed
+	failed   map[string]time.Time // keys -> skip until
+	saveMu   sync.Mutex           // serializes background saves
+}
+
+// NewHasher creates a Hasher reading files through eng and loads any hashes
+// previously saved under dataDir.
+func NewHasher(eng engine.Engine, dataDir string) *Hasher {
+	h := &Hasher{
+		engine:   eng,
+		filePath: dataDir + "/video_hashes.json",
+		sem:      make(chan struct{}, maxConcurrent),
+		entries:  make(map[string]*Entry),
+		inFlight: make(map[string]bool),
+		failed:   make(map[string]time.Time),
+	}
+
+	if err := h.load(); err != nil {
+		fmt.Printf("Video hash: failed to load cache: %v (starting fresh)\n", err)
+	}
+
+	return h
+}
+
+func key(infoHash string, fileIdx int) string {
+	return strings.ToLower(infoHash) + "/" + strconv.Itoa(fileIdx)
+}
+
+// Get returns the cached hash of a file, if it has been computed.
+func (h *Hasher) Get(infoHash string, fileIdx int) (string, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if e, ok := h.entries[key(infoHash, fileIdx)]; ok {
+		return e.Hash, true
+	}
+	return "", false
+}
+
+// Find returns the file a video hash was computed for, for callers that
+// only know the hash (such as subtitle requests from Stremio).
+func (h *Hasher) Find(videoHash string) (infoHash string, fileIdx int, ok bool) {
+	videoHash = strings.ToLower(videoHash)
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, e := range h.entries {
+		if e.Hash == videoHash {
+			return e.InfoHash, e.FileIdx, true
+		}
+	}
+	return "", 0, false
+}
+
+// Request schedules the hash of a file to be computed in the background,
+// unless it is cached, already being computed, or recently failed. size is
+// the file size in bytes; 0 looks it up in the engine. Call it only once
+// the file's first and last pieces are available (or being fetched for
+// playback anyway), since reading them otherwise makes the engine download
+// them.
+func (h *Hasher) Request(infoHash string, fileIdx int, size int64) {
+	infoHash = strings.ToLower(infoHash)
+	k := key(infoHash, fileIdx)
+
+	h.mu.Lock()
+	if _, done := h.entries[k]; done || h.inFlight[k] {
+		h.mu.Unlock()
+		return
+	}
+	if until, ok := h.failed[k]; ok && time.Now().Before(until) {
+		h.mu.Unlock()
+		return
+	}
+	h.inFlight[k] = true
+	h.mu.Unlock()
+
+	go func() {
+		h.sem <- struct{}{}
+		defer func() { <-h.sem }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), computeTimeout)
+		defer cancel()
+
+		entry, err := h.compute(ctx, infoHash, fileIdx, size)
+
+		h.mu.Lock()
+		delete(h.inFlight, k)
+		if err != nil {
+			h.failed[k] = time.Now().Add(failureBackoff)
+			h.mu.Unlock()
+			fmt.Printf("Video hash: %s file %d: %v\n", infoHash, fileIdx, err)
+			return
+		}
+		delete(h.failed, k)
+		h.entries[k] = entry
+		h.pruneLocked()
+		h.mu.Unlock()
+
+		if err := h.save(); err != nil {
+			fmt.Printf("Video hash: failed to save cache: %v\n", err)
+		}
+	}()
+}
+
+// compute reads both ends of the file and hashes them.
+func (h *Hasher) compute(ctx context.Context, infoHash string, fileIdx int, size int64) (*Entry, error) {
+	if size <= 0 {
+		file, err := engine.FindFile(ctx, h.engine, infoHash, fileIdx)
+		if err != nil {
+			return nil, fmt.Errorf("look up file size: %w", err)
+		}
+		size = file.Size
+		if size <= 0 {
+			return nil, fmt.Errorf("file size unknown")
+		}
+	}
+	if size < ChunkSize {
+		return nil, ErrTooSmall
+	}
+
+	head, err := h.readRange(ctx, infoHash, fileIdx, 0)
+	if err != nil {
+		return nil, fmt.Errorf("read head: %w", err)
+	}
+	tail, err := h.readRange(ctx, infoHash, fileIdx, size-ChunkSize)
+	if err != nil {
+		return nil, fmt.Errorf("read tail: %w", err)
+	}
+
+	sum, err := Sum(size, head, tail)
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{
+		InfoHash:   infoHash,
+		FileIdx:    fileIdx,
+		Size:       size,
+		Hash:       sum,
+		ComputedAt: time.Now(),
+	}, nil
+}
+
+// readRange reads ChunkSize bytes of a file starting at offset, using a
+// Range request through the engine.
+func (h *Hasher) readRange(ctx context.Context, infoHash string, fileIdx int, offset int64) ([]byte, error) {
+	reqURL := fmt.Sprintf("http://localhost/stream/%s/%d", infoHash, fileIdx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+ChunkSize-1))
+
+	resp, err := h.engine.StreamFile(ctx, infoHash, fileIdx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// An engine that ignores Range answers 200 with the whole file, which is
+	// only usable when reading from the start.
+	if resp.StatusCode != http.StatusPartialContent && !(resp.StatusCode == http.StatusOK && offset == 0) {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	buf := make([]byte, ChunkSize)
+	if _, err := io.ReadFull(resp.Body, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// pruneLocked drops the oldest entries above maxEntries and expired
+// failures. Caller must hold the write lock.
+func (h *Hasher) pruneLocked() {
+	now := time.Now()
+	for k, until := range h.failed {
+		if now.After(until) {
+			delete(h.failed, k)
+		}
+	}
+
+	excess := len(h.entries) - maxEntries
+	if excess <= 0 {
+		return
+	}
+	oldest := make([]string, 0, len(h.entries))
+	for k := range h.entries {
+		oldest = append(oldest, k)
+	}
+	sort.Slice(oldest, func(i, j int) bool {
+		return h.entries[oldest[i]].ComputedAt.Before(h.entries[oldest[j]].ComputedAt)
+	})
+	for _, k := range oldest[:excess] {
+		delete(h.entries, k)
+	}
+}
+
+// load reads the persisted hashes from disk. Returns nil if the file does
+// not exist (a fresh start is fine).
+func (h *Hasher) load() error {
+	data, err := os.ReadFile(h.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read %s: %w", h.filePath, err)
+	}
+
+	var entries []*Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("parse %s: %w", h.filePath, err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range entries {
+		if e != nil && e.InfoHash != "" && e.Hash != "" {
+			h.entries[key(e.InfoHash, e.FileIdx)] = e
+		}
+	}
+
+	return nil
+}
+
+// save writes the cache to disk, replacing the file atomically.
+func (h *Hasher) save() error {
+	h.saveMu.Lock()
+	defer h.saveMu.Unlock()
+
+	h.mu.RLock()
+	entries := make([]*Entry, 0, len(h.entries))
+	for _, e := range h.entries {
+		entries = append(entries, e)
+	}
+	h.mu.RUnlock()
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	tmp := h.filePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, h.filePath); err != nil {
+		return fmt.Errorf("replace %s: %w", h.filePath, err)
+	}
+
+	return nil
+}
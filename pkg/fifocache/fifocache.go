@@ -0,0 +1,42 @@
+// Package fifocache provides a small in-memory cache bounded by entry count
+// that drops the oldest entries first.
+package fifocache
+
+import "sync"
+
+// Cache maps string keys to values, keeping at most max entries. Replacing
+// a value doesn't change its age. It is safe for concurrent use.
+type Cache[V any] struct {
+	max int
+
+	mu      sync.Mutex
+	entries map[string]V
+	order   []string // keys, oldest first
+}
+
+// New creates a cache holding at most max entries.
+func New[V any](max int) *Cache[V] {
+	return &Cache[V]{max: max, entries: make(map[string]V)}
+}
+
+// Get returns the value cached for key, if any.
+func (c *Cache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.entries[key]
+	return v, ok
+}
+
+// Put caches v for key, dropping the oldest entries above the limit.
+func (c *Cache[V]) Put(key string, v V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = v
+	for len(c.order) > c.max {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
@@ -1,7 +1,10 @@
 package httpclient
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
@@ -48,3 +51,48 @@ func NewStreaming() *http.Client {
 		},
 	}
 }
+
+// ParseProxyURL validates an upstream proxy URL. Supported schemes are http,
+// https, socks5 and socks5h; credentials may be given as user:pass@host.
+// socks5h is normalized to socks5 (Go always resolves names on the proxy).
+func ParseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "socks5":
+		u.Scheme = strings.ToLower(u.Scheme)
+	case "socks5h":
+		u.Scheme = "socks5"
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (use http, https or socks5)", u.Scheme)
+	}
+
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("proxy URL is missing a host")
+	}
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("proxy URL must not contain a path")
+	}
+
+	return u, nil
+}
+
+// NewWithProxy creates an API client like New that sends every request
+// through the given HTTP(S) or SOCKS5 proxy. Each client keeps its own
+// connection pool, so callers should reuse one client per proxy.
+func NewWithProxy(proxyURL *url.URL) *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &uaTransport{
+			base: &http.Transport{
+				Proxy:               http.ProxyURL(proxyURL),
+				MaxIdleConns:        100,
+				MaxIdleConnsPerHost: 10,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+	}
+}
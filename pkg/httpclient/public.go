@@ -0,0 +1,133 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrNonPublicAddress is returned when a public-only client is asked to
+// connect to a loopback, private or otherwise internal address.
+var ErrNonPublicAddress = errors.New("non-public address")
+
+// nonPublicNets are reserved ranges not covered by the net.IP predicates
+// used in IsPublicIP.
+var nonPublicNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",      // "this network"
+		"100.64.0.0/10",  // carrier-grade NAT, Tailscale
+		"192.0.0.0/24",   // IETF protocol assignments
+		"198.18.0.0/15",  // benchmarking
+		"240.0.0.0/4",    // reserved, broadcast
+		"64:ff9b::/96",   // NAT64, reaches IPv4 addresses
+		"64:ff9b:1::/48", // local-use NAT64
+		"2001:db8::/32",  // documentation
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// IsPublicIP reports whether ip is a publicly routable unicast address:
+// not loopback, private, link-local (including cloud metadata at
+// 169.254.169.254), multicast, unspecified or another reserved range.
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range nonPublicNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchHost reports whether host equals one of patterns or is a subdomain
+// of one. Both are compared case-insensitively.
+func MatchHost(host string, patterns []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if host == p || strings.HasSuffix(host, "."+p) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicOnlyDial returns a DialContext that refuses non-public addresses.
+// The check runs on the address actually dialed, after DNS resolution, so
+// it also covers redirects and names that resolve differently later (DNS
+// rebinding). Hosts for which exempt returns true (may be nil) are dialed
+// without the check.
+func publicOnlyDial(exempt func(host string) bool) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	plain := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	checked := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+				return fmt.Errorf("%w: %s", ErrNonPublicAddress, host)
+			}
+			return nil
+		},
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(addr); err == nil && exempt != nil && exempt(host) {
+			return plain.DialContext(ctx, network, addr)
+		}
+		return checked.DialContext(ctx, network, addr)
+	}
+}
+
+// NewPublicOnly creates an API client like New that only connects to public
+// addresses, except for hosts exempt allows (may be nil). Use it for URLs
+// that come from untrusted input.
+func NewPublicOnly(exempt func(host string) bool) *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &uaTransport{
+			base: &http.Transport{
+				DialContext:         publicOnlyDial(exempt),
+				MaxIdleConns:        100,
+				MaxIdleConnsPerHost: 10,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+	}
+}
+
+// NewStreamingPublicOnly creates a streaming client like NewStreaming that
+// only connects to public addresses, except for hosts exempt allows (may be
+// nil).
+func NewStreamingPublicOnly(exempt func(host string) bool) *http.Client {
+	return &http.Client{
+		Timeout: 0, // No timeout for streaming
+		Transport: &uaTransport{
+			base: &http.Transport{
+				DialContext:         publicOnlyDial(exempt),
+				MaxIdleConns:        50,
+				MaxIdleConnsPerHost: 10,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+	}
+}